@@ -0,0 +1,191 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// These prefixes select how an element of matchCommandElements is matched, in
+// rules with the Typed matcher syntax. Rules with the Literal syntax, the
+// default, match every element other than a wildcard exactly, so that existing
+// rules such as ["rake", "re:run"] keep their meaning.
+const (
+	// MatcherPrefixExact matches the rest of the element exactly, which allows
+	// matching a literal `*` or an element that starts with another prefix
+	MatcherPrefixExact = "exact:"
+	// MatcherPrefixRegexp matches the element against a regular expression,
+	// which must match the whole element
+	MatcherPrefixRegexp = "re:"
+	// MatcherPrefixGlob matches the element against a shell glob, as
+	// implemented by path.Match, in which `*` doesn't match a `/`
+	MatcherPrefixGlob = "glob:"
+	// MatcherPrefixFlag matches the element exactly, but consecutive flag
+	// matchers match their elements in any order
+	MatcherPrefixFlag = "flag:"
+)
+
+var matcherPrefixes = []string{MatcherPrefixExact, MatcherPrefixRegexp, MatcherPrefixGlob, MatcherPrefixFlag}
+
+type commandMatcherKind int
+
+const (
+	matchExact commandMatcherKind = iota
+	matchAny
+	matchAnyNumber
+	matchRegexp
+	matchGlob
+	matchFlags
+)
+
+// commandMatcher matches one or more elements of a command
+type commandMatcher struct {
+	kind    commandMatcherKind
+	pattern string
+	regexp  *regexp.Regexp
+	// flags matched in any order by a group of consecutive flag matchers
+	flags []string
+}
+
+// parseCommandMatcher parses a single element of matchCommandElements, using
+// the given syntax, returning an error if its pattern is invalid.
+func parseCommandMatcher(element string, syntax CommandMatcherSyntax) (commandMatcher, error) {
+	if element == "" {
+		return commandMatcher{}, errors.New("an empty matcher is invalid")
+	}
+
+	switch element {
+	case "*":
+		return commandMatcher{kind: matchAny}, nil
+	case "**":
+		return commandMatcher{kind: matchAnyNumber}, nil
+	}
+
+	if syntax != CommandMatcherSyntaxTyped {
+		return commandMatcher{kind: matchExact, pattern: element}, nil
+	}
+
+	prefix, pattern, _ := strings.Cut(element, ":")
+	prefix += ":"
+	if pattern == "" && slices.Contains(matcherPrefixes, prefix) {
+		return commandMatcher{}, errors.Errorf("a %s matcher must have a pattern", strings.TrimSuffix(prefix, ":"))
+	}
+
+	switch prefix {
+	case MatcherPrefixExact:
+		return commandMatcher{kind: matchExact, pattern: pattern}, nil
+
+	case MatcherPrefixRegexp:
+		re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", pattern))
+		if err != nil {
+			return commandMatcher{}, errors.Wrap(err, "invalid regular expression")
+		}
+		return commandMatcher{kind: matchRegexp, pattern: pattern, regexp: re}, nil
+
+	case MatcherPrefixGlob:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return commandMatcher{}, errors.Wrap(err, "invalid glob")
+		}
+		return commandMatcher{kind: matchGlob, pattern: pattern}, nil
+
+	case MatcherPrefixFlag:
+		return commandMatcher{kind: matchFlags, flags: []string{pattern}}, nil
+	}
+
+	return commandMatcher{kind: matchExact, pattern: element}, nil
+}
+
+// compileCommandMatchers parses the elements of matchCommandElements, grouping
+// consecutive flag matchers so they can match in any order.
+func compileCommandMatchers(elements []string, syntax CommandMatcherSyntax) ([]commandMatcher, error) {
+	matchers := []commandMatcher{}
+	for i, element := range elements {
+		matcher, err := parseCommandMatcher(element, syntax)
+		if err != nil {
+			return nil, errors.Wrapf(err, "matchCommandElements[%d]", i)
+		}
+
+		if last := len(matchers) - 1; matcher.kind == matchFlags && last >= 0 && matchers[last].kind == matchFlags {
+			matchers[last].flags = append(matchers[last].flags, matcher.flags...)
+			continue
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+// matchesElement returns whether a matcher that matches a single element
+// matches the given element of the command
+func (m commandMatcher) matchesElement(element string) bool {
+	switch m.kind {
+	case matchAny:
+		return true
+	case matchRegexp:
+		return m.regexp.MatchString(element)
+	case matchGlob:
+		matched, _ := path.Match(m.pattern, element)
+		return matched
+	default:
+		return element == m.pattern
+	}
+}
+
+// matchesFlags returns whether the elements are the flags of the matcher, in
+// any order
+func (m commandMatcher) matchesFlags(elements []string) bool {
+	remaining := slices.Clone(m.flags)
+	for _, element := range elements {
+		idx := slices.Index(remaining, element)
+		if idx < 0 {
+			return false
+		}
+		remaining = slices.Delete(remaining, idx, idx+1)
+	}
+
+	return len(remaining) == 0
+}
+
+// matchCommand returns whether the matchers match the whole of the command
+func matchCommand(matchers []commandMatcher, command []string) bool {
+	// Double wildcards can match any number of elements, so we may try matching
+	// from the same position more than once. Remembering the positions that
+	// failed stops rules with several double wildcards taking exponential time.
+	failed := map[[2]int]bool{}
+
+	var match func(m, c int) bool
+	match = func(m, c int) bool {
+		if m == len(matchers) {
+			return c == len(command)
+		}
+		if failed[[2]int{m, c}] {
+			return false
+		}
+
+		matched := false
+		switch matcher := matchers[m]; matcher.kind {
+		case matchAnyNumber:
+			for next := c; next <= len(command) && !matched; next++ {
+				matched = match(m+1, next)
+			}
+		case matchFlags:
+			end := c + len(matcher.flags)
+			matched = end <= len(command) && matcher.matchesFlags(command[c:end]) && match(m+1, end)
+		default:
+			matched = c < len(command) && matcher.matchesElement(command[c]) && match(m+1, c+1)
+		}
+
+		if !matched {
+			failed[[2]int{m, c}] = true
+		}
+
+		return matched
+	}
+
+	return match(0, 0)
+}
@@ -12,7 +12,79 @@ type ConsoleAuthorisationSpec struct {
 	ConsoleRef corev1.LocalObjectReference `json:"consoleRef"`
 
 	// List of authorisations that have been given to the referenced console.
-	Authorisations []rbacv1.Subject `json:"authorisations"`
+	Authorisations []ConsoleAuthorisationEntry `json:"authorisations"`
+
+	// List of rejections that have been given to the referenced console. A
+	// single rejection prevents the console from running.
+	// +optional
+	Rejections []ConsoleRejection `json:"rejections,omitempty"`
+
+	// List of authorisations that have been given to requests to extend the
+	// timeout of the referenced console.
+	// +optional
+	TimeoutExtensionAuthorisations []ConsoleTimeoutExtensionAuthorisation `json:"timeoutExtensionAuthorisations,omitempty"`
+}
+
+// ConsoleAuthorisationEntry records a subject authorising the referenced
+// console.
+type ConsoleAuthorisationEntry struct {
+	rbacv1.Subject `json:",inline"`
+
+	// Time at which the authorisation was given. This is set by an admission
+	// webhook when the authorisation is added, and can't be supplied by the
+	// authoriser.
+	// +optional
+	AuthorisedAt *metav1.Time `json:"authorisedAt,omitempty"`
+
+	// Groups the authoriser belonged to when the authorisation was given, used
+	// to match them against Group subjects of authorisation rule clauses. This
+	// is set by an admission webhook from the authenticated user, and can't be
+	// supplied by the authoriser.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+
+	// Optional comment from the authoriser, e.g. the context in which the
+	// authorisation was given.
+	// +optional
+	Comment string `json:"comment,omitempty"`
+}
+
+// ConsoleRejection records a subject rejecting the referenced console.
+type ConsoleRejection struct {
+	rbacv1.Subject `json:",inline"`
+
+	// Time at which the rejection was given. This is set by an admission
+	// webhook when the rejection is added.
+	// +optional
+	RejectedAt *metav1.Time `json:"rejectedAt,omitempty"`
+
+	// Reason for rejecting the console, which is shown to the requester.
+	// +kubebuilder:validation:MinLength=1
+	Reason string `json:"reason"`
+}
+
+// ConsoleTimeoutExtensionAuthorisation records a subject authorising one of
+// the timeout extensions requested on a console.
+type ConsoleTimeoutExtensionAuthorisation struct {
+	// Index of the extension being authorised, within the console's
+	// spec.timeoutExtensions field.
+	// +kubebuilder:validation:Minimum=0
+	TimeoutExtension int `json:"timeoutExtension"`
+
+	rbacv1.Subject `json:",inline"`
+
+	// Time at which the authorisation was given. This is set by an admission
+	// webhook when the authorisation is added, and can't be supplied by the
+	// authoriser.
+	// +optional
+	AuthorisedAt *metav1.Time `json:"authorisedAt,omitempty"`
+
+	// Groups the authoriser belonged to when the authorisation was given, used
+	// to match them against Group subjects of authorisation rule clauses. This
+	// is set by an admission webhook from the authenticated user, and can't be
+	// supplied by the authoriser.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
 }
 
 // ConsoleAuthorisationStatus defines the observed state of ConsoleAuthorisation
@@ -0,0 +1,51 @@
+package v1alpha1
+
+// These are the types of condition reported on a console, in the order in
+// which a console must satisfy them before it is ready
+const (
+	// ConsoleTemplateResolvedCondition means the template referenced by the console exists
+	ConsoleTemplateResolvedCondition = "TemplateResolved"
+	// ConsoleAuthorisedCondition means the console has been given the
+	// authorisations required by the rule matching its command, or needs none
+	ConsoleAuthorisedCondition = "Authorised"
+	// ConsoleJobCreatedCondition means the job that runs the console has been created
+	ConsoleJobCreatedCondition = "JobCreated"
+	// ConsolePodScheduledCondition means the pod of the console has been scheduled to a
+	// node
+	ConsolePodScheduledCondition = "PodScheduled"
+	// ConsoleReadyCondition means the console is running and can be attached to
+	ConsoleReadyCondition = "Ready"
+)
+
+// ConsoleConditionTypes lists the types of condition reported on a console, in
+// the order in which they are satisfied
+var ConsoleConditionTypes = []string{
+	ConsoleTemplateResolvedCondition,
+	ConsoleAuthorisedCondition,
+	ConsoleJobCreatedCondition,
+	ConsolePodScheduledCondition,
+	ConsoleReadyCondition,
+}
+
+// These are the reasons given for the console conditions, other than those
+// copied from the console's pod
+const (
+	ReasonTemplateFound            = "TemplateFound"
+	ReasonTemplateNotFound         = "TemplateNotFound"
+	ReasonAuthorisationNotRequired = "AuthorisationNotRequired"
+	ReasonAuthorised               = "Authorised"
+	ReasonPendingAuthorisation     = "PendingAuthorisation"
+	ReasonRejected                 = "Rejected"
+	ReasonNoMatchingRule           = "NoMatchingRule"
+	ReasonUnresolvableSubject      = "UnresolvableSubject"
+	ReasonJobCreated               = "JobCreated"
+	ReasonJobDeleted               = "JobDeleted"
+	ReasonNotAuthorised            = "NotAuthorised"
+	ReasonQueued                   = "Queued"
+	ReasonPodNotCreated            = "PodNotCreated"
+	ReasonPodPending               = "PodPending"
+	ReasonPodScheduled             = "Scheduled"
+	ReasonRunning                  = "Running"
+	ReasonStopped                  = "Stopped"
+	ReasonContainerNotReady        = "ContainerNotReady"
+)
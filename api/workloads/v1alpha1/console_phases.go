@@ -6,6 +6,12 @@ type ConsolePhase string
 const (
 	// ConsolePendingAuthorisation means the console been created but it is not yet authorised to run
 	ConsolePendingAuthorisation ConsolePhase = "Pending Authorisation"
+	// ConsoleRejected means the console was rejected by an authoriser and will not run
+	ConsoleRejected ConsolePhase = "Rejected"
+	// ConsoleQueued means the console is authorised, but is waiting for other
+	// consoles to finish before it can run, due to the template's concurrency
+	// limits
+	ConsoleQueued ConsolePhase = "Queued"
 	// ConsolePending means the console has been created but its pod is not yet ready
 	ConsolePending ConsolePhase = "Pending"
 	// ConsoleRunning means the pod has started and is running
@@ -13,23 +13,50 @@ type ConsoleAuthorisationRule struct {
 
 	// The matching rule to compare to the command and arguments of the console.
 	//
-	// This uses basic wildcard matching: Each element of the array is evaluated
-	// against the corresponding element of the console's `spec.command` field.
+	// Each element of the array is evaluated against the corresponding element of
+	// the console's `spec.command` field.
 	// An element consisting of a single `*` character will assert on the
 	// presence of an element, but will allow any contents.
-	// An element consisting of `**`, at the end of the match array, will match 0
-	// or more additional elements in the command, but can only be used at the
-	// end of the rule.
+	// An element consisting of `**` will match 0 or more elements in the command,
+	// and can be used anywhere in the rule.
 	//
-	// Pattern matching _within_ elements is deliberately not supported, as this
-	// makes it much harder to construct rules which are secure and do not allow chaining of additional commands (e.g. in a shell context).
+	// When matcherSyntax is Typed, elements can instead use a typed matcher, of the
+	// form `<type>:<pattern>`: `re:` matches a regular expression against the whole
+	// element, `glob:` matches a glob in which `*` doesn't match `/`, `flag:`
+	// matches exactly but consecutive flag matchers match their elements in any
+	// order, and `exact:` matches exactly, e.g. to match a literal `*`. Any other
+	// element is matched exactly.
+	//
+	// Take care that patterns within elements don't allow chaining of additional
+	// commands (e.g. in a shell context), and prefer the narrowest pattern that works.
 	//
 	// +kubebuilder:validation:MinItems=1
 	MatchCommandElements []string `json:"matchCommandElements"`
 
+	// How the elements of matchCommandElements are interpreted. Literal, the
+	// default, matches every element other than a wildcard exactly. Typed also
+	// interprets elements that start with `re:`, `glob:`, `flag:` or `exact:` as
+	// typed matchers.
+	// +optional
+	MatcherSyntax CommandMatcherSyntax `json:"matcherSyntax,omitempty"`
+
 	ConsoleAuthorisers `json:",inline"`
 }
 
+// CommandMatcherSyntax selects how the elements of an authorisation rule's
+// matchCommandElements are interpreted.
+// +kubebuilder:validation:Enum=Literal;Typed
+type CommandMatcherSyntax string
+
+const (
+	// CommandMatcherSyntaxLiteral matches every element exactly, other than the
+	// `*` and `**` wildcards
+	CommandMatcherSyntaxLiteral CommandMatcherSyntax = "Literal"
+	// CommandMatcherSyntaxTyped additionally interprets elements of the form
+	// `<type>:<pattern>` as typed matchers
+	CommandMatcherSyntaxTyped CommandMatcherSyntax = "Typed"
+)
+
 // ConsoleAuthorisers declares the subjects required to perform authorisations.
 type ConsoleAuthorisers struct {
 	// The number of authorisations required from members of the subjects before the console can run.
@@ -37,6 +64,34 @@ type ConsoleAuthorisers struct {
 
 	// List of subjects that can provide authorisation for the console command to run.
 	Subjects []rbacv1.Subject `json:"subjects"`
+
+	// Clauses that must each be satisfied before the console can run, e.g. to
+	// require an authorisation from members of two different teams. Each
+	// authorisation counts towards at most one clause, so the same person
+	// can't satisfy two clauses, and towards AuthorisationsRequired, which
+	// must be at least the total required by the clauses. Subjects of each
+	// clause are able to authorise in addition to the Subjects above.
+	// +optional
+	Clauses []ConsoleAuthoriserClause `json:"clauses,omitempty"`
+}
+
+// ConsoleAuthoriserClause requires a number of authorisations from members of
+// particular subjects.
+type ConsoleAuthoriserClause struct {
+	// Human readable name of the clause, shown while it is outstanding.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// The number of authorisations required from members of the subjects to
+	// satisfy the clause.
+	// +kubebuilder:validation:Minimum=1
+	AuthorisationsRequired int `json:"authorisationsRequired"`
+
+	// List of subjects that can provide authorisation towards the clause.
+	// Groups are resolved to their members using the directories configured
+	// on the workloads manager.
+	// +kubebuilder:validation:MinItems=1
+	Subjects []rbacv1.Subject `json:"subjects"`
 }
 
 // PodTemplatePreserveMetadataSpec describes the data a pod should have when created from a template
@@ -92,6 +147,44 @@ type ConsoleTemplateSpec struct {
 	// Default authorisation rule to use if no authorisation rules are defined or no authorisation rules match.
 	// +optional
 	DefaultAuthorisationRule *ConsoleAuthorisers `json:"defaultAuthorisationRule,omitempty"`
+
+	// Whether consoles can only run commands that match one of the
+	// authorisation rules. Consoles with any other command are rejected when
+	// they are created, so a default authorisation rule can't be set.
+	// +optional
+	RestrictCommands bool `json:"restrictCommands,omitempty"`
+
+	// Time, in seconds, for which an authorisation remains valid. Once this has
+	// elapsed, the authorisation no longer counts towards the authorisations
+	// required for a console to start. Authorisations without a recorded time
+	// are never considered valid when this is set. If not set, authorisations
+	// never lapse.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=604800
+	AuthorisationValiditySeconds *int32 `json:"authorisationValiditySeconds,omitempty"`
+
+	// Whether requests to extend the timeout of a console must be authorised
+	// before they take effect. When set, the authorisation rule that matched the
+	// console's command must be satisfied again for each extension.
+	// +optional
+	TimeoutExtensionsRequireAuthorisation bool `json:"timeoutExtensionsRequireAuthorisation,omitempty"`
+
+	// Maximum number of consoles created from this template that can run at
+	// once. Authorised consoles in excess of this are held in the Queued phase
+	// until capacity frees up, and are started in the order they were created.
+	// If not set, the number of consoles is not limited.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentConsoles *int32 `json:"maxConcurrentConsoles,omitempty"`
+
+	// Maximum number of consoles created from this template that any one user
+	// can run at once. Consoles in excess of this are queued in the same way as
+	// for MaxConcurrentConsoles. If not set, the number of consoles per user is
+	// not limited.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentConsolesPerUser *int32 `json:"maxConcurrentConsolesPerUser,omitempty"`
 }
 
 // ConsoleTemplateStatus defines the observed state of ConsoleTemplate
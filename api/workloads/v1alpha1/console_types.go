@@ -50,6 +50,26 @@ type ConsoleSpec struct {
 	// situations, enabling the TTY on a container in the console causes
 	// breakage - in Tekton steps, for example.
 	Noninteractive bool `json:"noninteractive,omitempty"`
+
+	// Requests to extend the timeout of this console, appended by the console
+	// owner while the console exists. Each extension adds to TimeoutSeconds once
+	// it has been authorised (if the template requires it), but the total
+	// timeout is still clamped to the Maximum Timeout Seconds specified in the
+	// ConsoleTemplate.
+	// +optional
+	TimeoutExtensions []ConsoleTimeoutExtension `json:"timeoutExtensions,omitempty"`
+}
+
+// ConsoleTimeoutExtension is a request to extend the timeout of a console.
+type ConsoleTimeoutExtension struct {
+	// Number of seconds to add to the timeout of the console.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=604800
+	Seconds int `json:"seconds"`
+
+	// Reason for extending the console.
+	// +optional
+	Reason string `json:"reason,omitempty"`
 }
 
 // ConsoleStatus defines the observed state of Console
@@ -59,10 +79,49 @@ type ConsoleStatus struct {
 	// Time at which the job completed successfully
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 	Phase          ConsolePhase `json:"phase"`
+	// Time at which the earliest of the authorisations given to the console
+	// lapses, if the template limits how long authorisations remain valid.
+	// This is only maintained until the console job has been created.
+	AuthorisationExpiryTime *metav1.Time `json:"authorisationExpiryTime,omitempty"`
+	// Clauses of the authorisation rule that have yet to be satisfied, while
+	// the console is pending authorisation
+	// +optional
+	OutstandingAuthorisations []ConsoleOutstandingAuthorisation `json:"outstandingAuthorisations,omitempty"`
+	// Exit code of the console container, once it has terminated
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	// Reason the console container terminated, e.g. Completed, Error or
+	// OOMKilled
+	TerminationReason string `json:"terminationReason,omitempty"`
+	// Human-readable explanation of why the console is in its current phase,
+	// taken from the first of its conditions that is not yet satisfied
+	Message string `json:"message,omitempty"`
+	// The generation of the console that the status was last calculated from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The last authorisation event, e.g. Request or Authorised, that authorisers
+	// were notified about, so that each is only sent once
+	LastNotification string `json:"lastNotification,omitempty"`
+	// Conditions describing each stage the console must pass through before it
+	// is ready: TemplateResolved, Authorised, JobCreated, PodScheduled and Ready
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConsoleOutstandingAuthorisation records progress towards an authoriser
+// clause that has not yet been satisfied.
+type ConsoleOutstandingAuthorisation struct {
+	// Name of the clause
+	Name string `json:"name"`
+	// The number of authorisations required to satisfy the clause
+	AuthorisationsRequired int `json:"authorisationsRequired"`
+	// The number of valid authorisations that count towards the clause
+	AuthorisationsGiven int `json:"authorisationsGiven"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
+// +kubebuilder:subresource:status
 
 // Console declares an instance of a console environment to be created by a specific user
 // +kubebuilder:printcolumn:name="User",type="string",JSONPath=".spec.user"
@@ -1,10 +1,18 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // Creating returns true if the console has no status (the console has just been created)
@@ -17,10 +25,20 @@ func (c *Console) PendingAuthorisation() bool {
 	return c.Status.Phase == ConsolePendingAuthorisation
 }
 
+// Rejected returns true if the console has been rejected
+func (c *Console) Rejected() bool {
+	return c.Status.Phase == ConsoleRejected
+}
+
+// Queued returns true if the console is Queued
+func (c *Console) Queued() bool {
+	return c.Status.Phase == ConsoleQueued
+}
+
 // PendingJob returns true if the console is in a phase that occurs before job
 // creation
 func (c *Console) PendingJob() bool {
-	return c.Creating() || c.PendingAuthorisation()
+	return c.Creating() || c.PendingAuthorisation() || c.Queued()
 }
 
 // Pending returns true if the console is Pending
@@ -45,7 +63,7 @@ func (c *Console) Destroyed() bool {
 
 // PreRunning returns true if the console is in a phase before Running
 func (c *Console) PreRunning() bool {
-	return c.Creating() || c.PendingAuthorisation() || c.Pending()
+	return c.Creating() || c.PendingAuthorisation() || c.Queued() || c.Pending()
 }
 
 // PostRunning returns true if the console is in a phase after Running
@@ -68,10 +86,11 @@ func (c *Console) EligibleForGC() bool {
 //
 // This will be the case if:
 // - TTLSecondsBeforeRunning has elapsed and the console hasn't progressed to running
+// - TTLSecondsBeforeRunning has elapsed and the console was rejected
 // - TTLSecondsAfterFinished has elapsed and the console is stopped or destroyed
 func (c *Console) GetGCTime() *time.Time {
 	switch {
-	case c.PreRunning():
+	case c.PreRunning(), c.Rejected():
 		// When the console hasn't progressed to the running phase
 		t := c.CreationTimestamp.Add(c.TTLSecondsBeforeRunning())
 		return &t
@@ -99,6 +118,398 @@ func (c *Console) TTLSecondsBeforeRunning() time.Duration {
 	return time.Duration(*c.Spec.TTLSecondsBeforeRunning) * time.Second
 }
 
+// ApprovedTimeoutExtensions returns the timeout extensions requested on the
+// console that are permitted to take effect.
+//
+// Extensions are approved unconditionally unless the template requires them to
+// be authorised, in which case each extension must be authorised in the same
+// way as the console itself: by as many distinct authorisers as the rule that
+// matched the console's command requires, satisfying each of its clauses, with
+// none of their authorisations having lapsed. Once an extension has been
+// approved it remains so, even after the authorisations that approved it lapse.
+func (c *Console) ApprovedTimeoutExtensions(tpl *ConsoleTemplate, rule *ConsoleAuthorisationRule, auth *ConsoleAuthorisation, matches SubjectMatcher) ([]ConsoleTimeoutExtension, error) {
+	approved := []ConsoleTimeoutExtension{}
+	for idx, extension := range c.Spec.TimeoutExtensions {
+		if !tpl.Spec.TimeoutExtensionsRequireAuthorisation || rule == nil || rule.AuthorisationsRequired == 0 {
+			approved = append(approved, extension)
+			continue
+		}
+		if auth == nil {
+			continue
+		}
+
+		ok, err := auth.TimeoutExtensionAuthorised(idx, rule, tpl.AuthorisationValidity(), matches)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			approved = append(approved, extension)
+		}
+	}
+
+	return approved, nil
+}
+
+// TimeoutSecondsWithExtensions returns the number of seconds that the console
+// should run for, taking into account any approved timeout extensions. The
+// result never exceeds the template's MaxTimeoutSeconds.
+func (c *Console) TimeoutSecondsWithExtensions(tpl *ConsoleTemplate, rule *ConsoleAuthorisationRule, auth *ConsoleAuthorisation, matches SubjectMatcher) (int, error) {
+	extensions, err := c.ApprovedTimeoutExtensions(tpl, rule, auth, matches)
+	if err != nil {
+		return 0, err
+	}
+
+	timeout := c.Spec.TimeoutSeconds
+	for _, extension := range extensions {
+		timeout += extension.Seconds
+	}
+
+	if timeout > tpl.Spec.MaxTimeoutSeconds {
+		return tpl.Spec.MaxTimeoutSeconds, nil
+	}
+
+	return timeout, nil
+}
+
+// TimeoutExtensionAuthorised returns whether the timeout extension at the given
+// index has been authorised according to the rule.
+//
+// As authorisations are only ever appended, the extension is authorised if, at
+// the time any one of its authorisations was given, the authorisations that
+// were still valid satisfied the rule. A zero validity means that
+// authorisations never lapse.
+func (a *ConsoleAuthorisation) TimeoutExtensionAuthorised(idx int, rule *ConsoleAuthorisationRule, validity time.Duration, matches SubjectMatcher) (bool, error) {
+	matches = a.MatchGroups(matches)
+
+	entries := []ConsoleTimeoutExtensionAuthorisation{}
+	for _, entry := range a.Spec.TimeoutExtensionAuthorisations {
+		if entry.TimeoutExtension == idx {
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, at := range entries {
+		if validity != 0 && at.AuthorisedAt == nil {
+			continue
+		}
+
+		// Count each subject once, regardless of how many times they appear
+		authorisers := []rbacv1.Subject{}
+		for _, entry := range entries {
+			if validity != 0 {
+				if entry.AuthorisedAt == nil || entry.AuthorisedAt.After(at.AuthorisedAt.Time) ||
+					!at.AuthorisedAt.Time.Before(entry.AuthorisedAt.Add(validity)) {
+					continue
+				}
+			}
+			if !slices.Contains(authorisers, entry.Subject) {
+				authorisers = append(authorisers, entry.Subject)
+			}
+		}
+
+		if len(authorisers) >= rule.AuthorisationsRequired {
+			outstanding, err := rule.OutstandingClauses(authorisers, matches)
+			if err != nil {
+				return false, err
+			}
+			if len(outstanding) == 0 {
+				return true, nil
+			}
+		}
+
+		// Authorisations never lapse, so every time sees the same authorisers
+		if validity == 0 {
+			break
+		}
+	}
+
+	return false, nil
+}
+
+// AuthorisationValidity returns the duration for which authorisations given to
+// consoles created from the template remain valid, or zero if they never lapse.
+func (ct *ConsoleTemplate) AuthorisationValidity() time.Duration {
+	if ct.Spec.AuthorisationValiditySeconds == nil {
+		return 0
+	}
+
+	return time.Duration(*ct.Spec.AuthorisationValiditySeconds) * time.Second
+}
+
+// Subjects returns the subjects that have authorised the console, regardless
+// of whether their authorisations are still valid.
+func (a *ConsoleAuthorisation) Subjects() []rbacv1.Subject {
+	subjects := make([]rbacv1.Subject, 0, len(a.Spec.Authorisations))
+	for _, entry := range a.Spec.Authorisations {
+		subjects = append(subjects, entry.Subject)
+	}
+
+	return subjects
+}
+
+// RejectedBy returns whether the given subject has rejected the console.
+func (a *ConsoleAuthorisation) RejectedBy(subject rbacv1.Subject) bool {
+	for _, rejection := range a.Spec.Rejections {
+		if rejection.Kind == subject.Kind && rejection.Name == subject.Name && rejection.Namespace == subject.Namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidAuthorisations returns the authorisations that are still valid at the
+// given time. A zero validity means that authorisations never lapse.
+func (a *ConsoleAuthorisation) ValidAuthorisations(validity time.Duration, now time.Time) []ConsoleAuthorisationEntry {
+	if validity == 0 {
+		return a.Spec.Authorisations
+	}
+
+	valid := []ConsoleAuthorisationEntry{}
+	for _, entry := range a.Spec.Authorisations {
+		if entry.AuthorisedAt == nil {
+			continue
+		}
+		if now.Before(entry.AuthorisedAt.Add(validity)) {
+			valid = append(valid, entry)
+		}
+	}
+
+	return valid
+}
+
+// AuthorisationExpiryTime returns the time at which the earliest of the
+// authorisations that are valid at the given time will lapse, or nil if there
+// are none or authorisations never lapse.
+func (a *ConsoleAuthorisation) AuthorisationExpiryTime(validity time.Duration, now time.Time) *time.Time {
+	if validity == 0 {
+		return nil
+	}
+
+	var expiry *time.Time
+	for _, entry := range a.ValidAuthorisations(validity, now) {
+		t := entry.AuthorisedAt.Add(validity)
+		if expiry == nil || t.Before(*expiry) {
+			expiry = &t
+		}
+	}
+
+	return expiry
+}
+
+// SubjectMatcher reports whether an authoriser is covered by a subject listed
+// on an authorisation rule, e.g. because they are a member of a group.
+type SubjectMatcher func(authoriser, subject rbacv1.Subject) (bool, error)
+
+// MatchSubject is a SubjectMatcher that only matches identical subjects, without
+// resolving the members of groups. As authorisers are always recorded as users,
+// a ServiceAccount subject matches the username its token authenticates as.
+func MatchSubject(authoriser, subject rbacv1.Subject) (bool, error) {
+	if subject.Kind == rbacv1.ServiceAccountKind && authoriser.Kind == rbacv1.UserKind {
+		return authoriser.Name == fmt.Sprintf("system:serviceaccount:%s:%s", subject.Namespace, subject.Name), nil
+	}
+
+	return authoriser.Kind == subject.Kind && authoriser.Name == subject.Name && authoriser.Namespace == subject.Namespace, nil
+}
+
+// MatchGroups returns a SubjectMatcher that matches authorisers against Group
+// subjects using the groups recorded when they gave their authorisations, and
+// otherwise defers to the given matcher.
+func (a *ConsoleAuthorisation) MatchGroups(matches SubjectMatcher) SubjectMatcher {
+	groups := map[string][]string{}
+	for _, entry := range a.Spec.Authorisations {
+		groups[entry.Name] = append(groups[entry.Name], entry.Groups...)
+	}
+	for _, entry := range a.Spec.TimeoutExtensionAuthorisations {
+		groups[entry.Name] = append(groups[entry.Name], entry.Groups...)
+	}
+
+	return func(authoriser, subject rbacv1.Subject) (bool, error) {
+		if subject.Kind == rbacv1.GroupKind && authoriser.Kind == rbacv1.UserKind {
+			return slices.Contains(groups[authoriser.Name], subject.Name), nil
+		}
+
+		return matches(authoriser, subject)
+	}
+}
+
+// AuthoriserSubjects returns every subject that can authorise consoles under
+// the rule, including the subjects of each clause.
+func (a *ConsoleAuthorisers) AuthoriserSubjects() []rbacv1.Subject {
+	subjects := []rbacv1.Subject{}
+	for _, subject := range a.Subjects {
+		if !slices.Contains(subjects, subject) {
+			subjects = append(subjects, subject)
+		}
+	}
+	for _, clause := range a.Clauses {
+		for _, subject := range clause.Subjects {
+			if !slices.Contains(subjects, subject) {
+				subjects = append(subjects, subject)
+			}
+		}
+	}
+
+	return subjects
+}
+
+// OutstandingClauses returns the clauses of the rule that can't be satisfied by
+// the given authorisers, along with how many authorisations count towards each.
+//
+// Each authoriser counts towards at most one clause. As an authoriser may be
+// eligible for several clauses, e.g. when they are a member of more than one
+// group, they are assigned so that as many authorisations count as possible:
+// an authoriser already counting towards a full clause is moved to another
+// clause they are eligible for if that makes room for a new authoriser.
+func (a *ConsoleAuthorisers) OutstandingClauses(authorisers []rbacv1.Subject, matches SubjectMatcher) ([]ConsoleOutstandingAuthorisation, error) {
+	if len(a.Clauses) == 0 {
+		return nil, nil
+	}
+
+	// Count each subject once, regardless of how many times they appear
+	unique := []rbacv1.Subject{}
+	for _, authoriser := range authorisers {
+		if !slices.Contains(unique, authoriser) {
+			unique = append(unique, authoriser)
+		}
+	}
+
+	eligible := make([][]bool, len(unique))
+	for i, authoriser := range unique {
+		eligible[i] = make([]bool, len(a.Clauses))
+		for j, clause := range a.Clauses {
+			for _, subject := range clause.Subjects {
+				ok, err := matches(authoriser, subject)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					eligible[i][j] = true
+					break
+				}
+			}
+		}
+	}
+
+	assigned := make([]int, len(unique))
+	given := make([]int, len(a.Clauses))
+
+	var assign func(i int, visited []bool) bool
+	assign = func(i int, visited []bool) bool {
+		for j, clause := range a.Clauses {
+			if !eligible[i][j] || visited[j] {
+				continue
+			}
+			visited[j] = true
+
+			if given[j] < clause.AuthorisationsRequired {
+				assigned[i] = j
+				given[j]++
+				return true
+			}
+
+			// The clause is full, so see if one of its authorisers can move to
+			// another clause to make room
+			for k := range unique {
+				if k != i && assigned[k] == j && assign(k, visited) {
+					assigned[i] = j
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	for i := range unique {
+		assigned[i] = -1
+	}
+	for i := range unique {
+		assign(i, make([]bool, len(a.Clauses)))
+	}
+
+	outstanding := []ConsoleOutstandingAuthorisation{}
+	for j, clause := range a.Clauses {
+		if given[j] < clause.AuthorisationsRequired {
+			outstanding = append(outstanding, ConsoleOutstandingAuthorisation{
+				Name:                   clause.Name,
+				AuthorisationsRequired: clause.AuthorisationsRequired,
+				AuthorisationsGiven:    given[j],
+			})
+		}
+	}
+
+	return outstanding, nil
+}
+
+// UnresolvableSubject returns the first subject of the clauses that is neither
+// a native RBAC subject, which are resolved from the username and groups of
+// each authoriser, nor of a kind that can be resolved according to resolvable,
+// e.g. a GoogleGroup when the Google directory isn't enabled. No authoriser
+// could ever match such a subject, so the clause could never be satisfied.
+func (a *ConsoleAuthorisers) UnresolvableSubject(resolvable func(kind string) bool) *rbacv1.Subject {
+	for _, clause := range a.Clauses {
+		for _, subject := range clause.Subjects {
+			if !subjectResolvable(subject, resolvable) {
+				return &subject
+			}
+		}
+	}
+
+	return nil
+}
+
+func subjectResolvable(subject rbacv1.Subject, resolvable func(kind string) bool) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind, rbacv1.GroupKind, rbacv1.ServiceAccountKind:
+		return true
+	}
+
+	return resolvable(subject.Kind)
+}
+
+// ConsoleContainerStatus returns the status of the console container in a
+// console's pod, or nil if it has none yet. The console container is always the
+// first container in the pod.
+func ConsoleContainerStatus(pod *corev1.Pod) *corev1.ContainerStatus {
+	if len(pod.Spec.Containers) == 0 {
+		return nil
+	}
+
+	for idx, status := range pod.Status.ContainerStatuses {
+		if status.Name == pod.Spec.Containers[0].Name {
+			return &pod.Status.ContainerStatuses[idx]
+		}
+	}
+
+	return nil
+}
+
+// ConsoleContainerTerminated returns the terminated state of the console
+// container in a console's pod, or nil if it has not terminated.
+func ConsoleContainerTerminated(pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	status := ConsoleContainerStatus(pod)
+	if status == nil {
+		return nil
+	}
+
+	return status.State.Terminated
+}
+
+// FailingCondition returns the first of the console's conditions, in the order
+// given by ConsoleConditionTypes, that is not satisfied, or nil if they all
+// are.
+func (s *ConsoleStatus) FailingCondition() *metav1.Condition {
+	for _, conditionType := range ConsoleConditionTypes {
+		condition := meta.FindStatusCondition(s.Conditions, conditionType)
+		if condition != nil && condition.Status != metav1.ConditionTrue {
+			return condition
+		}
+	}
+
+	return nil
+}
+
 // GetDefaultCommandWithArgs returns a concatenated list of command and
 // arguments, if defined on the template
 func (ct *ConsoleTemplate) GetDefaultCommandWithArgs() ([]string, error) {
@@ -119,30 +530,46 @@ func (ct *ConsoleTemplate) GetDefaultCommandWithArgs() ([]string, error) {
 // authorisation rule if one is defined.
 //
 // The `matchCommandElements` field, within an AuthorisationRule, is an array
-// of matchers, of which there are 3 supported types:
+// of matchers, of which there are these types:
 //
 //  1. `*`  - a wildcard that matches the presence of an element.
 //  2. `**` - a wildcard that matches any number (including 0) of
-//     elements. This can only be used at the end of the array.
-//  3. Any other string of characters, this is used to perform an exact
-//     string match against the current element.
+//     elements, anywhere in the array.
+//  3. `re:<regexp>` - a regular expression that must match the whole element.
+//  4. `glob:<pattern>` - a glob, in which `*` doesn't match `/`.
+//  5. `flag:<flag>` - an exact match, where consecutive flag matchers match
+//     their elements in any order.
+//  6. `exact:<string>`, or any other string of characters, this is used to
+//     perform an exact string match against the current element.
+//
+// Types 3 to 5, and the `exact:` prefix, are only interpreted in rules whose
+// matcherSyntax is Typed. Otherwise those elements are matched exactly.
 //
 // The elements of the command array are evaluated in order; any failure to
 // match will result in falling back to the next rule.
 //
 // Examples:
 //
-// | Matcher               | Command                          | Matches? |
-// | --------------------- | -------------------------------- | -------- |
-// | ["bash"]              | ["bash"]                         | Yes      |
-// | ["ls", "*"]           | ["ls"]                           | No       |
-// | ["ls", "*"]           | ["ls", "file"]                   | Yes      |
-// | ["ls", "*", "file2"]  | ["ls", "file", "file3", "file2"] | No       |
-// | ["ls", "*", "file2"]  | ["ls", "file", "file2"]          | Yes      |
-// | ["echo", "**"]        | ["echo"]                         | Yes      |
-// | ["echo", "**"]        | ["echo", "hello"]                | Yes      |
-// | ["echo", "**"]        | ["echo", "hi", "bye" ]           | Yes      |
-// | ["echo", "**", "bye"] | ["echo", "hi", "bye" ]           | Error    |
+// | Matcher                                 | Command                                | Matches? |
+// | --------------------------------------- | -------------------------------------- | -------- |
+// | ["bash"]                                | ["bash"]                               | Yes      |
+// | ["ls", "*"]                             | ["ls"]                                 | No       |
+// | ["ls", "*"]                             | ["ls", "file"]                         | Yes      |
+// | ["ls", "*", "file2"]                    | ["ls", "file", "file3", "file2"]       | No       |
+// | ["ls", "*", "file2"]                    | ["ls", "file", "file2"]                | Yes      |
+// | ["echo", "**"]                          | ["echo"]                               | Yes      |
+// | ["echo", "**"]                          | ["echo", "hello"]                      | Yes      |
+// | ["echo", "**"]                          | ["echo", "hi", "bye" ]                 | Yes      |
+// | ["echo", "**", "bye"]                   | ["echo", "hi", "bye" ]                 | Yes      |
+//
+// With matcherSyntax Typed:
+//
+// | Matcher                                 | Command                                | Matches? |
+// | --------------------------------------- | -------------------------------------- | -------- |
+// | ["rails", "runner", "glob:scripts/*.rb"]| ["rails", "runner", "scripts/a.rb"]    | Yes      |
+// | ["rails", "runner", "glob:scripts/*.rb"]| ["rails", "runner", "scripts/a/b.rb"]  | No       |
+// | ["rake", "re:db:(migrate|rollback)"]    | ["rake", "db:rollback"]                | Yes      |
+// | ["rake", "flag:-t", "flag:-n", "*"]     | ["rake", "-n", "-t", "db:migrate"]     | Yes      |
 func (ct *ConsoleTemplate) GetAuthorisationRuleForCommand(command []string) (ConsoleAuthorisationRule, error) {
 	// We expect that the Validate() function will already have been called
 	// before this, via the webhook that validates console templates. However,
@@ -153,49 +580,15 @@ func (ct *ConsoleTemplate) GetAuthorisationRuleForCommand(command []string) (Con
 		return ConsoleAuthorisationRule{}, err
 	}
 
-matchRule:
 	for _, rule := range ct.Spec.AuthorisationRules {
-		numMatchers := len(rule.MatchCommandElements)
-
-		// Assert that the command provided matches the number of elements defined
-		// in the matchers array, but if the last matcher is '**' then the last
-		// element of the command is optional as well as anything following it.
-		if rule.MatchCommandElements[numMatchers-1] == "**" {
-			if len(command) < numMatchers-1 {
-				continue matchRule
-			}
-		} else {
-			if len(command) != numMatchers {
-				continue matchRule
-			}
+		matchers, err := compileCommandMatchers(rule.MatchCommandElements, rule.MatcherSyntax)
+		if err != nil {
+			return ConsoleAuthorisationRule{}, err
 		}
 
-		for i, matcher := range rule.MatchCommandElements {
-			switch matcher {
-			case "*":
-				// We have already validated that there is an element of the command
-				// array at this position.
-				continue
-
-			case "**":
-				// 'Exit early', because we want to match on anything (or nothing)
-				// subsequent to this.
-				return rule, nil
-
-			default:
-				// Treat everything else as an exact string match.
-				if command[i] == matcher {
-					continue
-				}
-			}
-
-			// If we didn't match anything for this element then move onto the next rule
-			continue matchRule
+		if matchCommand(matchers, command) {
+			return rule, nil
 		}
-
-		// If we're at the end of this rule and we haven't broken out or returned
-		// then we've fully matched the command.
-		return rule, nil
 	}
 
 	if ct.Spec.DefaultAuthorisationRule != nil {
@@ -210,12 +603,130 @@ matchRule:
 	return ConsoleAuthorisationRule{}, errors.New("no rules matched the command")
 }
 
+// AllowsCommand returns an error if the template restricts the commands that
+// consoles can run and the command doesn't match any of its authorisation
+// rules. The error lists the patterns of the commands that are allowed.
+func (ct *ConsoleTemplate) AllowsCommand(command []string) error {
+	if !ct.Spec.RestrictCommands {
+		return nil
+	}
+
+	if err := ct.Validate(); err != nil {
+		return err
+	}
+
+	// A template that restricts commands has no default authorisation rule, so
+	// this only succeeds if one of the rules matched.
+	if _, err := ct.GetAuthorisationRuleForCommand(command); err == nil {
+		return nil
+	}
+
+	allowed := []string{}
+	for _, rule := range ct.Spec.AuthorisationRules {
+		elements := []string{}
+		for _, element := range rule.MatchCommandElements {
+			elements = append(elements, strconv.Quote(element))
+		}
+		allowed = append(allowed, fmt.Sprintf("[%s]", strings.Join(elements, ", ")))
+	}
+
+	return errors.Errorf(
+		"command %q is not allowed by console template %s, which only allows commands matching: %s",
+		strings.Join(command, " "), ct.Name, strings.Join(allowed, ", "),
+	)
+}
+
 // HasAuthorisationRules defines whether a console template has authorisation
 // rules defined on it.
 func (ct *ConsoleTemplate) HasAuthorisationRules() bool {
 	return len(ct.Spec.AuthorisationRules) > 0 || ct.Spec.DefaultAuthorisationRule != nil
 }
 
+// HasConcurrencyLimits defines whether a console template limits the number of
+// consoles that can run at once.
+func (ct *ConsoleTemplate) HasConcurrencyLimits() bool {
+	return ct.Spec.MaxConcurrentConsoles != nil || ct.Spec.MaxConcurrentConsolesPerUser != nil
+}
+
+// ConcurrencyLimitMessage returns a message explaining why the console must be
+// queued due to the concurrency limits of the template, or an empty string if
+// the console is free to start.
+//
+// The given consoles should include all consoles in the template's namespace.
+// Consoles created from the template count towards the limits if they are
+// running or about to run, or if they were queued before this console, so
+// that queued consoles are started in the order they were created. Consoles
+// named in started, which have a job that hasn't finished, count as running
+// even if their status hasn't caught up with their job yet.
+func (ct *ConsoleTemplate) ConcurrencyLimitMessage(csl *Console, consoles []Console, started map[string]bool) string {
+	var (
+		active       int
+		activeByUser = map[string]int{}
+		queued       []Console
+	)
+
+	for _, other := range consoles {
+		if other.Name == csl.Name || other.Spec.ConsoleTemplateRef.Name != ct.Name {
+			continue
+		}
+
+		switch {
+		case started[other.Name], other.Pending(), other.Running():
+			active++
+			activeByUser[other.Spec.User]++
+		case other.Queued() && queuedBefore(&other, csl):
+			queued = append(queued, other)
+		}
+	}
+
+	perUser := ct.Spec.MaxConcurrentConsolesPerUser
+	if perUser != nil {
+		count := activeByUser[csl.Spec.User]
+		for _, other := range queued {
+			if other.Spec.User == csl.Spec.User {
+				count++
+			}
+		}
+
+		if count >= int(*perUser) {
+			return fmt.Sprintf(
+				"Queued: %s has %d consoles from template %s running or queued ahead, the maximum per user is %d",
+				csl.Spec.User, count, ct.Name, *perUser,
+			)
+		}
+	}
+
+	if ct.Spec.MaxConcurrentConsoles != nil {
+		// Consoles queued ahead of this one take priority, unless they are held
+		// back by the per-user limit, in which case they can be overtaken.
+		count := active
+		for _, other := range queued {
+			if perUser == nil || activeByUser[other.Spec.User] < int(*perUser) {
+				count++
+			}
+		}
+
+		if count >= int(*ct.Spec.MaxConcurrentConsoles) {
+			return fmt.Sprintf(
+				"Queued: %d consoles from template %s are running or queued ahead, the maximum is %d",
+				count, ct.Name, *ct.Spec.MaxConcurrentConsoles,
+			)
+		}
+	}
+
+	return ""
+}
+
+// queuedBefore returns whether a console was created before another, using the
+// name to break ties between consoles created in the same second.
+func queuedBefore(a, b *Console) bool {
+	if a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.Name < b.Name
+	}
+
+	return a.CreationTimestamp.Before(&b.CreationTimestamp)
+}
+
 // Validate checks the console template object for correctness and returns a
 // list of errors.
 func (ct *ConsoleTemplate) Validate() error {
@@ -223,27 +734,41 @@ func (ct *ConsoleTemplate) Validate() error {
 
 	for i, rule := range ct.Spec.AuthorisationRules {
 		for j, element := range rule.MatchCommandElements {
-			switch element {
-			case "":
+			if _, matcherErr := parseCommandMatcher(element, rule.MatcherSyntax); matcherErr != nil {
 				err = multierror.Append(err, errors.Errorf(
-					".spec.authorisationRules[%d].matchCommandElements[%d]: an empty matcher is invalid",
-					i, j,
+					".spec.authorisationRules[%d].matchCommandElements[%d]: %s",
+					i, j, matcherErr,
 				))
-
-			case "**":
-				// By only supporting double wildcards at the end we keep the logic
-				// simple, as there's no need to backtrack.
-				if (j + 1) < len(rule.MatchCommandElements) {
-					err = multierror.Append(err, errors.Errorf(
-						".spec.authorisationRules[%d].matchCommandElements[%d]: a double wildcard is only valid at the end of the pattern",
-						i, j,
-					))
-				}
 			}
 		}
 	}
 
-	if len(ct.Spec.AuthorisationRules) > 0 && ct.Spec.DefaultAuthorisationRule == nil {
+	for i, rule := range ct.Spec.AuthorisationRules {
+		err = validateAuthorisers(err, fmt.Sprintf(".spec.authorisationRules[%d]", i), rule.ConsoleAuthorisers)
+	}
+	if ct.Spec.DefaultAuthorisationRule != nil {
+		err = validateAuthorisers(err, ".spec.defaultAuthorisationRule", *ct.Spec.DefaultAuthorisationRule)
+	}
+
+	if ct.Spec.MaxConcurrentConsoles != nil && ct.Spec.MaxConcurrentConsolesPerUser != nil &&
+		*ct.Spec.MaxConcurrentConsolesPerUser > *ct.Spec.MaxConcurrentConsoles {
+		err = multierror.Append(err, errors.New(
+			".spec.maxConcurrentConsolesPerUser must not exceed .spec.maxConcurrentConsoles",
+		))
+	}
+
+	if ct.Spec.RestrictCommands {
+		if len(ct.Spec.AuthorisationRules) == 0 {
+			err = multierror.Append(err, errors.New(
+				".spec.authorisationRules must be set if commands are restricted",
+			))
+		}
+		if ct.Spec.DefaultAuthorisationRule != nil {
+			err = multierror.Append(err, errors.New(
+				".spec.defaultAuthorisationRule must not be set if commands are restricted, as it would never apply",
+			))
+		}
+	} else if len(ct.Spec.AuthorisationRules) > 0 && ct.Spec.DefaultAuthorisationRule == nil {
 		err = multierror.Append(err, errors.New(
 			".spec.defaultAuthorisationRule must be set if authorisation rules are defined",
 		))
@@ -251,3 +776,71 @@ func (ct *ConsoleTemplate) Validate() error {
 
 	return err
 }
+
+// validateAuthorisers appends any problems with the clauses of an authorisation
+// rule to the given error.
+func validateAuthorisers(err error, field string, authorisers ConsoleAuthorisers) error {
+	required := 0
+	names := map[string]bool{}
+	for i, clause := range authorisers.Clauses {
+		required += clause.AuthorisationsRequired
+
+		if names[clause.Name] {
+			err = multierror.Append(err, errors.Errorf(
+				"%s.clauses[%d]: the name %q is used by more than one clause", field, i, clause.Name,
+			))
+		}
+		names[clause.Name] = true
+
+		if clause.AuthorisationsRequired < 1 {
+			err = multierror.Append(err, errors.Errorf(
+				"%s.clauses[%d]: a clause must require at least one authorisation", field, i,
+			))
+		}
+		if len(clause.Subjects) == 0 {
+			err = multierror.Append(err, errors.Errorf(
+				"%s.clauses[%d]: a clause must have at least one subject", field, i,
+			))
+		}
+	}
+
+	if required > authorisers.AuthorisationsRequired {
+		err = multierror.Append(err, errors.Errorf(
+			"%s.authorisationsRequired must be at least %d, the total required by its clauses", field, required,
+		))
+	}
+
+	return err
+}
+
+// ValidateSubjectKinds checks that every subject named by the clauses of the
+// template's authorisation rules can be resolved, according to resolvable.
+// Unlike Validate, this depends on how the workloads manager is run, such as
+// whether the Google directory is enabled.
+func (ct *ConsoleTemplate) ValidateSubjectKinds(resolvable func(kind string) bool) error {
+	var err error
+
+	for i, rule := range ct.Spec.AuthorisationRules {
+		err = validateSubjectKinds(err, fmt.Sprintf(".spec.authorisationRules[%d]", i), rule.ConsoleAuthorisers, resolvable)
+	}
+	if ct.Spec.DefaultAuthorisationRule != nil {
+		err = validateSubjectKinds(err, ".spec.defaultAuthorisationRule", *ct.Spec.DefaultAuthorisationRule, resolvable)
+	}
+
+	return err
+}
+
+func validateSubjectKinds(err error, field string, authorisers ConsoleAuthorisers, resolvable func(kind string) bool) error {
+	for i, clause := range authorisers.Clauses {
+		for j, subject := range clause.Subjects {
+			if !subjectResolvable(subject, resolvable) {
+				err = multierror.Append(err, errors.Errorf(
+					"%s.clauses[%d].subjects[%d]: the members of %s subjects can't be resolved by the workloads manager",
+					field, i, j, subject.Kind,
+				))
+			}
+		}
+	}
+
+	return err
+}
@@ -1,8 +1,15 @@
 package v1alpha1
 
 import (
+	"errors"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Helpers", func() {
@@ -272,6 +279,90 @@ var _ = Describe("Helpers", func() {
 			})
 		})
 
+		Context("with typed matchers", func() {
+			BeforeEach(func() {
+				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
+					{Name: "scripts", MatchCommandElements: []string{"rails", "runner", "glob:scripts/*.rb"}},
+					{Name: "migrations", MatchCommandElements: []string{"rake", "re:db:(migrate|rollback)"}},
+					{Name: "dry-run", MatchCommandElements: []string{"rake", "flag:--trace", "flag:--dry-run", "*"}},
+					{Name: "env", MatchCommandElements: []string{"env", "**", "exact:*", "**"}},
+					{Name: "task", MatchCommandElements: []string{"rake", "db:seed"}},
+				}
+				for i := range template.Spec.AuthorisationRules {
+					template.Spec.AuthorisationRules[i].MatcherSyntax = CommandMatcherSyntaxTyped
+				}
+			})
+
+			It("matches each element by its type", func() {
+				for expected, commands := range map[string][][]string{
+					"scripts":    {{"rails", "runner", "scripts/backfill.rb"}},
+					"migrations": {{"rake", "db:migrate"}, {"rake", "db:rollback"}},
+					"dry-run":    {{"rake", "--trace", "--dry-run", "db:seed"}, {"rake", "--dry-run", "--trace", "db:seed"}},
+					"env":        {{"env", "*"}, {"env", "A=1", "*", "B=2"}},
+					"task":       {{"rake", "db:seed"}},
+					"default": {
+						{"rails", "runner", "scripts/nested/backfill.rb"},
+						{"rails", "runner", "scripts/backfill.rb", "--force"},
+						{"rake", "db:migrate:reset"},
+						{"rake", "--dry-run", "db:seed"},
+						{"rake", "--dry-run", "--dry-run", "db:seed"},
+						{"env", "A=1"},
+					},
+				} {
+					for _, command := range commands {
+						rule, err := template.GetAuthorisationRuleForCommand(command)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(rule.Name).To(Equal(expected), "%v", command)
+					}
+				}
+			})
+		})
+
+		Context("with typed matcher prefixes in a rule with the literal syntax", func() {
+			BeforeEach(func() {
+				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
+					{Name: "literal", MatchCommandElements: []string{"rake", "re:db:(migrate|rollback)", "glob:[a-", "flag:"}},
+				}
+			})
+
+			It("matches the elements exactly", func() {
+				rule, err := template.GetAuthorisationRuleForCommand([]string{"rake", "re:db:(migrate|rollback)", "glob:[a-", "flag:"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rule.Name).To(Equal("literal"))
+
+				rule, err = template.GetAuthorisationRuleForCommand([]string{"rake", "db:migrate", "b", "--trace"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rule.Name).To(Equal("default"))
+			})
+		})
+
+		Context("with a double wildcard in the middle of the pattern", func() {
+			BeforeEach(func() {
+				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
+					{
+						Name:                 "rails",
+						MatchCommandElements: []string{"rails", "**", "--sandbox"},
+					},
+				}
+				command = []string{"rails", "console", "-e", "production", "--sandbox"}
+			})
+
+			It("matches any number of elements before the rest of the pattern", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Name).To(Equal("rails"))
+			})
+
+			Context("with a command that doesn't end with the rest of the pattern", func() {
+				BeforeEach(func() {
+					command = []string{"rails", "--sandbox", "console"}
+				})
+
+				It("returns the default rule", func() {
+					Expect(result.AuthorisationsRequired).To(Equal(defaultRuleAuths))
+				})
+			})
+		})
+
 		Context("with a matching rule that isn't the first or last match", func() {
 			BeforeEach(func() {
 				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
@@ -338,19 +429,45 @@ var _ = Describe("Helpers", func() {
 
 		Context("with a rule that contains double wildcards in the middle of a pattern", func() {
 			BeforeEach(func() {
+				template.Spec.DefaultAuthorisationRule = &ConsoleAuthorisers{}
 				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
 					{
-						MatchCommandElements: []string{"bash"},
+						MatchCommandElements: []string{"rails", "**", "other-stuff", "**"},
 					},
+				}
+			})
+
+			It("doesn't return an error", func() {
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("with invalid typed matchers", func() {
+			BeforeEach(func() {
+				template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
 					{
-						MatchCommandElements: []string{"rails", "**", "other-stuff"},
+						MatchCommandElements: []string{"rake", "re:db:(migrate", "glob:[a-", "flag:"},
+						MatcherSyntax:        CommandMatcherSyntaxTyped,
 					},
 				}
 			})
 
+			It("returns an error for each bad pattern", func() {
+				Expect(err).To(MatchError(ContainSubstring(".spec.authorisationRules[0].matchCommandElements[1]: invalid regular expression")))
+				Expect(err).To(MatchError(ContainSubstring(".spec.authorisationRules[0].matchCommandElements[2]: invalid glob")))
+				Expect(err).To(MatchError(ContainSubstring(".spec.authorisationRules[0].matchCommandElements[3]: a flag matcher must have a pattern")))
+			})
+		})
+
+		Context("with a per-user concurrency limit above the global limit", func() {
+			BeforeEach(func() {
+				global, perUser := int32(2), int32(3)
+				template.Spec.MaxConcurrentConsoles = &global
+				template.Spec.MaxConcurrentConsolesPerUser = &perUser
+			})
+
 			It("returns an error", func() {
-				Expect(err).To(HaveOccurred())
-				Expect(err).To(MatchError(ContainSubstring(".spec.authorisationRules[1].matchCommandElements[1]: a double wildcard is only valid at the end of the pattern")))
+				Expect(err).To(MatchError(ContainSubstring(".spec.maxConcurrentConsolesPerUser must not exceed .spec.maxConcurrentConsoles")))
 			})
 		})
 
@@ -368,5 +485,788 @@ var _ = Describe("Helpers", func() {
 				Expect(err).To(MatchError(ContainSubstring(".spec.defaultAuthorisationRule must be set if authorisation rules are defined")))
 			})
 		})
+
+		Context("with commands restricted", func() {
+			BeforeEach(func() {
+				template.Spec.RestrictCommands = true
+			})
+
+			It("requires authorisation rules", func() {
+				Expect(err).To(MatchError(ContainSubstring(".spec.authorisationRules must be set if commands are restricted")))
+			})
+
+			Context("and authorisation rules without a default rule", func() {
+				BeforeEach(func() {
+					template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
+						{
+							MatchCommandElements: []string{"bash"},
+						},
+					}
+				})
+
+				It("doesn't return an error", func() {
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("and a default rule", func() {
+				BeforeEach(func() {
+					template.Spec.AuthorisationRules = []ConsoleAuthorisationRule{
+						{
+							MatchCommandElements: []string{"bash"},
+						},
+					}
+					template.Spec.DefaultAuthorisationRule = &ConsoleAuthorisers{}
+				})
+
+				It("returns an error", func() {
+					Expect(err).To(MatchError(ContainSubstring(".spec.defaultAuthorisationRule must not be set if commands are restricted")))
+				})
+			})
+		})
+
+		Context("with clauses requiring more authorisations than the rule", func() {
+			BeforeEach(func() {
+				template.Spec.DefaultAuthorisationRule = &ConsoleAuthorisers{
+					AuthorisationsRequired: 1,
+					Clauses: []ConsoleAuthoriserClause{
+						{Name: "sre", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{{Kind: "GoogleGroup", Name: "sre@example.com"}}},
+						{Name: "sre", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{{Kind: "GoogleGroup", Name: "leads@example.com"}}},
+					},
+				}
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(".spec.defaultAuthorisationRule.authorisationsRequired must be at least 2, the total required by its clauses")))
+			})
+
+			It("rejects clauses with the same name", func() {
+				Expect(err).To(MatchError(ContainSubstring(`.spec.defaultAuthorisationRule.clauses[1]: the name "sre" is used by more than one clause`)))
+			})
+		})
+	})
+
+	Describe("ConsoleTemplate ValidateSubjectKinds", func() {
+		var template ConsoleTemplate
+
+		googleOnly := func(kind string) bool { return kind == "GoogleGroup" }
+
+		BeforeEach(func() {
+			template = ConsoleTemplate{
+				Spec: ConsoleTemplateSpec{
+					AuthorisationRules: []ConsoleAuthorisationRule{
+						{
+							MatchCommandElements: []string{"bash"},
+							ConsoleAuthorisers: ConsoleAuthorisers{
+								AuthorisationsRequired: 2,
+								Clauses: []ConsoleAuthoriserClause{
+									{Name: "sre", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{
+										{Kind: "GoogleGroup", Name: "sre@example.com"},
+										{Kind: "Group", Name: "sre"},
+										{Kind: "User", Name: "alice@example.com"},
+										{Kind: "ServiceAccount", Namespace: "ci", Name: "deployer"},
+									}},
+								},
+							},
+						},
+					},
+				},
+			}
+		})
+
+		It("accepts native subjects and kinds that can be resolved", func() {
+			Expect(template.ValidateSubjectKinds(googleOnly)).To(Succeed())
+		})
+
+		Context("with a clause naming a kind that can't be resolved", func() {
+			BeforeEach(func() {
+				template.Spec.DefaultAuthorisationRule = &ConsoleAuthorisers{
+					AuthorisationsRequired: 1,
+					Clauses: []ConsoleAuthoriserClause{
+						{Name: "leads", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{
+							{Kind: "User", Name: "alice@example.com"},
+							{Kind: "OktaGroup", Name: "leads@example.com"},
+						}},
+					},
+				}
+			})
+
+			It("returns an error for the subject", func() {
+				Expect(template.ValidateSubjectKinds(googleOnly)).To(MatchError(ContainSubstring(
+					".spec.defaultAuthorisationRule.clauses[0].subjects[1]: the members of OktaGroup subjects can't be resolved by the workloads manager",
+				)))
+			})
+
+			It("is returned by UnresolvableSubject", func() {
+				Expect(template.Spec.AuthorisationRules[0].UnresolvableSubject(googleOnly)).To(BeNil())
+				Expect(template.Spec.DefaultAuthorisationRule.UnresolvableSubject(googleOnly)).To(Equal(
+					&rbacv1.Subject{Kind: "OktaGroup", Name: "leads@example.com"},
+				))
+			})
+		})
+	})
+
+	Describe("ConsoleAuthorisers OutstandingClauses", func() {
+		var (
+			authorisers ConsoleAuthorisers
+			given       []rbacv1.Subject
+			outstanding []ConsoleOutstandingAuthorisation
+			err         error
+		)
+
+		user := func(name string) rbacv1.Subject {
+			return rbacv1.Subject{Kind: "User", Name: name}
+		}
+		group := func(name string) rbacv1.Subject {
+			return rbacv1.Subject{Kind: "GoogleGroup", Name: name}
+		}
+
+		groups := map[string][]string{
+			"sre@example.com":      {"alice@example.com", "bob@example.com", "carol@example.com"},
+			"payments@example.com": {"carol@example.com", "dave@example.com"},
+		}
+		matchGroups := func(authoriser, subject rbacv1.Subject) (bool, error) {
+			if subject.Kind != "GoogleGroup" {
+				return MatchSubject(authoriser, subject)
+			}
+			for _, member := range groups[subject.Name] {
+				if member == authoriser.Name {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+
+		BeforeEach(func() {
+			authorisers = ConsoleAuthorisers{
+				AuthorisationsRequired: 2,
+				Clauses: []ConsoleAuthoriserClause{
+					{Name: "sre", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{group("sre@example.com")}},
+					{Name: "payments", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{group("payments@example.com")}},
+				},
+			}
+			given = []rbacv1.Subject{}
+		})
+
+		JustBeforeEach(func() {
+			outstanding, err = authorisers.OutstandingClauses(given, matchGroups)
+		})
+
+		It("returns every clause when there are no authorisations", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outstanding).To(Equal([]ConsoleOutstandingAuthorisation{
+				{Name: "sre", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+				{Name: "payments", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+			}))
+		})
+
+		Context("with two authorisations from the same group", func() {
+			BeforeEach(func() {
+				given = []rbacv1.Subject{user("alice@example.com"), user("bob@example.com")}
+			})
+
+			It("only satisfies that group's clause", func() {
+				Expect(outstanding).To(Equal([]ConsoleOutstandingAuthorisation{
+					{Name: "payments", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+				}))
+			})
+		})
+
+		Context("with an authoriser in both groups", func() {
+			BeforeEach(func() {
+				given = []rbacv1.Subject{user("carol@example.com")}
+			})
+
+			It("counts them towards only one clause", func() {
+				Expect(outstanding).To(HaveLen(1))
+			})
+
+			Context("and an authoriser only in the group they were counted towards", func() {
+				BeforeEach(func() {
+					given = append(given, user("alice@example.com"))
+				})
+
+				It("moves them to the other clause", func() {
+					Expect(outstanding).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("with the same authoriser given twice", func() {
+			BeforeEach(func() {
+				authorisers.Clauses[0].AuthorisationsRequired = 2
+				given = []rbacv1.Subject{user("alice@example.com"), user("alice@example.com")}
+			})
+
+			It("counts them once", func() {
+				Expect(outstanding).To(ContainElement(
+					ConsoleOutstandingAuthorisation{Name: "sre", AuthorisationsRequired: 2, AuthorisationsGiven: 1},
+				))
+			})
+		})
+
+		Context("with subjects named directly", func() {
+			BeforeEach(func() {
+				authorisers.Clauses[1].Subjects = []rbacv1.Subject{user("erin@example.com")}
+				given = []rbacv1.Subject{user("erin@example.com"), user("alice@example.com")}
+			})
+
+			It("matches them exactly", func() {
+				Expect(outstanding).To(BeEmpty())
+			})
+		})
+
+		Context("when membership can't be determined", func() {
+			BeforeEach(func() {
+				given = []rbacv1.Subject{user("alice@example.com")}
+			})
+
+			It("returns the error", func() {
+				_, err := authorisers.OutstandingClauses(given, func(_, _ rbacv1.Subject) (bool, error) {
+					return false, errors.New("directory unavailable")
+				})
+				Expect(err).To(MatchError("directory unavailable"))
+			})
+		})
+
+		Context("without clauses", func() {
+			BeforeEach(func() {
+				authorisers.Clauses = nil
+			})
+
+			It("returns nothing", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(outstanding).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("MatchSubject", func() {
+		It("matches a service account by the username its token authenticates as", func() {
+			Expect(MatchSubject(
+				rbacv1.Subject{Kind: "User", Name: "system:serviceaccount:deploys:release-bot"},
+				rbacv1.Subject{Kind: "ServiceAccount", Name: "release-bot", Namespace: "deploys"},
+			)).To(BeTrue())
+		})
+
+		It("doesn't match a service account in another namespace", func() {
+			Expect(MatchSubject(
+				rbacv1.Subject{Kind: "User", Name: "system:serviceaccount:staging:release-bot"},
+				rbacv1.Subject{Kind: "ServiceAccount", Name: "release-bot", Namespace: "deploys"},
+			)).To(BeFalse())
+		})
+	})
+
+	Describe("ConsoleAuthorisation MatchGroups", func() {
+		var matches SubjectMatcher
+
+		BeforeEach(func() {
+			auth := ConsoleAuthorisation{
+				Spec: ConsoleAuthorisationSpec{
+					Authorisations: []ConsoleAuthorisationEntry{
+						{Subject: rbacv1.Subject{Kind: "User", Name: "alice@example.com"}, Groups: []string{"payments-leads"}},
+						{Subject: rbacv1.Subject{Kind: "User", Name: "bob@example.com"}},
+					},
+				},
+			}
+			matches = auth.MatchGroups(MatchSubject)
+		})
+
+		It("matches authorisers in the group when they authorised", func() {
+			Expect(matches(
+				rbacv1.Subject{Kind: "User", Name: "alice@example.com"},
+				rbacv1.Subject{Kind: "Group", Name: "payments-leads"},
+			)).To(BeTrue())
+		})
+
+		It("doesn't match authorisers outside the group", func() {
+			Expect(matches(
+				rbacv1.Subject{Kind: "User", Name: "bob@example.com"},
+				rbacv1.Subject{Kind: "Group", Name: "payments-leads"},
+			)).To(BeFalse())
+		})
+
+		It("defers to the given matcher for other subjects", func() {
+			Expect(matches(
+				rbacv1.Subject{Kind: "User", Name: "bob@example.com"},
+				rbacv1.Subject{Kind: "User", Name: "bob@example.com"},
+			)).To(BeTrue())
+		})
+	})
+
+	Describe("ConsoleAuthorisers AuthoriserSubjects", func() {
+		It("includes the subjects of each clause once", func() {
+			authorisers := ConsoleAuthorisers{
+				Subjects: []rbacv1.Subject{{Kind: "User", Name: "alice@example.com"}},
+				Clauses: []ConsoleAuthoriserClause{
+					{Name: "sre", Subjects: []rbacv1.Subject{{Kind: "GoogleGroup", Name: "sre@example.com"}}},
+					{Name: "admins", Subjects: []rbacv1.Subject{{Kind: "User", Name: "alice@example.com"}}},
+				},
+			}
+
+			Expect(authorisers.AuthoriserSubjects()).To(Equal([]rbacv1.Subject{
+				{Kind: "User", Name: "alice@example.com"},
+				{Kind: "GoogleGroup", Name: "sre@example.com"},
+			}))
+		})
+	})
+
+	Describe("Console TimeoutSecondsWithExtensions", func() {
+		var (
+			// Inputs
+			console  Console
+			template ConsoleTemplate
+			rule     *ConsoleAuthorisationRule
+			auth     *ConsoleAuthorisation
+
+			// Outputs
+			result int
+		)
+
+		BeforeEach(func() {
+			console = Console{
+				Spec: ConsoleSpec{
+					TimeoutSeconds: 600,
+					TimeoutExtensions: []ConsoleTimeoutExtension{
+						{Seconds: 300},
+						{Seconds: 60},
+					},
+				},
+			}
+			template = ConsoleTemplate{
+				Spec: ConsoleTemplateSpec{
+					MaxTimeoutSeconds: 3600,
+				},
+			}
+			rule = &ConsoleAuthorisationRule{
+				ConsoleAuthorisers: ConsoleAuthorisers{
+					AuthorisationsRequired: 1,
+				},
+			}
+			auth = &ConsoleAuthorisation{}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			result, err = console.TimeoutSecondsWithExtensions(&template, rule, auth, MatchSubject)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when extensions do not require authorisation", func() {
+			It("adds all extensions to the timeout", func() {
+				Expect(result).To(Equal(960))
+			})
+
+			Context("and the extensions exceed the template maximum", func() {
+				BeforeEach(func() {
+					template.Spec.MaxTimeoutSeconds = 900
+				})
+
+				It("clamps the timeout to the template maximum", func() {
+					Expect(result).To(Equal(900))
+				})
+			})
+		})
+
+		Context("when extensions require authorisation", func() {
+			BeforeEach(func() {
+				template.Spec.TimeoutExtensionsRequireAuthorisation = true
+			})
+
+			It("ignores unauthorised extensions", func() {
+				Expect(result).To(Equal(600))
+			})
+
+			Context("and one extension is authorised", func() {
+				BeforeEach(func() {
+					auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+						{TimeoutExtension: 1, Subject: rbacv1.Subject{Kind: "User", Name: "authoriser"}},
+					}
+				})
+
+				It("adds only the authorised extension", func() {
+					Expect(result).To(Equal(660))
+				})
+			})
+
+			Context("and the same subject authorises an extension twice", func() {
+				BeforeEach(func() {
+					rule.AuthorisationsRequired = 2
+					auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+						{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "authoriser"}},
+						{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "authoriser"}},
+					}
+				})
+
+				It("counts the subject once", func() {
+					Expect(result).To(Equal(600))
+				})
+			})
+
+			Context("and the authorisers don't satisfy the rule's clauses", func() {
+				BeforeEach(func() {
+					rule.Clauses = []ConsoleAuthoriserClause{
+						{Name: "sre", AuthorisationsRequired: 1, Subjects: []rbacv1.Subject{{Kind: "User", Name: "sre"}}},
+					}
+					auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+						{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "authoriser"}},
+					}
+				})
+
+				It("ignores the extension", func() {
+					Expect(result).To(Equal(600))
+				})
+
+				Context("until an authoriser satisfying the clause authorises it", func() {
+					BeforeEach(func() {
+						auth.Spec.TimeoutExtensionAuthorisations = append(auth.Spec.TimeoutExtensionAuthorisations,
+							ConsoleTimeoutExtensionAuthorisation{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "sre"}},
+						)
+					})
+
+					It("adds the extension", func() {
+						Expect(result).To(Equal(900))
+					})
+				})
+			})
+
+			Context("and authorisations lapse", func() {
+				authorisedAt := func(name string, t time.Time) ConsoleTimeoutExtensionAuthorisation {
+					at := metav1.NewTime(t)
+					return ConsoleTimeoutExtensionAuthorisation{
+						TimeoutExtension: 0,
+						Subject:          rbacv1.Subject{Kind: "User", Name: name},
+						AuthorisedAt:     &at,
+					}
+				}
+
+				var start time.Time
+
+				BeforeEach(func() {
+					start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+					validity := int32(3600)
+					template.Spec.AuthorisationValiditySeconds = &validity
+					rule.AuthorisationsRequired = 2
+				})
+
+				Context("before enough authorisations were given", func() {
+					BeforeEach(func() {
+						auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+							authorisedAt("first", start),
+							authorisedAt("second", start.Add(2*time.Hour)),
+						}
+					})
+
+					It("ignores the extension", func() {
+						Expect(result).To(Equal(600))
+					})
+				})
+
+				Context("after enough authorisations were given", func() {
+					BeforeEach(func() {
+						auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+							authorisedAt("first", start),
+							authorisedAt("second", start.Add(30*time.Minute)),
+						}
+					})
+
+					It("adds the extension", func() {
+						Expect(result).To(Equal(900))
+					})
+				})
+
+				Context("with authorisations that have no time", func() {
+					BeforeEach(func() {
+						auth.Spec.TimeoutExtensionAuthorisations = []ConsoleTimeoutExtensionAuthorisation{
+							{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "first"}},
+							{TimeoutExtension: 0, Subject: rbacv1.Subject{Kind: "User", Name: "second"}},
+						}
+					})
+
+					It("ignores the extension", func() {
+						Expect(result).To(Equal(600))
+					})
+				})
+			})
+
+			Context("and the matching rule requires no authorisations", func() {
+				BeforeEach(func() {
+					rule.AuthorisationsRequired = 0
+				})
+
+				It("adds all extensions to the timeout", func() {
+					Expect(result).To(Equal(960))
+				})
+			})
+		})
+	})
+
+	Describe("ConsoleAuthorisation ValidAuthorisations", func() {
+		var (
+			now      time.Time
+			validity time.Duration
+			auth     ConsoleAuthorisation
+		)
+
+		authorisedAgo := func(name string, ago time.Duration) ConsoleAuthorisationEntry {
+			t := metav1.NewTime(now.Add(-ago))
+			return ConsoleAuthorisationEntry{
+				Subject:      rbacv1.Subject{Kind: "User", Name: name},
+				AuthorisedAt: &t,
+			}
+		}
+
+		BeforeEach(func() {
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			validity = time.Hour
+			auth = ConsoleAuthorisation{
+				Spec: ConsoleAuthorisationSpec{
+					Authorisations: []ConsoleAuthorisationEntry{
+						authorisedAgo("recent", 10*time.Minute),
+						authorisedAgo("older", 50*time.Minute),
+						authorisedAgo("lapsed", 2*time.Hour),
+						{Subject: rbacv1.Subject{Kind: "User", Name: "untimed"}},
+					},
+				},
+			}
+		})
+
+		It("discounts authorisations that have lapsed or have no time", func() {
+			valid := auth.ValidAuthorisations(validity, now)
+			Expect(valid).To(HaveLen(2))
+			Expect(valid[0].Name).To(Equal("recent"))
+			Expect(valid[1].Name).To(Equal("older"))
+		})
+
+		It("returns when the earliest valid authorisation lapses", func() {
+			Expect(auth.AuthorisationExpiryTime(validity, now)).To(
+				PointTo(Equal(now.Add(10 * time.Minute))),
+			)
+		})
+
+		Context("when authorisations never lapse", func() {
+			BeforeEach(func() {
+				validity = 0
+			})
+
+			It("returns all authorisations", func() {
+				Expect(auth.ValidAuthorisations(validity, now)).To(HaveLen(4))
+			})
+
+			It("returns no expiry time", func() {
+				Expect(auth.AuthorisationExpiryTime(validity, now)).To(BeNil())
+			})
+		})
+	})
+
+	Describe("ConsoleStatus FailingCondition", func() {
+		var status ConsoleStatus
+
+		BeforeEach(func() {
+			status = ConsoleStatus{
+				Conditions: []metav1.Condition{
+					{Type: ConsoleReadyCondition, Status: metav1.ConditionFalse, Reason: ReasonPodNotCreated},
+					{Type: ConsoleTemplateResolvedCondition, Status: metav1.ConditionTrue, Reason: ReasonTemplateFound},
+					{Type: ConsoleJobCreatedCondition, Status: metav1.ConditionFalse, Reason: ReasonQueued},
+				},
+			}
+		})
+
+		It("returns the earliest condition that is not satisfied", func() {
+			Expect(status.FailingCondition()).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Type":   Equal(ConsoleJobCreatedCondition),
+				"Reason": Equal(ReasonQueued),
+			})))
+		})
+
+		Context("when all conditions are satisfied", func() {
+			BeforeEach(func() {
+				for idx := range status.Conditions {
+					status.Conditions[idx].Status = metav1.ConditionTrue
+				}
+			})
+
+			It("returns nil", func() {
+				Expect(status.FailingCondition()).To(BeNil())
+			})
+		})
+	})
+
+	Describe("ConsoleTemplate AllowsCommand", func() {
+		var template ConsoleTemplate
+
+		BeforeEach(func() {
+			template = ConsoleTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "template"},
+				Spec: ConsoleTemplateSpec{
+					RestrictCommands: true,
+					AuthorisationRules: []ConsoleAuthorisationRule{
+						{
+							Name:                 "migrations",
+							MatchCommandElements: []string{"rake", "re:db:(migrate|rollback)"},
+							MatcherSyntax:        CommandMatcherSyntaxTyped,
+						},
+						{
+							Name:                 "scripts",
+							MatchCommandElements: []string{"bundle", "exec", "glob:scripts/*.rb", "**"},
+							MatcherSyntax:        CommandMatcherSyntaxTyped,
+						},
+					},
+				},
+			}
+		})
+
+		It("allows commands that match a rule", func() {
+			Expect(template.AllowsCommand([]string{"rake", "db:migrate"})).To(Succeed())
+			Expect(template.AllowsCommand([]string{"bundle", "exec", "scripts/backfill.rb", "--dry-run"})).To(Succeed())
+		})
+
+		It("rejects other commands with the allowed patterns", func() {
+			Expect(template.AllowsCommand([]string{"rails", "console"})).To(MatchError(
+				`command "rails console" is not allowed by console template template, which only allows commands matching: ` +
+					`["rake", "re:db:(migrate|rollback)"], ["bundle", "exec", "glob:scripts/*.rb", "**"]`,
+			))
+		})
+
+		Context("when commands aren't restricted", func() {
+			BeforeEach(func() {
+				template.Spec.RestrictCommands = false
+			})
+
+			It("allows any command", func() {
+				Expect(template.AllowsCommand([]string{"rails", "console"})).To(Succeed())
+			})
+		})
+	})
+
+	Describe("ConsoleTemplate ConcurrencyLimitMessage", func() {
+		var (
+			template ConsoleTemplate
+			csl      Console
+			consoles []Console
+			started  map[string]bool
+			now      time.Time
+		)
+
+		newConsole := func(name, user string, phase ConsolePhase, age time.Duration) Console {
+			return Console{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				},
+				Spec: ConsoleSpec{
+					User:               user,
+					ConsoleTemplateRef: corev1.LocalObjectReference{Name: "template"},
+				},
+				Status: ConsoleStatus{Phase: phase},
+			}
+		}
+
+		BeforeEach(func() {
+			now = time.Now()
+			global, perUser := int32(2), int32(1)
+			template = ConsoleTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "template"},
+				Spec: ConsoleTemplateSpec{
+					MaxConcurrentConsoles:        &global,
+					MaxConcurrentConsolesPerUser: &perUser,
+				},
+			}
+			csl = newConsole("mine", "alice", ConsolePendingAuthorisation, time.Minute)
+			consoles = []Console{csl}
+			started = map[string]bool{}
+		})
+
+		It("allows the console to start when nothing else is running", func() {
+			Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(BeEmpty())
+		})
+
+		Context("when the global limit is reached", func() {
+			BeforeEach(func() {
+				consoles = append(consoles,
+					newConsole("bob-1", "bob", ConsoleRunning, time.Hour),
+					newConsole("carol-1", "carol", ConsolePending, time.Hour),
+				)
+			})
+
+			It("queues the console", func() {
+				Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(
+					Equal("Queued: 2 consoles from template template are running or queued ahead, the maximum is 2"),
+				)
+			})
+		})
+
+		Context("when consoles have started jobs before their status shows it", func() {
+			BeforeEach(func() {
+				consoles = append(consoles,
+					newConsole("bob-1", "bob", ConsolePendingAuthorisation, time.Hour),
+					newConsole("carol-1", "carol", ConsolePendingAuthorisation, time.Hour),
+				)
+				started = map[string]bool{"bob-1": true, "carol-1": true}
+			})
+
+			It("counts them as running", func() {
+				Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(
+					Equal("Queued: 2 consoles from template template are running or queued ahead, the maximum is 2"),
+				)
+			})
+		})
+
+		Context("when the user has reached their limit", func() {
+			BeforeEach(func() {
+				consoles = append(consoles, newConsole("alice-1", "alice", ConsoleRunning, time.Hour))
+			})
+
+			It("queues the console", func() {
+				Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(
+					Equal("Queued: alice has 1 consoles from template template running or queued ahead, the maximum per user is 1"),
+				)
+			})
+		})
+
+		Context("when consoles were queued ahead", func() {
+			BeforeEach(func() {
+				consoles = append(consoles,
+					newConsole("bob-1", "bob", ConsoleRunning, time.Hour),
+					newConsole("carol-1", "carol", ConsoleQueued, 2*time.Minute),
+				)
+			})
+
+			It("queues the console behind them", func() {
+				Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).NotTo(BeEmpty())
+			})
+
+			Context("which are held back by the per-user limit", func() {
+				BeforeEach(func() {
+					consoles = append(consoles, newConsole("carol-2", "carol", ConsoleRunning, time.Hour))
+					template.Spec.MaxConcurrentConsoles = ptrInt32(3)
+				})
+
+				It("allows the console to overtake them", func() {
+					Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when other consoles have finished, were queued later or use another template", func() {
+			BeforeEach(func() {
+				other := newConsole("other", "bob", ConsoleRunning, time.Hour)
+				other.Spec.ConsoleTemplateRef.Name = "other-template"
+				consoles = append(consoles,
+					newConsole("alice-1", "alice", ConsoleStopped, time.Hour),
+					newConsole("bob-1", "bob", ConsoleQueued, time.Second),
+					newConsole("carol-1", "carol", ConsoleQueued, time.Second),
+					other,
+				)
+			})
+
+			It("allows the console to start", func() {
+				Expect(template.ConcurrencyLimitMessage(&csl, consoles, started)).To(BeEmpty())
+			})
+		})
 	})
 })
+
+func ptrInt32(i int32) *int32 {
+	return &i
+}
@@ -24,6 +24,7 @@ type ConsoleIdBuilder interface {
 type LifecycleEventRecorder interface {
 	ConsoleRequest(context.Context, *Console, *ConsoleAuthorisationRule) error
 	ConsoleAuthorise(context.Context, *Console, string) error
+	ConsoleReject(context.Context, *Console, string, string) error
 	ConsoleStart(context.Context, *Console, string) error
 	ConsoleAttach(context.Context, *Console, string, string) error
 	ConsoleTerminate(context.Context, *Console, bool, *corev1.Pod) error
@@ -158,6 +159,26 @@ func (l *lifecycleEventRecorderImpl) ConsoleAuthorise(ctx context.Context, csl *
 	return nil
 }
 
+func (l *lifecycleEventRecorderImpl) ConsoleReject(ctx context.Context, csl *Console, username string, reason string) error {
+	event := &events.ConsoleRejectEvent{
+		CommonEvent: l.makeConsoleCommonEvent(events.EventReject, csl),
+		Spec: events.ConsoleRejectSpec{
+			Username: username,
+			Reason:   reason,
+		},
+	}
+
+	id, err := l.publisher.Publish(ctx, event)
+	if err != nil {
+		lifecycleEventsPublishErrors.WithLabelValues("console_reject").Inc()
+		return err
+	}
+	lifecycleEventsPublish.WithLabelValues("console_reject").Inc()
+
+	l.logger.Info("event recorded", "id", id, "event", events.EventReject)
+	return nil
+}
+
 func (l *lifecycleEventRecorderImpl) ConsoleStart(ctx context.Context, csl *Console, jobName string) error {
 	event := &events.ConsoleStartEvent{
 		CommonEvent: l.makeConsoleCommonEvent(events.EventStart, csl),
@@ -6,6 +6,7 @@ package v1alpha1
 
 import (
 	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -63,6 +64,31 @@ func (in *ConsoleAuthorisation) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleAuthorisationEntry) DeepCopyInto(out *ConsoleAuthorisationEntry) {
+	*out = *in
+	out.Subject = in.Subject
+	if in.AuthorisedAt != nil {
+		in, out := &in.AuthorisedAt, &out.AuthorisedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleAuthorisationEntry.
+func (in *ConsoleAuthorisationEntry) DeepCopy() *ConsoleAuthorisationEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleAuthorisationEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConsoleAuthorisationList) DeepCopyInto(out *ConsoleAuthorisationList) {
 	*out = *in
@@ -122,8 +148,24 @@ func (in *ConsoleAuthorisationSpec) DeepCopyInto(out *ConsoleAuthorisationSpec)
 	out.ConsoleRef = in.ConsoleRef
 	if in.Authorisations != nil {
 		in, out := &in.Authorisations, &out.Authorisations
-		*out = make([]v1.Subject, len(*in))
-		copy(*out, *in)
+		*out = make([]ConsoleAuthorisationEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rejections != nil {
+		in, out := &in.Rejections, &out.Rejections
+		*out = make([]ConsoleRejection, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TimeoutExtensionAuthorisations != nil {
+		in, out := &in.TimeoutExtensionAuthorisations, &out.TimeoutExtensionAuthorisations
+		*out = make([]ConsoleTimeoutExtensionAuthorisation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -152,6 +194,26 @@ func (in *ConsoleAuthorisationStatus) DeepCopy() *ConsoleAuthorisationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleAuthoriserClause) DeepCopyInto(out *ConsoleAuthoriserClause) {
+	*out = *in
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]v1.Subject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleAuthoriserClause.
+func (in *ConsoleAuthoriserClause) DeepCopy() *ConsoleAuthoriserClause {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleAuthoriserClause)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConsoleAuthorisers) DeepCopyInto(out *ConsoleAuthorisers) {
 	*out = *in
@@ -160,6 +222,13 @@ func (in *ConsoleAuthorisers) DeepCopyInto(out *ConsoleAuthorisers) {
 		*out = make([]v1.Subject, len(*in))
 		copy(*out, *in)
 	}
+	if in.Clauses != nil {
+		in, out := &in.Clauses, &out.Clauses
+		*out = make([]ConsoleAuthoriserClause, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleAuthorisers.
@@ -204,6 +273,41 @@ func (in *ConsoleList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleOutstandingAuthorisation) DeepCopyInto(out *ConsoleOutstandingAuthorisation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleOutstandingAuthorisation.
+func (in *ConsoleOutstandingAuthorisation) DeepCopy() *ConsoleOutstandingAuthorisation {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleOutstandingAuthorisation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleRejection) DeepCopyInto(out *ConsoleRejection) {
+	*out = *in
+	out.Subject = in.Subject
+	if in.RejectedAt != nil {
+		in, out := &in.RejectedAt, &out.RejectedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleRejection.
+func (in *ConsoleRejection) DeepCopy() *ConsoleRejection {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleRejection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConsoleSpec) DeepCopyInto(out *ConsoleSpec) {
 	*out = *in
@@ -223,6 +327,11 @@ func (in *ConsoleSpec) DeepCopyInto(out *ConsoleSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TimeoutExtensions != nil {
+		in, out := &in.TimeoutExtensions, &out.TimeoutExtensions
+		*out = make([]ConsoleTimeoutExtension, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleSpec.
@@ -246,6 +355,27 @@ func (in *ConsoleStatus) DeepCopyInto(out *ConsoleStatus) {
 		in, out := &in.CompletionTime, &out.CompletionTime
 		*out = (*in).DeepCopy()
 	}
+	if in.AuthorisationExpiryTime != nil {
+		in, out := &in.AuthorisationExpiryTime, &out.AuthorisationExpiryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.OutstandingAuthorisations != nil {
+		in, out := &in.OutstandingAuthorisations, &out.OutstandingAuthorisations
+		*out = make([]ConsoleOutstandingAuthorisation, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExitCode != nil {
+		in, out := &in.ExitCode, &out.ExitCode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleStatus.
@@ -348,6 +478,21 @@ func (in *ConsoleTemplateSpec) DeepCopyInto(out *ConsoleTemplateSpec) {
 		*out = new(ConsoleAuthorisers)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.AuthorisationValiditySeconds != nil {
+		in, out := &in.AuthorisationValiditySeconds, &out.AuthorisationValiditySeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxConcurrentConsoles != nil {
+		in, out := &in.MaxConcurrentConsoles, &out.MaxConcurrentConsoles
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxConcurrentConsolesPerUser != nil {
+		in, out := &in.MaxConcurrentConsolesPerUser, &out.MaxConcurrentConsolesPerUser
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleTemplateSpec.
@@ -375,6 +520,46 @@ func (in *ConsoleTemplateStatus) DeepCopy() *ConsoleTemplateStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleTimeoutExtension) DeepCopyInto(out *ConsoleTimeoutExtension) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleTimeoutExtension.
+func (in *ConsoleTimeoutExtension) DeepCopy() *ConsoleTimeoutExtension {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleTimeoutExtension)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleTimeoutExtensionAuthorisation) DeepCopyInto(out *ConsoleTimeoutExtensionAuthorisation) {
+	*out = *in
+	out.Subject = in.Subject
+	if in.AuthorisedAt != nil {
+		in, out := &in.AuthorisedAt, &out.AuthorisedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleTimeoutExtensionAuthorisation.
+func (in *ConsoleTimeoutExtensionAuthorisation) DeepCopy() *ConsoleTimeoutExtensionAuthorisation {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleTimeoutExtensionAuthorisation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodTemplatePreserveMetadataSpec) DeepCopyInto(out *PodTemplatePreserveMetadataSpec) {
 	*out = *in
@@ -11,6 +11,7 @@ import (
 	"github.com/alecthomas/kingpin"
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // this is required to auth against GCP
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -55,6 +56,18 @@ var (
 			Required().
 			String()
 
+	logs     = cli.Command("logs", "Print the logs of a console, including one that has stopped")
+	logsName = logs.Flag("name", "Console name").
+			Required().
+			String()
+	logsFollow = logs.Flag("follow", "Follow the logs until the console terminates").
+			Short('f').
+			Bool()
+	logsSince = logs.Flag("since", "Only print logs newer than a relative duration, e.g. 5m").
+			Duration()
+	logsContainer = logs.Flag("container", "Container to print the logs of, defaulting to the console container").
+			String()
+
 	list         = cli.Command("list", "List currently running consoles")
 	listUsername = list.Flag("user", "Kubernetes username. Not usually supplied, can be inferred from your gcloud login").
 			Short('u').
@@ -64,6 +77,19 @@ var (
 			Short('s').
 			Default("").
 			String()
+	listOutput = list.Flag("output", "Output format. One of: json|yaml|wide|name|jsonpath=...").
+			Short('o').
+			Default("").
+			String()
+
+	get     = cli.Command("get", "Show a single console")
+	getName = get.Flag("name", "Console name").
+		Required().
+		String()
+	getOutput = get.Flag("output", "Output format. One of: json|yaml|wide|name|jsonpath=...").
+			Short('o').
+			Default("").
+			String()
 
 	authorise     = cli.Command("authorise", "Authorise a peer-reviewed console request")
 	authoriseUser = authorise.Flag("user", "Name of the user to attribute to verification. This must match the username that the Kubernetes API recognises you as").
@@ -71,8 +97,39 @@ var (
 	authoriseName = authorise.Flag("name", "Console to authorise").
 			Required().
 			String()
+	authoriseComment = authorise.Flag("comment", "Comment to record alongside the authorisation").
+				String()
 	authoriseAttach = authorise.Flag("attach", "Attach to the console if it starts successfully").
 			Bool()
+	authoriseExtension = authorise.Flag("extension", "Authorise the latest timeout extension requested for the console").
+				Bool()
+
+	reject     = cli.Command("reject", "Reject a peer-reviewed console request")
+	rejectUser = reject.Flag("user", "Name of the user to attribute to the rejection. This must match the username that the Kubernetes API recognises you as").
+			String()
+	rejectName = reject.Flag("name", "Console to reject").
+			Required().
+			String()
+	rejectReason = reject.Flag("reason", "Reason for rejecting the console, which is shown to the requester").
+			Required().
+			String()
+
+	pending     = cli.Command("pending", "List consoles waiting for an authorisation that you can give")
+	pendingUser = pending.Flag("user", "Name to authorise consoles as, excluding consoles that user requested or has already reviewed. If not set, this is the username that the Kubernetes API recognises you as. Consoles are only listed if you are allowed to authorise them").
+			String()
+	pendingInteractive = pending.Flag("interactive", "Prompt to authorise or reject each console in turn").
+				Short('i').
+				Bool()
+
+	extend     = cli.Command("extend", "Extend the timeout of a running console")
+	extendName = extend.Flag("name", "Console to extend").
+			Required().
+			String()
+	extendBy = extend.Flag("by", "Duration to extend the console timeout by").
+			Required().
+			Duration()
+	extendReason = extend.Flag("reason", "Reason for extending the console").
+			String()
 )
 
 func main() {
@@ -85,7 +142,17 @@ func main() {
 
 	ctx, _ := signals.SetupSignalHandler()
 
-	if err := Run(ctx, logger); err != nil && !errors.Is(err, context.Canceled) {
+	err := Run(ctx, logger)
+
+	// Exit with the same code as the console, so that scripts running commands
+	// through consoles can tell whether they succeeded
+	var exitErr runner.ConsoleExitError
+	if errors.As(err, &exitErr) {
+		logger.Log("msg", "Console exited unsuccessfully", "exit_code", exitErr.ExitCode, "reason", exitErr.Reason)
+		os.Exit(int(exitErr.ExitCode))
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) {
 		cli.Fatalf("unexpected error: %s", err)
 	}
 }
@@ -145,6 +212,22 @@ func Run(ctx context.Context, logger kitlog.Logger) error {
 				Hook: LifecyclePrinter(logger),
 			},
 		)
+	case logs.FullCommand():
+		return consoleRunner.Logs(
+			ctx,
+			runner.LogsOptions{
+				Namespace: *cliNamespace,
+				Name:      *logsName,
+				Container: *logsContainer,
+				Follow:    *logsFollow,
+				Since:     *logsSince,
+				IO: runner.IOStreams{
+					In:     os.Stdin,
+					Out:    os.Stdout,
+					ErrOut: os.Stderr,
+				},
+			},
+		)
 	case list.FullCommand():
 		_, err = consoleRunner.List(
 			ctx,
@@ -153,9 +236,22 @@ func Run(ctx context.Context, logger kitlog.Logger) error {
 				Username:  *listUsername,
 				Selector:  *listSelector,
 				Output:    os.Stdout,
+				Format:    runner.OutputFormat(*listOutput),
 			},
 		)
 		return err
+	case get.FullCommand():
+		format := runner.OutputFormat(*getOutput)
+		if err := format.Validate(); err != nil {
+			return err
+		}
+
+		csl, err := consoleRunner.FindConsoleByName(*cliNamespace, *getName)
+		if err != nil {
+			return err
+		}
+
+		return consoleRunner.PrintConsole(ctx, csl, runner.PrintOptions{Output: os.Stdout, Format: format})
 	case authorise.FullCommand():
 		err = consoleRunner.Authorise(
 			ctx,
@@ -163,8 +259,36 @@ func Run(ctx context.Context, logger kitlog.Logger) error {
 				Namespace:   *cliNamespace,
 				ConsoleName: *authoriseName,
 				Username:    *authoriseUser,
+				Comment:     *authoriseComment,
 				Attach:      *authoriseAttach,
 				KubeConfig:  config,
+				// Authorise the latest timeout extension rather than the console
+				TimeoutExtension: *authoriseExtension,
+				IO: runner.IOStreams{
+					In:     os.Stdin,
+					Out:    os.Stdout,
+					ErrOut: os.Stderr,
+				},
+			},
+		)
+		return err
+	case reject.FullCommand():
+		return consoleRunner.Reject(
+			ctx,
+			runner.RejectOptions{
+				Namespace:   *cliNamespace,
+				ConsoleName: *rejectName,
+				Username:    *rejectUser,
+				Reason:      *rejectReason,
+			},
+		)
+	case pending.FullCommand():
+		_, err = consoleRunner.Pending(
+			ctx,
+			runner.PendingOptions{
+				Namespace:   *cliNamespace,
+				Username:    *pendingUser,
+				Interactive: *pendingInteractive,
 				IO: runner.IOStreams{
 					In:     os.Stdin,
 					Out:    os.Stdout,
@@ -173,6 +297,28 @@ func Run(ctx context.Context, logger kitlog.Logger) error {
 			},
 		)
 		return err
+	case extend.FullCommand():
+		csl, err := consoleRunner.Extend(
+			ctx,
+			runner.ExtendOptions{
+				Namespace:   *cliNamespace,
+				ConsoleName: *extendName,
+				By:          *extendBy,
+				Reason:      *extendReason,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		logger.Log(
+			"msg", "Console timeout extension has been requested",
+			"prompt", fmt.Sprintf("If the console requires authorisation, the extension must be approved by running `theatre-consoles authorise --name %s --namespace %s --extension`", csl.Name, csl.Namespace),
+			"console", csl.Name,
+			"namespace", csl.Namespace,
+			"extension", extendBy.String(),
+		)
+		return nil
 	}
 
 	return nil
@@ -208,6 +354,26 @@ func LifecyclePrinter(logger kitlog.Logger) runner.LifecycleHook {
 			)
 			return nil
 		},
+		ConsoleQueuedFunc: func(csl *workloadsv1alpha1.Console) error {
+			logger.Log(
+				"msg", "Console is queued until other consoles finish",
+				"reason", csl.Status.Message,
+				"console", csl.Name,
+				"namespace", csl.Namespace,
+			)
+			return nil
+		},
+		ConsoleWaitingFunc: func(csl *workloadsv1alpha1.Console, condition metav1.Condition) error {
+			logger.Log(
+				"msg", "Console is waiting to start",
+				"condition", condition.Type,
+				"reason", condition.Reason,
+				"detail", condition.Message,
+				"console", csl.Name,
+				"namespace", csl.Namespace,
+			)
+			return nil
+		},
 		ConsoleReadyFunc: func(csl *workloadsv1alpha1.Console) error {
 			logger.Log(
 				"msg", "Console is ready",
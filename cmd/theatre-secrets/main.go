@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	execpkg "os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
@@ -22,6 +23,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/gocardless/theatre/v5/cmd"
+	"github.com/gocardless/theatre/v5/pkg/secrets"
 	"github.com/gocardless/theatre/v5/pkg/signals"
 )
 
@@ -40,17 +42,22 @@ var (
 	installTheatreSecretsBinary = install.Flag("theatre-secrets-binary", "Path to theatre-secrets binary").Default(defaultTheatreSecretsPath).String()
 
 	exec                        = app.Command("exec", "Authenticate with vault and exec secrets")
-	execVaultOptions            = newVaultOptions(exec)
+	execVaultOptions            = newVaultOptions(exec, true)
 	execConfigFile              = exec.Flag("config-file", "App config file").String()
 	execServiceAccountTokenFile = exec.Flag("service-account-token-file", "Path to Kubernetes service account token file").String()
+	execSupervise               = exec.Flag("supervise", "Run the command as a child process, refreshing secret files and renewing leases while it runs").Bool()
+	execRefreshInterval         = exec.Flag("refresh-interval", "How often to re-read secret files from Vault in supervisor mode").Default("5m").Duration()
+	execReloadSignal            = exec.Flag("reload-signal", "Signal to send to the command when a secret file changes in supervisor mode, e.g. SIGHUP").String()
 	execCommand                 = exec.Arg("command", "Command to execute").Required().Strings()
+
+	validate                        = app.Command("validate", "Check references to Vault secrets without executing a command")
+	validateVaultOptions            = newVaultOptions(validate, false)
+	validateConfigFile              = validate.Flag("config-file", "App config file").String()
+	validateEnvironment             = validate.Flag("environment", "Validate references in the environment of this process").Bool()
+	validateServiceAccountTokenFile = validate.Flag("service-account-token-file", "Path to Kubernetes service account token file").String()
 )
 
 type environment map[string]string
-type vaultFile struct {
-	vaultKey       string
-	filesystemPath string
-}
 
 func main() {
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
@@ -60,6 +67,12 @@ func main() {
 	defer cancel()
 
 	if err := mainError(ctx, command); err != nil {
+		// In supervisor mode, exit with the same code as the wrapped process
+		var exitErr *secrets.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode)
+		}
+
 		logger.Error(err, "exiting with error")
 		os.Exit(1)
 	}
@@ -88,20 +101,8 @@ func mainError(ctx context.Context, command string) (err error) {
 	// for secret data. Once in possession of this secret data, set the environment
 	// variables and provision secret data to the filesystem as required.
 	case exec.FullCommand():
-		if execVaultOptions.Token == "" {
-			serviceAccountToken, err := getKubernetesToken(*execServiceAccountTokenFile)
-			if err != nil {
-				return errors.Wrap(err, "failed to authenticate within kubernetes")
-			}
-
-			execVaultOptions.Decorate(logger).Info("logging into vault", "event", "vault.login")
-
-			vaultToken, err := execVaultOptions.Login(serviceAccountToken)
-			if err != nil {
-				return errors.Wrap(err, "failed to login to vault")
-			}
-
-			execVaultOptions.Token = vaultToken
+		if err := execVaultOptions.Authenticate(*execServiceAccountTokenFile); err != nil {
+			return err
 		}
 
 		client, err := execVaultOptions.Client()
@@ -110,6 +111,7 @@ func mainError(ctx context.Context, command string) (err error) {
 		}
 
 		env := environment{}
+		templates := []secrets.FileTemplate{}
 
 		// Load all the environment variables we currently know from our process
 		for _, element := range os.Environ() {
@@ -134,112 +136,136 @@ func mainError(ctx context.Context, command string) (err error) {
 			for key, value := range config.Environment {
 				env[key] = value
 			}
-		}
 
-		var (
-			// Use a set to describe the keys that we need to pull from Vault,
-			// ensuring that API requests aren't repeated if environment variables or
-			// secret files use the same Vault key.
-			keysToFetch  = map[string]bool{}
-			envPlain     = environment{}
-			envFromVault = environment{}
-			vaultFiles   = map[string]vaultFile{}
-		)
+			templates = config.Files
+		}
 
-		for key, value := range env {
-			switch {
-			// For all the environment values that look like they should be vault
-			// references, store the envvar -> vault path mapping, and add the vault
-			// path to our list to pull.
-			case strings.HasPrefix(value, "vault:"):
-				vaultKey := strings.TrimPrefix(value, "vault:")
-
-				keysToFetch[vaultKey] = true
-				envFromVault[key] = vaultKey
-
-			// Support 'vault-file:' prefixed env vars.
-			//
-			// For reference, the expected formats are
-			// 'vault-file:tls-key/2021010100' and
-			// 'vault-file:ssh-key/2021010100:/home/user/.ssh/id_rsa'
-			case strings.HasPrefix(value, "vault-file:"):
-				trimmed := strings.TrimSpace(
-					strings.TrimPrefix(value, "vault-file:"),
-				)
-				if len(trimmed) == 0 {
-					return fmt.Errorf("empty vault-file env var: %v", value)
-				}
+		refs, err := secrets.ParseEnvironment(env)
+		if err != nil {
+			return err
+		}
 
-				split := strings.SplitN(trimmed, ":", 2)
-				vaultKey := split[0]
-				keysToFetch[vaultKey] = true
-
-				// determine if we define a path at which to place the file. For SplitN,
-				// N=2 so we only have two cases
-				switch len(split) {
-				case 2: // path and key
-					vaultFiles[key] = vaultFile{
-						filesystemPath: split[1],
-						vaultKey:       vaultKey,
-					}
-				case 1: // just key
-					vaultFiles[key] = vaultFile{
-						filesystemPath: "",
-						vaultKey:       vaultKey,
-					}
-				}
-			// For all environment variables that don't have a known prefix, store
-			// them in our map of plain envvars so that we can ensure that they're
-			// set before exec'ing the wrapped process, even if they've been defined
-			// in the configuration file rather than the process environment.
-			default:
-				envPlain[key] = value
+		// Read each referenced Vault path only once, even if multiple environment variables
+		// or secret files use the same secret.
+		reader := &secrets.Reader{Client: client, PathPrefix: execVaultOptions.PathPrefix, Logger: logger}
+		paths := refs.Paths()
+		for _, tmpl := range templates {
+			tmplRefs, err := tmpl.References()
+			if err != nil {
+				return err
+			}
+			for _, ref := range tmplRefs {
+				paths = append(paths, ref.Path)
 			}
 		}
 
-		secretEnv := environment{}
+		secretData, err := reader.ReadAll(paths)
+		if err != nil {
+			return err
+		}
 
-		for key := range keysToFetch {
-			path := path.Join(execVaultOptions.PathPrefix, key)
+		// Set all our environment variables which will proxy through to our exec'd process
+		for key, value := range refs.Plain {
+			os.Setenv(key, value)
+		}
 
-			start := time.Now()
-			resp, err := client.Logical().Read(path)
+		for key, ref := range refs.Values {
+			value, err := secretData[ref.Path].Get(ref)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
+			}
 
-			// Use verbosity 1, which is equal to debug level
-			logger.V(1).Info(
-				"vault request finished",
-				"event", "vault_kv_request.finished",
-				"path", path,
-				"duration", time.Since(start).Seconds(),
-				"outcome", outcome(err),
-			)
+			os.Setenv(key, value)
+		}
 
+		// For every 'vault-expand' reference, set one environment variable per field of the
+		// secret, prefixed by the name of the referencing variable, which is itself unset.
+		for key, ref := range refs.Expanded {
+			fields, err := secretData[ref.Path].Fields()
 			if err != nil {
-				return errors.Wrap(err, "failed to retrieve secret value from Vault")
+				return errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
 			}
 
-			if resp == nil {
-				return errors.Errorf("no secret data found at Vault KV path: %s", path)
+			os.Unsetenv(key)
+			for field, value := range fields {
+				if err := setDerivedEnv(env, key, secrets.ExpandedName(key, field), value); err != nil {
+					return err
+				}
 			}
+		}
 
-			value := resp.Data["data"].(map[string]interface{})["data"].(string)
-			secretEnv[key] = value
+		// Dynamic secrets generate new credentials on every read, so we read each path once
+		// and expose the lease alongside every variable that references it, allowing the
+		// wrapped process to know when its credentials will expire.
+		dynamicData, err := reader.ReadAllDynamic(refs.DynamicPaths())
+		if err != nil {
+			return err
 		}
 
-		// Set all our environment variables which will proxy through to our exec'd process
-		for key, value := range envPlain {
+		// Leases that the supervisor will renew, if enabled
+		leases := []*secrets.Lease{}
+		for _, secret := range dynamicData {
+			leases = append(leases, secret.Lease)
+		}
+
+		for key, ref := range refs.Dynamic {
+			secret := dynamicData[ref.Path]
+			value, err := secret.Get(ref)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
+			}
+
 			os.Setenv(key, value)
+			if err := setLeaseEnv(env, key, secret.Path, secret.Lease); err != nil {
+				return err
+			}
 		}
 
-		for key, value := range envFromVault {
-			os.Setenv(key, secretEnv[value])
+		// For every 'vault-pki' reference, issue a certificate and write it to the specified
+		// directory, or a temporary directory if not specified.
+		for key, ref := range refs.PKI {
+			cert, err := reader.IssueCertificate(ref)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
+			}
+
+			directory := ref.Directory
+			if directory == "" {
+				directory, err = os.MkdirTemp("", fmt.Sprintf("%s-*", key))
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("failed to create temporary directory for key %s", key))
+				}
+			}
+
+			logger.Info(
+				"creating vault certificate files",
+				"event", "certificate_files.create",
+				"path", directory,
+			)
+
+			if err := cert.WriteFiles(directory); err != nil {
+				return err
+			}
+
+			leases = append(leases, cert.Lease)
+			os.Setenv(key, directory)
+			if err := setLeaseEnv(env, key, cert.Path, cert.Lease); err != nil {
+				return err
+			}
 		}
 
 		// For every 'vault file' defined in our configuration or environment variables, write
 		// the value out to the specified location on the filesystem, or a random path if not
 		// specified.
-		for key, file := range vaultFiles {
-			path := file.filesystemPath
+		// Files that the supervisor will refresh, if enabled, with their paths resolved
+		files := map[string]secrets.FileReference{}
+		for key, file := range refs.Files {
+			value, err := secretData[file.Path].Get(file.Reference)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
+			}
+
+			path := file.FilesystemPath
 			if path == "" {
 				// generate file path prefixed by key
 				tempFilePath, err := os.CreateTemp("", fmt.Sprintf("%s-*", key))
@@ -247,12 +273,10 @@ func mainError(ctx context.Context, command string) (err error) {
 					return errors.Wrap(err, fmt.Sprintf("failed to write temporary file for key %s", key))
 				}
 
-				file.filesystemPath = tempFilePath.Name()
-				path = file.filesystemPath
+				path = tempFilePath.Name()
 			}
 			// ensure the path structure is available
-			err := os.MkdirAll(filepath.Dir(path), 0700)
-			if err != nil {
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 				return errors.Wrap(err, "failed to ensure path structure is available")
 			}
 
@@ -262,16 +286,32 @@ func mainError(ctx context.Context, command string) (err error) {
 				"path", path,
 			)
 
-			// write file with value of envMap[key]
-			if err := os.WriteFile(path, []byte(secretEnv[file.vaultKey]), 0600); err != nil {
+			if err := os.WriteFile(path, []byte(value), 0600); err != nil {
 				return errors.Wrap(err,
 					fmt.Sprintf("failed to write file with key %s to path %s", key, path))
 			}
 
+			file.FilesystemPath = path
+			files[key] = file
+
 			// update the env with the location of the file we've written
 			os.Setenv(key, path)
 		}
 
+		// Render every file template from our configuration, now that we have read all the
+		// secrets they reference.
+		for _, tmpl := range templates {
+			logger.Info(
+				"rendering vault secret template",
+				"event", "secret_template.create",
+				"path", tmpl.Path,
+			)
+
+			if _, err := tmpl.Write(secretData); err != nil {
+				return err
+			}
+		}
+
 		command := (*execCommand)[0]
 		binary, err := execpkg.LookPath(command)
 		if err != nil {
@@ -287,11 +327,105 @@ func mainError(ctx context.Context, command string) (err error) {
 		args := []string{command}
 		args = append(args, (*execCommand)[1:]...)
 
+		// In supervisor mode we remain as the parent of the wrapped process, keeping its
+		// secrets up to date for as long as it runs.
+		if *execSupervise {
+			supervisor := &secrets.Supervisor{
+				Reader:          reader,
+				Files:           files,
+				Templates:       templates,
+				Leases:          leases,
+				RefreshInterval: *execRefreshInterval,
+				// Orphaned processes are reparented to PID 1, which is us when we're the
+				// entrypoint of a container
+				ReapChildren: os.Getpid() == 1,
+				Logger:       logger,
+			}
+
+			if *execReloadSignal != "" {
+				if supervisor.ReloadSignal, err = secrets.ParseSignal(*execReloadSignal); err != nil {
+					return err
+				}
+			}
+
+			if supervisor.Token, err = reader.TokenLease(); err != nil {
+				return err
+			}
+
+			// The supervisor forwards termination signals to the wrapped process, and exits
+			// once it has, so stop these signals from cancelling our context.
+			signal.Reset(syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+
+			cmd := execpkg.Command(binary)
+			cmd.Args = args
+			cmd.Env = os.Environ()
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+			return supervisor.Run(ctx, cmd)
+		}
+
 		// Run the command directly
 		if err := syscall.Exec(binary, args, os.Environ()); err != nil {
 			return errors.Wrap(err, "failed to execute wrapped program")
 		}
 
+	// Check every reference in the config file and/or environment, reporting all the
+	// problems at once so they can be fixed before deploying. If a Vault address is
+	// provided, also check that each secret exists and can be read by our role.
+	case validate.FullCommand():
+		if *validateConfigFile == "" && !*validateEnvironment {
+			return fmt.Errorf("nothing to validate, provide --config-file and/or --environment")
+		}
+
+		env := environment{}
+		templates := []secrets.FileTemplate{}
+
+		if *validateEnvironment {
+			for _, element := range os.Environ() {
+				nameValue := strings.SplitN(element, "=", 2)
+				env[nameValue[0]] = nameValue[1]
+			}
+		}
+
+		if *validateConfigFile != "" {
+			config, err := parseConfigFile(*validateConfigFile)
+			if err != nil {
+				return err
+			}
+
+			for key, value := range config.Environment {
+				env[key] = value
+			}
+
+			templates = config.Files
+		}
+
+		refs, problems := secrets.Validate(env, templates)
+
+		if validateVaultOptions.Address != "" {
+			if err := validateVaultOptions.Authenticate(*validateServiceAccountTokenFile); err != nil {
+				return err
+			}
+
+			client, err := validateVaultOptions.Client()
+			if err != nil {
+				return err
+			}
+
+			reader := &secrets.Reader{Client: client, PathPrefix: validateVaultOptions.PathPrefix, Logger: logger}
+			problems = append(problems, reader.ValidateVault(refs, templates)...)
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problems", len(problems))
+		}
+
+		logger.Info("no problems found", "event", "validate.success")
+
 	default:
 		panic("unrecognised command")
 	}
@@ -299,6 +433,35 @@ func mainError(ctx context.Context, command string) (err error) {
 	return nil
 }
 
+// setDerivedEnv sets an environment variable that was derived from the variable named
+// by source, refusing to overwrite any variable that was already defined.
+func setDerivedEnv(env environment, source, name, value string) error {
+	if _, ok := env[name]; ok {
+		return fmt.Errorf("resolving %s would overwrite existing environment variable %s", source, name)
+	}
+
+	return os.Setenv(name, value)
+}
+
+// setLeaseEnv exposes the lease of a dynamic secret to the wrapped process.
+func setLeaseEnv(env environment, key, path string, lease *secrets.Lease) error {
+	logger.Info(
+		"obtained vault lease",
+		"event", "vault_lease.create",
+		"path", path,
+		"lease_duration", lease.Duration.Seconds(),
+		"renewable", lease.Renewable,
+	)
+
+	for name, value := range secrets.LeaseEnvironment(key, lease) {
+		if err := setDerivedEnv(env, key, name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // getKubernetesToken attempts to construct a Kubernetes client configuration, preferring
 // in cluster auth but falling back to other detection methods if that fails.
 func getKubernetesToken(tokenFileOverride string) (string, error) {
@@ -356,19 +519,34 @@ type vaultOptions struct {
 	UseTLS                bool
 	InsecureSkipVerify    bool
 	Token                 string
+	AuthMethod            string
 	AuthBackendMountPoint string
 	AuthBackendRole       string
+	JWTFile               string
+	AppRoleRoleID         string
+	AppRoleSecretIDFile   string
+	AgentTokenFile        string
 	PathPrefix            string
 	Timeout               time.Duration
 }
 
-func newVaultOptions(cmd *kingpin.CmdClause) *vaultOptions {
+func newVaultOptions(cmd *kingpin.CmdClause, requireAddress bool) *vaultOptions {
 	opt := &vaultOptions{}
 
-	cmd.Flag("auth-backend-mount-path", "Vault auth backend mount path").Default("kubernetes").StringVar(&opt.AuthBackendMountPoint)
-	cmd.Flag("auth-backend-role", "Vault auth backend role").Default("default").StringVar(&opt.AuthBackendRole)
-	cmd.Flag("vault-address", "Address of vault (format: scheme://host:port)").Required().StringVar(&opt.Address)
-	cmd.Flag("vault-token", "Vault token to use, instead of Kubernetes auth").OverrideDefaultFromEnvar("VAULT_TOKEN").StringVar(&opt.Token)
+	address := cmd.Flag("vault-address", "Address of vault (format: scheme://host:port)")
+	if requireAddress {
+		address = address.Required()
+	}
+	address.StringVar(&opt.Address)
+
+	cmd.Flag("auth-method", "Method used to authenticate with Vault").Default(secrets.AuthMethodKubernetes).EnumVar(&opt.AuthMethod, secrets.AuthMethods...)
+	cmd.Flag("auth-backend-mount-path", "Vault auth backend mount path, defaulting to the name of the auth method").StringVar(&opt.AuthBackendMountPoint)
+	cmd.Flag("auth-backend-role", "Vault auth backend role, for the kubernetes and jwt auth methods").Default("default").StringVar(&opt.AuthBackendRole)
+	cmd.Flag("jwt-file", "Path to the JWT to present to Vault, for the jwt auth method").StringVar(&opt.JWTFile)
+	cmd.Flag("approle-role-id", "AppRole role ID, for the approle auth method").OverrideDefaultFromEnvar("VAULT_ROLE_ID").StringVar(&opt.AppRoleRoleID)
+	cmd.Flag("approle-secret-id-file", "Path to the AppRole secret ID, for the approle auth method").StringVar(&opt.AppRoleSecretIDFile)
+	cmd.Flag("agent-token-file", "Path to the token sink of a Vault Agent, for the agent auth method").StringVar(&opt.AgentTokenFile)
+	cmd.Flag("vault-token", "Vault token to use, instead of an auth method").OverrideDefaultFromEnvar("VAULT_TOKEN").StringVar(&opt.Token)
 	cmd.Flag("vault-use-tls", "Use TLS when connecting to Vault").Default("true").BoolVar(&opt.UseTLS)
 	cmd.Flag("vault-insecure-skip-verify", "Skip TLS certificate verification when connecting to Vault").Default("false").BoolVar(&opt.InsecureSkipVerify)
 	cmd.Flag("vault-path-prefix", "Path prefix to read Vault secret from").Default("").StringVar(&opt.PathPrefix)
@@ -411,52 +589,71 @@ func (o *vaultOptions) Client() (*api.Client, error) {
 func (o *vaultOptions) Decorate(logger logr.Logger) logr.Logger {
 	return logger.WithValues(
 		"address", o.Address,
-		"backend", o.AuthBackendMountPoint,
+		"method", o.AuthMethod,
+		"backend", o.Auth().Mount(),
 		"role", o.AuthBackendRole,
 	)
 }
 
-// Login uses the kubernetes service account token to authenticate against the Vault
-// server. The Vault server is configured with a specific authentication backend that can
+// Auth returns the configuration of the auth method
+func (o *vaultOptions) Auth() secrets.Auth {
+	return secrets.Auth{
+		Method:       o.AuthMethod,
+		MountPath:    o.AuthBackendMountPoint,
+		Role:         o.AuthBackendRole,
+		JWTFile:      o.JWTFile,
+		RoleID:       o.AppRoleRoleID,
+		SecretID:     os.Getenv(appRoleSecretIDEnvVar),
+		SecretIDFile: o.AppRoleSecretIDFile,
+		TokenFile:    o.AgentTokenFile,
+	}
+}
+
+// appRoleSecretIDEnvVar is the environment variable that the AppRole secret ID
+// can be provided in
+const appRoleSecretIDEnvVar = "VAULT_SECRET_ID"
+
+// Authenticate obtains a Vault token using the configured auth method, unless a Vault
+// token was provided.
+//
+// For the kubernetes auth method, we exchange the service account token for a Vault
+// token. The Vault server is configured with a specific authentication backend that can
 // validate the service account token we provide is valid. We are asking Vault to assign
 // us the specified role.
-func (o *vaultOptions) Login(jwt string) (string, error) {
-	client, err := o.Client()
-	if err != nil {
-		return "", err
+func (o *vaultOptions) Authenticate(serviceAccountTokenFile string) error {
+	// The AppRole secret ID is a long-lived credential, so remove it from our environment
+	// once we've logged in, as otherwise it would be passed to the wrapped process.
+	defer os.Unsetenv(appRoleSecretIDEnvVar)
+
+	if o.Token != "" {
+		return nil
 	}
 
-	req := client.NewRequest("POST", fmt.Sprintf("/v1/auth/%s/login", o.AuthBackendMountPoint))
-	req.SetJSONBody(map[string]string{
-		"jwt":  jwt,
-		"role": o.AuthBackendRole,
-	})
-
-	start := time.Now()
-	resp, err := client.RawRequest(req)
-
-	// Use verbosity 1, which is equal to debug level
-	logger.V(1).Info(
-		"Vault login finished",
-		"event", "vault_login_request.finished",
-		"duration", time.Since(start).Seconds(),
-		"outcome", outcome(err),
-	)
+	auth := o.Auth()
+	if auth.Method == secrets.AuthMethodKubernetes {
+		serviceAccountToken, err := getKubernetesToken(serviceAccountTokenFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to authenticate within kubernetes")
+		}
 
-	if err != nil {
-		return "", errors.Wrap(err, "failed to perform login POST request against Vault auth backend mount")
+		auth.JWT = serviceAccountToken
 	}
 
-	if err := resp.Error(); err != nil {
-		return "", errors.Wrap(err, "received error response from login POST request against Vault auth backend mount")
+	o.Decorate(logger).Info("logging into vault", "event", "vault.login")
+
+	client, err := o.Client()
+	if err != nil {
+		return err
 	}
 
-	var secret api.Secret
-	if err := resp.DecodeJSON(&secret); err != nil {
-		return "", errors.Wrap(err, "failed to decode vault login response")
+	vaultToken, err := auth.Login(client, logger)
+	if err != nil {
+		return errors.Wrap(err, "failed to login to vault")
 	}
 
-	return secret.Auth.ClientToken, nil
+	o.Token = vaultToken
+
+	return nil
 }
 
 // Config is the configuration file format that the exec command will use to parse the
@@ -464,32 +661,42 @@ func (o *vaultOptions) Login(jwt string) (string, error) {
 // developers to include this file within their applications.
 type Config struct {
 	Environment environment `yaml:"environment"`
+	// Files are rendered from templates that reference Vault secrets, before the command
+	// is executed
+	Files []secrets.FileTemplate `yaml:"files"`
 }
 
 func loadConfigFromFile(configFile string) (Config, error) {
-	var cfg Config
-
-	yamlContent, err := os.ReadFile(configFile)
+	cfg, err := parseConfigFile(configFile)
 	if err != nil {
-		return cfg, errors.Wrap(err, "failed to open config file")
+		return cfg, err
 	}
 
-	if err := yaml.Unmarshal(yamlContent, &cfg); err != nil {
-		return cfg, errors.Wrap(err, "failed to parse config")
+	if cfg.Environment == nil && cfg.Files == nil {
+		return cfg, fmt.Errorf("missing 'environment' or 'files' key in configuration file")
 	}
 
-	if cfg.Environment == nil {
-		return cfg, fmt.Errorf("missing 'environment' key in configuration file")
+	for _, file := range cfg.Files {
+		if err := file.Validate(); err != nil {
+			return cfg, errors.Wrap(err, "invalid file in config")
+		}
 	}
 
 	return cfg, nil
 }
 
-// Helper for setting the `outcome` field in a log entry.
-func outcome(err error) string {
+// parseConfigFile parses the config file without validating its contents
+func parseConfigFile(configFile string) (Config, error) {
+	var cfg Config
+
+	yamlContent, err := os.ReadFile(configFile)
 	if err != nil {
-		return "failure"
+		return cfg, errors.Wrap(err, "failed to open config file")
 	}
 
-	return "success"
+	if err := yaml.Unmarshal(yamlContent, &cfg); err != nil {
+		return cfg, errors.Wrap(err, "failed to parse config")
+	}
+
+	return cfg, nil
 }
@@ -1,16 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // this is required to auth against GCP
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
 
 	"github.com/gocardless/theatre/v5/cmd"
 	vaultv1alpha1 "github.com/gocardless/theatre/v5/internal/webhook/vault/v1alpha1"
@@ -24,7 +38,7 @@ var (
 
 	commonOpts = cmd.NewCommonOptions(app).WithMetrics(app)
 
-	theatreImage            = app.Flag("theatre-image", "Set to the same image as current binary").Required().String()
+	theatreImage            = app.Flag("theatre-image", "Set to the same image as current binary").String()
 	installPath             = app.Flag("install-path", "Location to install theatre binaries").Default("/var/run/theatre").String()
 	namespaceLabel          = app.Flag("namespace-label", "Namespace label that enables webhook to operate on").Default("theatre-secrets-injector").String()
 	vaultConfigMapName      = app.Flag("vault-configmap-name", "Vault configMap name containing vault configuration").Default("vault-config").String()
@@ -33,6 +47,21 @@ var (
 	theatreSecretsTimeout   = app.Flag("theatre-secrets-timeout", "Timeout that theatre-secrets should use when communicating with Vault").Default("10s").Duration()
 	theatreSecretsDebugMode = app.Flag("theatre-secrets-debug", "Whether enable debug mode within theatre-secrets").Default("false").Bool()
 
+	// Containers that don't set a command rely on the entrypoint of their image, which we
+	// can only wrap with theatre-secrets once we know what it is. Resolving it requires
+	// querying the registry for the image configuration while admitting the pod.
+	resolveImageEntrypoints = app.Flag("resolve-image-entrypoints", "Look up the entrypoint of images for containers without a command").Default("false").Bool()
+	imageRegistryHosts      = app.Flag("image-registry-host", "Registry host that may be contacted to look up image configuration, including hosts that issue tokens or serve redirects (repeatable)").
+				Default(vaultv1alpha1.DefaultRegistryHosts...).Strings()
+	imageRegistryTimeout = app.Flag("image-registry-timeout", "Total time to spend looking up the images of a pod, which must be less than the timeout of the webhook").Default("5s").Duration()
+	imageConfigCacheTTL  = app.Flag("image-config-cache-ttl", "How long to cache the configuration of each image").Default("1h").Duration()
+	imageConfigCacheSize = app.Flag("image-config-cache-size", "Maximum number of images to cache the configuration of").Default("1000").Int()
+	imagePlatform        = app.Flag("image-platform", "Platform to choose from multi-platform images, as os/arch").Default(vaultv1alpha1.DefaultImagePlatform).String()
+
+	// Previews are served on their own port, as they shouldn't be exposed to whatever can
+	// reach the webhook
+	previewPort = app.Flag("preview-port", "Port to serve authenticated previews of the secrets injector on, disabled unless set").Default("0").Int()
+
 	// These configuration parameters alter how the injector mounts service account tokens.
 	// We expect tokens to be sent to Vault, outside of the Kubernetes cluster, so we ensure
 	// the tokens used are short-lived in case they are exposed.
@@ -45,6 +74,16 @@ var (
 				Default("/var/run/secrets/kubernetes.io/vault/token").String()
 	serviceAccountTokenExpiry   = app.Flag("service-account-token-expiry", "Expiry for service account tokens").Default("15m").Duration()
 	serviceAccountTokenAudience = app.Flag("service-account-token-audience", "Audience for the projected service account token").String()
+
+	// Running without a command starts the manager, as it always has
+	serve = app.Command("serve", "Run the manager and its webhooks").Default()
+
+	preview          = app.Command("preview", "Print how the secrets injector would mutate a pod, without a cluster")
+	previewPod       = preview.Flag("pod", "Path to a Pod manifest, or --pod=- for stdin").Required().String()
+	previewConfigMap = preview.Flag("config-map", "Path to the vault config ConfigMap manifest").Required().ExistingFile()
+	previewNamespace = preview.Flag("namespace", "Namespace the pod would be created in, if not set in its manifest").String()
+	previewOutput    = preview.Flag("output", "Print the mutated pod as yaml or json, or the JSON patch the webhook would respond with").
+				Short('o').Default("yaml").Enum("yaml", "json", "patch")
 )
 
 func init() {
@@ -53,26 +92,12 @@ func init() {
 }
 
 func main() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 	logger := commonOpts.Logger()
 
 	ctx, cancel := signals.SetupSignalHandler()
 	defer cancel()
 
-	webhookServer := webhook.NewServer(webhook.Options{Port: 443})
-
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		WebhookServer:    webhookServer,
-		LeaderElection:   commonOpts.ManagerLeaderElection,
-		LeaderElectionID: "vault.crds.gocardless.com",
-		Metrics: metricsserver.Options{
-			BindAddress: fmt.Sprintf("%s:%d", commonOpts.MetricAddress, commonOpts.MetricPort),
-		},
-	})
-	if err != nil {
-		app.Fatalf("failed to create manager: %v", err)
-	}
-
 	injectorOpts := vaultv1alpha1.SecretsInjectorOptions{
 		Image:          *theatreImage,
 		InstallPath:    *installPath,
@@ -88,6 +113,45 @@ func main() {
 		Debug:                       *theatreSecretsDebugMode,
 	}
 
+	if *resolveImageEntrypoints {
+		injectorOpts.ImageResolver = vaultv1alpha1.NewCachedImageResolver(
+			logger.WithName("image-resolver"),
+			vaultv1alpha1.NewRegistryResolver(http.DefaultClient, *imagePlatform, *imageRegistryHosts),
+			*imageConfigCacheTTL,
+			*imageConfigCacheSize,
+		)
+		injectorOpts.ImageResolverTimeout = *imageRegistryTimeout
+	}
+
+	switch command {
+	case serve.FullCommand():
+		if *theatreImage == "" {
+			app.Fatalf("required flag --theatre-image not provided")
+		}
+		runManager(ctx, logger, injectorOpts)
+
+	case preview.FullCommand():
+		if err := runPreview(ctx, injectorOpts); err != nil {
+			app.Fatalf("%v", err)
+		}
+	}
+}
+
+func runManager(ctx context.Context, logger logr.Logger, injectorOpts vaultv1alpha1.SecretsInjectorOptions) {
+	webhookServer := webhook.NewServer(webhook.Options{Port: 443})
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		WebhookServer:    webhookServer,
+		LeaderElection:   commonOpts.ManagerLeaderElection,
+		LeaderElectionID: "vault.crds.gocardless.com",
+		Metrics: metricsserver.Options{
+			BindAddress: fmt.Sprintf("%s:%d", commonOpts.MetricAddress, commonOpts.MetricPort),
+		},
+	})
+	if err != nil {
+		app.Fatalf("failed to create manager: %v", err)
+	}
+
 	mgr.GetWebhookServer().Register("/mutate-pods", &admission.Webhook{
 		Handler: vaultv1alpha1.NewSecretsInjector(
 			mgr.GetClient(),
@@ -97,7 +161,115 @@ func main() {
 		),
 	})
 
+	// Previews let engineers check how their pods will be injected against the live vault
+	// config
+	if *previewPort != 0 {
+		previewServer := webhook.NewServer(webhook.Options{Port: *previewPort})
+		previewServer.Register("/preview-pods", vaultv1alpha1.NewPreviewHandler(
+			mgr.GetClient(),
+			logger.WithName("webhooks").WithName("secrets-injector-preview"),
+			injectorOpts,
+		))
+
+		if err := mgr.Add(previewServer); err != nil {
+			app.Fatalf("failed to add preview server: %v", err)
+		}
+	}
+
 	if err := mgr.Start(ctx); err != nil {
 		app.Fatalf("failed to run manager: %v", err)
 	}
 }
+
+// runPreview prints how the secrets injector would mutate the pod, returning an error
+// if the pod would be rejected so that it can be used to check manifests in CI.
+func runPreview(ctx context.Context, injectorOpts vaultv1alpha1.SecretsInjectorOptions) error {
+	pod, err := decodeManifest[*corev1.Pod](*previewPod)
+	if err != nil {
+		return err
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = *previewNamespace
+	}
+
+	cfgmap, err := decodeManifest[*corev1.ConfigMap](*previewConfigMap)
+	if err != nil {
+		return err
+	}
+
+	resp, err := vaultv1alpha1.Preview(ctx, *pod, cfgmap, injectorOpts)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Allowed {
+		return fmt.Errorf("pod would be rejected: %s", resp.Reason)
+	}
+	if !resp.Mutated {
+		fmt.Fprintf(os.Stderr, "pod would not be mutated: %s\n", resp.Reason)
+		return nil
+	}
+
+	var output []byte
+	switch *previewOutput {
+	case "yaml":
+		output, err = yaml.Marshal(resp.Pod)
+	case "json":
+		output, err = json.MarshalIndent(resp.Pod, "", "  ")
+	case "patch":
+		output, err = json.MarshalIndent(resp.Patch, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(strings.TrimSpace(string(output)))
+	return nil
+}
+
+// decodeManifest reads a YAML or JSON manifest from path, or stdin if path is -,
+// returning the first object of type T. Manifests may contain several documents, so
+// that the same files applied to a cluster can be previewed.
+func decodeManifest[T runtime.Object](path string) (T, error) {
+	var obj T
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return obj, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return obj, errors.Wrapf(err, "failed to read %s", path)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		decoded, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		// Skip documents that are only comments, or contain resources we don't know
+		if runtime.IsMissingKind(err) || runtime.IsNotRegisteredError(err) {
+			continue
+		}
+		if err != nil {
+			return obj, errors.Wrapf(err, "failed to decode %s", path)
+		}
+
+		if match, ok := decoded.(T); ok {
+			return match, nil
+		}
+	}
+
+	return obj, fmt.Errorf("%s contains no %T", path, obj)
+}
@@ -154,7 +154,9 @@ func (r *Runner) Run(logger kitlog.Logger, config *rest.Config) {
 			Expect(err).NotTo(HaveOccurred(), "could not update console user")
 
 			By("Authorise a console")
-			consoleAuthorisation.Spec.Authorisations = []rbacv1.Subject{{Kind: "User", Name: user}}
+			consoleAuthorisation.Spec.Authorisations = []workloadsv1alpha1.ConsoleAuthorisationEntry{
+				{Subject: rbacv1.Subject{Kind: "User", Name: user}},
+			}
 			err = kubeClient.Update(context.TODO(), consoleAuthorisation)
 			Expect(err).NotTo(HaveOccurred(), "could not authorise console")
 
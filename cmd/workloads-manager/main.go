@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // this is required to auth against GCP
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -17,10 +19,12 @@ import (
 	rbacv1alpha1 "github.com/gocardless/theatre/v5/api/rbac/v1alpha1"
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
 	"github.com/gocardless/theatre/v5/cmd"
+	directoryrolebinding "github.com/gocardless/theatre/v5/internal/controller/rbac"
 	consolecontroller "github.com/gocardless/theatre/v5/internal/controller/workloads"
 	internalworkloadsv1alpha1 "github.com/gocardless/theatre/v5/internal/webhook/workloads/v1alpha1"
 	"github.com/gocardless/theatre/v5/pkg/signals"
 	"github.com/gocardless/theatre/v5/pkg/workloads/console/events"
+	"github.com/gocardless/theatre/v5/pkg/workloads/console/notifier"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
@@ -31,11 +35,32 @@ var (
 	contextName            = app.Flag("context-name", "Distinct name for the context this controller runs within. Usually the user-facing name of the kubernetes context for the cluster").Envar("CONTEXT_NAME").String()
 	pubsubProjectId        = app.Flag("pubsub-project-id", "ID for the project containing the Pub/Sub topic for console event publishing").Envar("PUBSUB_PROJECT_ID").String()
 	pubsubTopicId          = app.Flag("pubsub-topic-id", "ID of the topic to publish lifecycle event messages").Envar("PUBSUB_TOPIC_ID").String()
+	publisherKind          = app.Flag("publisher", "Sink for console lifecycle events. Defaults to pubsub if a project and topic are set, otherwise nop").Envar("PUBLISHER").Enum("pubsub", "http", "file", "nop")
+	httpEndpoint           = app.Flag("http-publisher-endpoint", "URL to POST console lifecycle events to, as CloudEvents").Envar("HTTP_PUBLISHER_ENDPOINT").String()
+	httpSecret             = app.Flag("http-publisher-secret", "Secret used to sign the body of each HTTP request with HMAC-SHA256").Envar("HTTP_PUBLISHER_SECRET").String()
+	httpMaxRetries         = app.Flag("http-publisher-max-retries", "Number of times to retry publishing a failed HTTP request, within the deadline of the webhook or reconcile that publishes the event").Envar("HTTP_PUBLISHER_MAX_RETRIES").Default("3").Int()
+	httpBackoff            = app.Flag("http-publisher-backoff", "Delay before the first retry of a failed HTTP request, doubling with each retry").Envar("HTTP_PUBLISHER_BACKOFF").Default("200ms").Duration()
+	httpTimeout            = app.Flag("http-publisher-timeout", "Timeout for each HTTP request, which must be shorter than the webhook timeout as events are published when consoles are authorised").Envar("HTTP_PUBLISHER_TIMEOUT").Default("5s").Duration()
+	filePath               = app.Flag("file-publisher-path", "Path of the file to append console lifecycle events to as JSON lines, or - for stdout").Envar("FILE_PUBLISHER_PATH").Default("-").String()
+	enableOutbox           = app.Flag("outbox", "Store console lifecycle events that fail to publish, and retry them until they succeed").Envar("ENABLE_OUTBOX").Default("false").Bool()
+	outboxNamespace        = app.Flag("outbox-namespace", "Namespace of the ConfigMaps used to store events waiting to be retried").Envar("POD_NAMESPACE").String()
+	outboxPollInterval     = app.Flag("outbox-poll-interval", "How often to check the outbox for events to retry").Envar("OUTBOX_POLL_INTERVAL").Default("10s").Duration()
+	outboxBackoff          = app.Flag("outbox-backoff", "Delay before the first retry of an event in the outbox, doubling with each retry").Envar("OUTBOX_BACKOFF").Default("10s").Duration()
+	outboxMaxBackoff       = app.Flag("outbox-max-backoff", "Maximum delay between retries of an event in the outbox").Envar("OUTBOX_MAX_BACKOFF").Default("10m").Duration()
+	notifierConfig         = app.Flag("notifier-config", "Path to a YAML file listing webhooks to notify when consoles need authorisation").Envar("NOTIFIER_CONFIG").String()
+	notifierTimeout        = app.Flag("notifier-timeout", "Timeout for each notification request").Envar("NOTIFIER_TIMEOUT").Default("5s").Duration()
+	notifierQueueSize      = app.Flag("notifier-queue-size", "Number of notifications to queue for sending before dropping them").Envar("NOTIFIER_QUEUE_SIZE").Default("100").Int()
 	enableSessionRecording = app.Flag("session-recording", "Enable session recording features").Envar("ENABLE_SESSION_RECORDING").Default("false").Bool()
 	sessionSidecarImage    = app.Flag("session-sidecar-image", "Container image to use for the session recording sidecar container").Envar("SESSION_SIDECAR_IMAGE").Default("").String()
 	sessionPubsubProjectId = app.Flag("session-pubsub-project-id", "ID for the project containing the Pub/Sub topic for session recording").Envar("SESSION_PUBSUB_PROJECT_ID").Default("").String()
 	sessionPubsubTopicId   = app.Flag("session-pubsub-topic-id", "ID of the topic to publish session recording data to").Envar("SESSION_PUBSUB_TOPIC_ID").Default("").String()
 
+	// GoogleGroup subjects in the clauses of authorisation rules are resolved
+	// using the Google directory
+	googleEnabled  = app.Flag("google", "Resolve GoogleGroup subjects in authorisation rule clauses, which is required for consoles matching those rules to be authorised").Default("false").Bool()
+	googleSubject  = app.Flag("google-subject", "Service account subject").Default("robot-admin@gocardless.com").String()
+	googleCacheTTL = app.Flag("google-refresh", "Cache TTL for Google directory operations").Default("5m").Duration()
+
 	commonOpts = cmd.NewCommonOptions(app).WithMetrics(app)
 )
 
@@ -69,20 +94,48 @@ func main() {
 	}
 
 	// Create publisher sink for console lifecycle events
+	if *publisherKind == "" {
+		*publisherKind = "nop"
+		if len(*pubsubProjectId) > 0 && len(*pubsubTopicId) > 0 {
+			*publisherKind = "pubsub"
+		}
+	}
+
 	var publisher events.Publisher
 	var err error
-	if len(*pubsubProjectId) > 0 && len(*pubsubTopicId) > 0 {
-		publisher, err = events.NewGooglePubSubPublisher(ctx, *pubsubProjectId, *pubsubTopicId)
+	switch *publisherKind {
+	case "pubsub":
+		if len(*pubsubProjectId) == 0 || len(*pubsubTopicId) == 0 {
+			app.Fatalf("Pub/Sub project ID and topic ID must be set to use the pubsub publisher")
+		}
+		pubsubPublisher, err := events.NewGooglePubSubPublisher(ctx, *pubsubProjectId, *pubsubTopicId)
 		if err != nil {
 			app.Fatalf("failed to create publisher for %s/%s", *pubsubProjectId, *pubsubTopicId)
 		}
-		defer publisher.(*events.GooglePubSubPublisher).Stop()
-	} else { // Default to a nop publisher
+		defer pubsubPublisher.Stop()
+		publisher = pubsubPublisher
+	case "http":
+		if len(*httpEndpoint) == 0 {
+			app.Fatalf("HTTP publisher endpoint must be set to use the http publisher")
+		}
+		publisher = events.NewHTTPPublisher(events.HTTPPublisherOptions{
+			Endpoint:   *httpEndpoint,
+			Source:     fmt.Sprintf("theatre/%s", *contextName),
+			Secret:     *httpSecret,
+			MaxRetries: *httpMaxRetries,
+			Backoff:    *httpBackoff,
+			Timeout:    *httpTimeout,
+		})
+	case "file":
+		filePublisher, err := events.NewFilePublisher(*filePath)
+		if err != nil {
+			app.Fatalf("failed to create publisher: %v", err)
+		}
+		defer filePublisher.Stop()
+		publisher = filePublisher
+	default:
 		publisher = events.NewNopPublisher()
 	}
-	idBuilder := workloadsv1alpha1.NewConsoleIdBuilder(*contextName)
-	lifecycleRecorder := workloadsv1alpha1.NewLifecycleEventRecorder(*contextName, logger, publisher, idBuilder)
-
 	webhookServer := webhook.NewServer(webhook.Options{Port: 443})
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -98,9 +151,80 @@ func main() {
 		app.Fatalf("failed to create manager: %v", err)
 	}
 
+	if *enableOutbox {
+		if len(*outboxNamespace) == 0 {
+			app.Fatalf("Outbox namespace must be set to use the outbox")
+		}
+		// The outbox is only read by itself, so avoid caching every ConfigMap in
+		// the cluster by using a client that talks directly to the API server
+		outboxClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			app.Fatalf("failed to create outbox client: %v", err)
+		}
+		outbox := events.NewOutbox(
+			publisher,
+			events.NewConfigMapOutboxStore(outboxClient, *outboxNamespace, logger.WithName("outbox")),
+			logger.WithName("outbox"),
+			events.OutboxOptions{
+				PollInterval: *outboxPollInterval,
+				Backoff:      *outboxBackoff,
+				MaxBackoff:   *outboxMaxBackoff,
+			},
+		)
+		if err := mgr.Add(outbox); err != nil {
+			app.Fatalf("failed to add outbox to manager: %v", err)
+		}
+		publisher = outbox
+	}
+
+	directories := directoryrolebinding.DirectoryProvider{}
+	if *googleEnabled {
+		googleDirectoryService, err := directoryrolebinding.NewGoogleDirectoryService(ctx, *googleSubject)
+		if err != nil {
+			app.Fatalf("failed to create Google Admin client: %v", err)
+		}
+
+		logger.Info(
+			"registering provider",
+			"event", "provider.register", "kind", rbacv1alpha1.GoogleGroupKind)
+		directories.Register(
+			rbacv1alpha1.GoogleGroupKind,
+			directoryrolebinding.NewCachedDirectory(
+				logger, directoryrolebinding.NewGoogleDirectory(googleDirectoryService.Members), *googleCacheTTL,
+			),
+		)
+	}
+
+	var consoleNotifier notifier.Notifier = notifier.NewNopNotifier()
+	if len(*notifierConfig) > 0 {
+		notifierCfg, err := notifier.LoadConfig(*notifierConfig)
+		if err != nil {
+			app.Fatalf("failed to load notifier config: %v", err)
+		}
+
+		webhookNotifier, err := notifier.NewWebhookNotifier(
+			&http.Client{Timeout: *notifierTimeout}, *contextName, logger.WithName("notifier"), notifierCfg,
+		)
+		if err != nil {
+			app.Fatalf("failed to create notifier: %v", err)
+		}
+
+		// Send notifications in the background, so that slow targets don't hold
+		// up reconciling consoles
+		queuedNotifier := notifier.NewQueuedNotifier(logger.WithName("notifier"), webhookNotifier, *notifierQueueSize)
+		if err := mgr.Add(queuedNotifier); err != nil {
+			app.Fatalf("failed to add notifier to manager: %v", err)
+		}
+		consoleNotifier = queuedNotifier
+	}
+
+	idBuilder := workloadsv1alpha1.NewConsoleIdBuilder(*contextName)
+	lifecycleRecorder := workloadsv1alpha1.NewLifecycleEventRecorder(*contextName, logger, publisher, idBuilder)
+
 	// controller
 	if err = (&consolecontroller.ConsoleReconciler{
 		Client:                 mgr.GetClient(),
+		APIReader:              mgr.GetAPIReader(),
 		LifecycleRecorder:      lifecycleRecorder,
 		ConsoleIdBuilder:       idBuilder,
 		Log:                    ctrl.Log.WithName("controllers").WithName("console"),
@@ -109,6 +233,8 @@ func main() {
 		SessionSidecarImage:    *sessionSidecarImage,
 		SessionPubsubProjectId: *sessionPubsubProjectId,
 		SessionPubsubTopicId:   *sessionPubsubTopicId,
+		Directories:            directories,
+		Notifier:               consoleNotifier,
 	}).SetupWithManager(ctx, mgr); err != nil {
 		app.Fatalf("failed to create controller: %v", err)
 	}
@@ -122,6 +248,14 @@ func main() {
 		),
 	})
 
+	// console authorisation timestamp webhook
+	mgr.GetWebhookServer().Register("/mutate-consoleauthorisations", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleAuthorisationTimestampWebhook(
+			logger.WithName("webhooks").WithName("console-authorisation-timestamp"),
+			mgr.GetScheme(),
+		),
+	})
+
 	// console authorisation webhook
 	mgr.GetWebhookServer().Register("/validate-consoleauthorisations", &admission.Webhook{
 		Handler: internalworkloadsv1alpha1.NewConsoleAuthorisationWebhook(
@@ -137,6 +271,24 @@ func main() {
 		Handler: internalworkloadsv1alpha1.NewConsoleTemplateValidationWebhook(
 			logger.WithName("webhooks").WithName("console-template"),
 			mgr.GetScheme(),
+			directories,
+		),
+	})
+
+	// console update webhook
+	mgr.GetWebhookServer().Register("/validate-consoles", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleUpdateWebhook(
+			logger.WithName("webhooks").WithName("console-update"),
+			mgr.GetScheme(),
+		),
+	})
+
+	// console command validation webhook
+	mgr.GetWebhookServer().Register("/validate-console-commands", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleCommandValidationWebhook(
+			mgr.GetClient(),
+			logger.WithName("webhooks").WithName("console-command-validation"),
+			mgr.GetScheme(),
 		),
 	})
 
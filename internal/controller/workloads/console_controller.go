@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -14,6 +15,8 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -30,8 +33,10 @@ import (
 
 	rbacv1alpha1 "github.com/gocardless/theatre/v5/api/rbac/v1alpha1"
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+	directoryrolebinding "github.com/gocardless/theatre/v5/internal/controller/rbac"
 	"github.com/gocardless/theatre/v5/pkg/logging"
 	"github.com/gocardless/theatre/v5/pkg/recutil"
+	"github.com/gocardless/theatre/v5/pkg/workloads/console/notifier"
 )
 
 const (
@@ -52,6 +57,8 @@ const (
 
 	ConsolePendingAuthorisation = "ConsolePendingAuthorisation"
 	ConsoleAuthorised           = "ConsoleAuthorised"
+	ConsoleRejected             = "ConsoleRejected"
+	ConsoleQueued               = "ConsoleQueued"
 	ConsoleStarted              = "ConsoleStarted"
 	ConsoleEnded                = "ConsoleEnded"
 	ConsoleDestroyed            = "ConsoleDestroyed"
@@ -83,6 +90,9 @@ func (IgnoreCreatePredicate) Create(e event.CreateEvent) bool {
 
 type ConsoleReconciler struct {
 	client.Client
+	// APIReader reads directly from the API server, bypassing the cache, where
+	// a stale read could let consoles exceed their template's concurrency limits
+	APIReader         client.Reader
 	LifecycleRecorder workloadsv1alpha1.LifecycleEventRecorder
 	ConsoleIdBuilder  workloadsv1alpha1.ConsoleIdBuilder
 	Log               logr.Logger
@@ -97,6 +107,16 @@ type ConsoleReconciler struct {
 	SessionPubsubProjectId string
 	// The Pub/Sub topic ID that the session recording data should be sent to
 	SessionPubsubTopicId string
+	// Directories used to resolve the members of groups named by the clauses of
+	// authorisation rules, keyed by subject kind
+	Directories directoryrolebinding.DirectoryProvider
+	// Notifier tells authorisers when a console needs their authorisation, and
+	// when it no longer does. If nil, no notifications are sent.
+	Notifier notifier.Notifier
+
+	// timeouts remembers the timeout of each console with timeout extensions,
+	// keyed by UID, as a cachedTimeout
+	timeouts sync.Map
 }
 
 func (r *ConsoleReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
@@ -153,7 +173,7 @@ func (r *ConsoleReconciler) createOrUpdateUserRbac(logger logr.Logger, ctx conte
 	)
 	// Append all the authorising users to allow them to attach
 	if authorisation != nil {
-		subjects = append(subjects, authorisation.Spec.Authorisations...)
+		subjects = append(subjects, authorisation.Subjects()...)
 	}
 
 	drb := buildUserDirectoryRoleBinding(req.NamespacedName, role, subjects)
@@ -161,6 +181,26 @@ func (r *ConsoleReconciler) createOrUpdateUserRbac(logger logr.Logger, ctx conte
 		return err
 	}
 
+	// Allow the console owner, and only the owner, to request extensions to the
+	// console timeout. The validating webhook ensures that the only change they
+	// can make to the console is to append a timeout extension.
+	extensionName := types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%s", req.Name, "extension"),
+		Namespace: req.Namespace,
+	}
+
+	extensionRole := buildExtensionRole(extensionName, csl.Name)
+	if err := r.createOrUpdate(ctx, logger, csl, extensionRole, Role, recutil.RoleDiff); err != nil {
+		return err
+	}
+
+	extensionDrb := buildUserDirectoryRoleBinding(
+		extensionName, extensionRole, []rbacv1.Subject{{Kind: "User", Name: csl.Spec.User}},
+	)
+	if err := r.createOrUpdate(ctx, logger, csl, extensionDrb, DirectoryRoleBinding, recutil.DirectoryRoleBindingDiff); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -203,6 +243,14 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 	// Fetch console template
 	tpl, err := r.getConsoleTemplate(ctx, csl, req.NamespacedName)
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			r.setFailingCondition(ctx, logger, csl, metav1.Condition{
+				Type:    workloadsv1alpha1.ConsoleTemplateResolvedCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  workloadsv1alpha1.ReasonTemplateNotFound,
+				Message: fmt.Sprintf("ConsoleTemplate %s does not exist", csl.Spec.ConsoleTemplateRef.Name),
+			})
+		}
 		return ctrl.Result{}, errors.Wrap(err, "failed to retrieve console template")
 	}
 
@@ -249,11 +297,35 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 	if tpl.HasAuthorisationRules() {
 		rule, err := tpl.GetAuthorisationRuleForCommand(command)
 		if err != nil {
+			r.setFailingCondition(ctx, logger, csl, metav1.Condition{
+				Type:    workloadsv1alpha1.ConsoleAuthorisedCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  workloadsv1alpha1.ReasonNoMatchingRule,
+				Message: fmt.Sprintf("No authorisation rule in ConsoleTemplate %s matches the command: %s", tpl.Name, err),
+			})
 			return ctrl.Result{}, errors.Wrap(err, "failed to determine authorisation rule for console command")
 		}
 
+		// The template webhook rejects such rules, but templates saved before the
+		// workloads-manager lost a directory may still have them. This is a
+		// configuration problem that retrying won't fix, so the console is left
+		// with a failing condition rather than requeued.
+		if subject := rule.UnresolvableSubject(r.resolvableKind); subject != nil {
+			msg := fmt.Sprintf(
+				"Authorisation rule in ConsoleTemplate %s has a clause naming %s %s, but the workloads-manager can't resolve the members of that kind of subject",
+				tpl.Name, subject.Kind, subject.Name,
+			)
+			r.setFailingCondition(ctx, logger, csl, metav1.Condition{
+				Type:    workloadsv1alpha1.ConsoleAuthorisedCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  workloadsv1alpha1.ReasonUnresolvableSubject,
+				Message: msg,
+			})
+			return ctrl.Result{}, nil
+		}
+
 		authRule = &rule
-		if err := r.createAuthorisationObjects(ctx, logger, csl, req.NamespacedName, authRule.Subjects); err != nil {
+		if err := r.createAuthorisationObjects(ctx, logger, csl, req.NamespacedName, authRule.AuthoriserSubjects()); err != nil {
 			return ctrl.Result{}, err
 		}
 
@@ -285,9 +357,58 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 	// creation or when a job already exists, i.e. if we've already passed the
 	// Creating phase, but the job no longer exists (it's been destroyed external
 	// to this controller) then don't recreate it.
-	authorised := isConsoleAuthorised(authRule, authorisation)
-	if (authorised && csl.PendingJob()) || job != nil {
-		job = r.buildJob(logger, req.NamespacedName, csl, tpl)
+	//
+	// Authorisations may lapse, so they are only evaluated until the job has
+	// been created: after that point the console has already been authorised.
+	var outstanding []workloadsv1alpha1.ConsoleOutstandingAuthorisation
+	if csl.PendingJob() && authRule != nil && authorisation != nil {
+		outstanding, err = r.outstandingAuthorisations(ctx, authRule, authorisation, tpl.AuthorisationValidity(), time.Now())
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to evaluate authoriser clauses")
+		}
+	}
+
+	authorised := !csl.PendingJob() || isConsoleAuthorised(authRule, authorisation, outstanding, tpl.AuthorisationValidity(), time.Now())
+
+	// A single rejection prevents the console from ever running, but can only
+	// be given before the job has been created.
+	rejected := csl.Rejected() || (csl.PendingJob() && isConsoleRejected(authorisation))
+	if rejected {
+		authorised = false
+	}
+
+	// Authorised consoles are held in a queue, rather than having their job
+	// created, while the template's concurrency limits have been reached.
+	//
+	// The cache may not yet have seen consoles or jobs that we created or
+	// updated moments ago, so we read them from the API server: otherwise two
+	// consoles authorised together could both start despite a limit of one.
+	var queueMessage string
+	if authorised && csl.PendingJob() && tpl.HasConcurrencyLimits() {
+		var consoles workloadsv1alpha1.ConsoleList
+		if err := r.APIReader.List(ctx, &consoles, client.InNamespace(csl.Namespace)); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to list consoles to check concurrency limits")
+		}
+
+		started, err := r.startedConsoles(ctx, csl.Namespace)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to list console jobs to check concurrency limits")
+		}
+
+		queueMessage = tpl.ConcurrencyLimitMessage(csl, consoles.Items, started)
+	}
+	queued := queueMessage != ""
+
+	// The timeout is only used for the job, and the console's expiry time once
+	// it has a job, so it isn't calculated before then.
+	var timeout int
+	if (authorised && !queued && csl.PendingJob()) || job != nil {
+		timeout, err = r.timeoutSeconds(ctx, csl, tpl, authRule, authorisation)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to evaluate timeout extension authorisations")
+		}
+
+		job = r.buildJob(logger, req.NamespacedName, csl, tpl, timeout)
 		if err := r.createOrUpdate(ctx, logger, csl, job, Job, jobDiff); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -335,29 +456,63 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 	// Update the status fields in case they're out of sync, or the console spec
 	// has been updated
 	statusCtx := consoleStatusContext{
-		Command:           command,
-		IsAuthorised:      authorised,
-		Authorisation:     authorisation,
-		AuthorisationRule: authRule,
-		Job:               job,
-		Pod:               pod,
-	}
-
+		Command:               command,
+		IsAuthorised:          authorised,
+		IsRejected:            rejected,
+		IsQueued:              queued,
+		QueueMessage:          queueMessage,
+		Authorisation:         authorisation,
+		AuthorisationRule:     authRule,
+		AuthorisationValidity: tpl.AuthorisationValidity(),
+		OutstandingClauses:    outstanding,
+		TimeoutSeconds:        timeout,
+		Job:                   job,
+		Pod:                   pod,
+	}
+
+	lastNotification := csl.Status.LastNotification
 	csl, err = r.generateStatusAndAuditEvents(ctx, logger, csl, statusCtx)
 	if err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "failed to generate console status or audit events")
 	}
 
-	if err := r.createOrUpdate(ctx, logger, csl, csl, Console, consoleDiff); err != nil {
+	if err := r.updateStatus(ctx, logger, csl); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Notify authorisers only once the status recording the notification has
+	// been persisted, so that each is sent once even if we reconcile again
+	// before seeing our update.
+	if csl.Status.LastNotification != lastNotification {
+		event := notifier.Event(csl.Status.LastNotification)
+		r.notify(ctx, logger, newNotification(event, csl, command, authRule, authorisation))
+	}
+
 	var res ctrl.Result
 	switch {
 	case csl.PendingAuthorisation():
 		// Requeue for when the console has reached its before-running TTL, so that
 		// it can be deleted if it has not yet been authorised by that point.
+		requeueAt := *csl.GetGCTime()
+		// If any authorisations will lapse before then, requeue for that instead
+		// so that the status reflects the authorisations that remain valid.
+		if expiry := csl.Status.AuthorisationExpiryTime; expiry != nil && expiry.Time.Before(requeueAt) {
+			requeueAt = expiry.Time
+		}
+		res = requeueAfterInterval(logger, time.Until(requeueAt))
+	case csl.Rejected():
+		// Requeue for when the console has reached its before-running TTL, so that
+		// it can be deleted.
 		res = requeueAfterInterval(logger, time.Until(*csl.GetGCTime()))
+	case csl.Queued():
+		// Other consoles finishing won't trigger a reconciliation of this one, so
+		// periodically check whether capacity has freed up, unless the console
+		// reaches its before-running TTL first.
+		requeueAfter := 10 * time.Second
+		if untilGC := time.Until(*csl.GetGCTime()); untilGC < requeueAfter {
+			requeueAfter = untilGC
+		}
+		res = requeueAfterInterval(logger, requeueAfter)
 	case csl.Pending():
 		// Requeue every second while job has been created but there is not yet a
 		// running pod: we won't receive an event via the job watcher when this
@@ -393,6 +548,7 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 		if err = r.Delete(ctx, csl, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
 			return ctrl.Result{}, err
 		}
+		r.timeouts.Delete(csl.UID)
 
 		return ctrl.Result{Requeue: false}, nil
 	}
@@ -400,6 +556,133 @@ func (r *ConsoleReconciler) Reconcile(logger logr.Logger, ctx context.Context, r
 	return res, err
 }
 
+// timeoutInputs are what the timeout of a console depends on. Timeout
+// extensions and their authorisations can only be appended to, so counting
+// them is enough to tell when they have changed.
+type timeoutInputs struct {
+	timeoutSeconds          int
+	extensions              int
+	extensionAuthorisations int
+	templateVersion         string
+}
+
+type cachedTimeout struct {
+	inputs  timeoutInputs
+	timeout int
+}
+
+// timeoutSeconds returns the timeout of the console, including any extensions
+// requested by the console owner that have been approved, clamped to the
+// template maximum.
+//
+// Approving an extension can require listing the members of directory groups,
+// so the timeout is remembered until the console's extensions, their
+// authorisations or the template change, rather than being evaluated on every
+// reconcile, such as each of the frequent requeues while a console is pending.
+func (r *ConsoleReconciler) timeoutSeconds(ctx context.Context, csl *workloadsv1alpha1.Console, tpl *workloadsv1alpha1.ConsoleTemplate, rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth *workloadsv1alpha1.ConsoleAuthorisation) (int, error) {
+	inputs := timeoutInputs{
+		timeoutSeconds:  csl.Spec.TimeoutSeconds,
+		extensions:      len(csl.Spec.TimeoutExtensions),
+		templateVersion: tpl.ResourceVersion,
+	}
+	if auth != nil {
+		inputs.extensionAuthorisations = len(auth.Spec.TimeoutExtensionAuthorisations)
+	}
+
+	if cached, ok := r.timeouts.Load(csl.UID); ok && cached.(cachedTimeout).inputs == inputs {
+		return cached.(cachedTimeout).timeout, nil
+	}
+
+	timeout, err := csl.TimeoutSecondsWithExtensions(tpl, rule, auth, r.matchSubject(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	// Without extensions there is nothing expensive to avoid repeating
+	if inputs.extensions > 0 {
+		r.timeouts.Store(csl.UID, cachedTimeout{inputs: inputs, timeout: timeout})
+	}
+
+	return timeout, nil
+}
+
+// startedConsoles returns the names of the consoles in the namespace that have a
+// job which hasn't finished, read from the API server.
+func (r *ConsoleReconciler) startedConsoles(ctx context.Context, namespace string) (map[string]bool, error) {
+	var jobs batchv1.JobList
+	if err := r.APIReader.List(ctx, &jobs, client.InNamespace(namespace), client.HasLabels{"console-name"}); err != nil {
+		return nil, err
+	}
+
+	started := map[string]bool{}
+	for _, job := range jobs.Items {
+		owner := metav1.GetControllerOf(&job)
+		if owner == nil || owner.Kind != "Console" || jobFinished(&job) {
+			continue
+		}
+		started[owner.Name] = true
+	}
+
+	return started, nil
+}
+
+// jobFinished returns whether the job has completed or failed
+func jobFinished(job *batchv1.Job) bool {
+	// Currently a job can only have two conditions: Complete and Failed
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setFailingCondition records a condition that prevents the console from
+// progressing any further, so that the user can see why it is stuck even though
+// the rest of the status can't be calculated. Failing to record the condition
+// is only logged.
+func (r *ConsoleReconciler) setFailingCondition(ctx context.Context, logger logr.Logger, csl *workloadsv1alpha1.Console, condition metav1.Condition) {
+	updatedCsl := csl.DeepCopy()
+	meta.SetStatusCondition(&updatedCsl.Status.Conditions, condition)
+	updatedCsl.Status.Message = condition.Message
+
+	if err := r.updateStatus(ctx, logger, updatedCsl); err != nil {
+		logging.WithNoRecord(logger).Error(err, "failed to record console condition", "condition", condition.Type)
+	}
+}
+
+// updateStatus writes the status of the console through the status
+// subresource, recording the generation of the console it was calculated from,
+// if it differs from the existing status. On success the console is updated
+// with the result.
+func (r *ConsoleReconciler) updateStatus(ctx context.Context, logger logr.Logger, csl *workloadsv1alpha1.Console) error {
+	csl.Status.ObservedGeneration = csl.Generation
+	objDesc := fmt.Sprintf("%s status: %s", Console, csl.Name)
+
+	existing := &workloadsv1alpha1.Console{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(csl), existing); err != nil {
+		return errors.Wrap(err, "failed to get console to update its status")
+	}
+
+	if reflect.DeepEqual(existing.Status, csl.Status) {
+		logging.WithNoRecord(logger).Info(
+			"Nothing to do for "+objDesc,
+			"event", EventNoCreateOrUpdate,
+		)
+		return nil
+	}
+
+	existing.Status = csl.Status
+	if err := r.Status().Update(ctx, existing); err != nil {
+		return errors.Wrap(err, "failed to update console status")
+	}
+	logger.Info("Updated "+objDesc, "event", EventSuccessfulUpdate)
+
+	existing.DeepCopyInto(csl)
+	return nil
+}
+
 func (r *ConsoleReconciler) getConsoleTemplate(ctx context.Context, csl *workloadsv1alpha1.Console, name types.NamespacedName) (*workloadsv1alpha1.ConsoleTemplate, error) {
 	tplName := types.NamespacedName{
 		Name:      csl.Spec.ConsoleTemplateRef.Name,
@@ -534,7 +817,10 @@ func (r *ConsoleReconciler) setConsoleTimeout(logger logr.Logger, console *workl
 	return updatedCsl
 }
 
-func isConsoleAuthorised(rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth *workloadsv1alpha1.ConsoleAuthorisation) bool {
+// isConsoleAuthorised returns whether enough authorisations that are still
+// valid at the given time have been given to satisfy the authorisation rule,
+// and none of its clauses are outstanding.
+func isConsoleAuthorised(rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth *workloadsv1alpha1.ConsoleAuthorisation, outstanding []workloadsv1alpha1.ConsoleOutstandingAuthorisation, validity time.Duration, now time.Time) bool {
 	if rule == nil {
 		return true
 	}
@@ -542,36 +828,158 @@ func isConsoleAuthorised(rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth
 		return false
 	}
 
-	if len(auth.Spec.Authorisations) >= rule.ConsoleAuthorisers.AuthorisationsRequired {
+	if len(auth.ValidAuthorisations(validity, now)) >= rule.ConsoleAuthorisers.AuthorisationsRequired && len(outstanding) == 0 {
 		return true
 	}
 
 	return false
 }
 
+// outstandingAuthorisations returns the clauses of the authorisation rule that
+// are not satisfied by the authorisations that are still valid at the given
+// time.
+func (r *ConsoleReconciler) outstandingAuthorisations(ctx context.Context, rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth *workloadsv1alpha1.ConsoleAuthorisation, validity time.Duration, now time.Time) ([]workloadsv1alpha1.ConsoleOutstandingAuthorisation, error) {
+	authorisers := []rbacv1.Subject{}
+	for _, entry := range auth.ValidAuthorisations(validity, now) {
+		authorisers = append(authorisers, entry.Subject)
+	}
+
+	return rule.OutstandingClauses(authorisers, auth.MatchGroups(r.matchSubject(ctx)))
+}
+
+// matchSubject returns a SubjectMatcher that resolves the members of subjects
+// with a kind that we have a directory for, such as GoogleGroups. Other
+// subjects are matched by MatchSubject, and native RBAC groups through the
+// groups recorded on each authorisation.
+func (r *ConsoleReconciler) matchSubject(ctx context.Context) workloadsv1alpha1.SubjectMatcher {
+	return func(authoriser, subject rbacv1.Subject) (bool, error) {
+		directory := r.Directories.Get(subject.Kind)
+		if directory == nil || authoriser.Kind != rbacv1.UserKind {
+			return workloadsv1alpha1.MatchSubject(authoriser, subject)
+		}
+
+		members, err := directory.MembersOf(ctx, subject.Name)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to list members of %s %s", subject.Kind, subject.Name)
+		}
+
+		for _, member := range members {
+			if strings.EqualFold(member, authoriser.Name) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+}
+
+// resolvableKind returns whether we have a directory to resolve the members of
+// subjects of the given kind.
+func (r *ConsoleReconciler) resolvableKind(kind string) bool {
+	return r.Directories.Get(kind) != nil
+}
+
+// notify sends a notification about the console's authorisation. As with
+// lifecycle events, failures are logged rather than preventing reconciliation.
+func (r *ConsoleReconciler) notify(ctx context.Context, logger logr.Logger, notification notifier.Notification) {
+	if r.Notifier == nil {
+		return
+	}
+
+	if err := r.Notifier.Notify(ctx, notification); err != nil {
+		logging.WithNoRecord(logger).Error(err, "failed to send notification", "event", "console.notify", "notification", notification.Event)
+	}
+}
+
+// newNotification describes the console and the authorisations it has been
+// given, for the event that has happened to it.
+func newNotification(event notifier.Event, csl *workloadsv1alpha1.Console, command []string, rule *workloadsv1alpha1.ConsoleAuthorisationRule, auth *workloadsv1alpha1.ConsoleAuthorisation) notifier.Notification {
+	notification := notifier.Notification{
+		Event:           event,
+		Namespace:       csl.Namespace,
+		Console:         csl.Name,
+		ConsoleTemplate: csl.Spec.ConsoleTemplateRef.Name,
+		Username:        csl.Spec.User,
+		Reason:          csl.Spec.Reason,
+		Command:         command,
+		Authorisers:     []string{},
+		Timestamp:       time.Now().UTC(),
+	}
+
+	if rule != nil {
+		notification.RequiredAuthorisations = rule.AuthorisationsRequired
+		notification.AuthorisationRuleName = rule.Name
+		for _, subject := range rule.AuthoriserSubjects() {
+			notification.Authorisers = append(notification.Authorisers, subject.Name)
+		}
+	}
+
+	if auth != nil {
+		for _, authorisation := range auth.Spec.Authorisations {
+			notification.AuthorisedBy = append(notification.AuthorisedBy, authorisation.Name)
+		}
+		if len(auth.Spec.Rejections) > 0 {
+			notification.RejectedBy = auth.Spec.Rejections[0].Name
+			notification.RejectionReason = auth.Spec.Rejections[0].Reason
+		}
+	}
+
+	return notification
+}
+
+// isConsoleRejected returns whether any subject has rejected the console.
+func isConsoleRejected(auth *workloadsv1alpha1.ConsoleAuthorisation) bool {
+	return auth != nil && len(auth.Spec.Rejections) > 0
+}
+
 // consoleStatusContext is a wrapper for the objects required to calculate the
 // status of a console and generate audit log events - primarily to help keep
 // function signatures concise.
 type consoleStatusContext struct {
 	Command           []string
 	IsAuthorised      bool
+	IsRejected        bool
+	IsQueued          bool
+	QueueMessage      string
 	Authorisation     *workloadsv1alpha1.ConsoleAuthorisation
 	AuthorisationRule *workloadsv1alpha1.ConsoleAuthorisationRule
-	Pod               *corev1.Pod
-	Job               *batchv1.Job
+	// Duration for which authorisations remain valid, or zero if they never lapse
+	AuthorisationValidity time.Duration
+	// Clauses of the authorisation rule that have yet to be satisfied
+	OutstandingClauses []workloadsv1alpha1.ConsoleOutstandingAuthorisation
+	TimeoutSeconds     int
+	Pod                *corev1.Pod
+	Job                *batchv1.Job
 }
 
 func (r *ConsoleReconciler) generateStatusAndAuditEvents(ctx context.Context, logger logr.Logger, csl *workloadsv1alpha1.Console, statusCtx consoleStatusContext) (*workloadsv1alpha1.Console, error) {
 	logger = getAuditLogger(logger, r.ConsoleIdBuilder.BuildId(csl), csl, statusCtx)
 	newStatus := calculateStatus(csl, statusCtx)
 
+	// The authorisation event to notify authorisers about, if any
+	var notification notifier.Event
+
 	if csl.Creating() && newStatus.Phase == workloadsv1alpha1.ConsolePendingAuthorisation {
 		logger.Info("Console pending authorisation", "event", ConsolePendingAuthorisation)
+		notification = notifier.EventRequest
+	}
+
+	// Console phase from Pending Authorisation to Rejected
+	if !csl.Rejected() && newStatus.Phase == workloadsv1alpha1.ConsoleRejected {
+		logger.Info("Console rejected", "event", ConsoleRejected)
+		notification = notifier.EventRejected
+	}
+
+	// Console phase to Queued
+	if !csl.Queued() && newStatus.Phase == workloadsv1alpha1.ConsoleQueued {
+		logger.Info("Console queued", "event", ConsoleQueued, "message", newStatus.Message)
 	}
 
 	// Console phase from Pending Authorisation
-	if csl.PendingAuthorisation() && newStatus.Phase != workloadsv1alpha1.ConsolePendingAuthorisation {
+	if csl.PendingAuthorisation() && newStatus.Phase != workloadsv1alpha1.ConsolePendingAuthorisation &&
+		newStatus.Phase != workloadsv1alpha1.ConsoleRejected {
 		logger.Info("Console authorised", "event", ConsoleAuthorised)
+		notification = notifier.EventAuthorised
 	}
 
 	// Console phase from Pending to Running
@@ -620,6 +1028,15 @@ func (r *ConsoleReconciler) generateStatusAndAuditEvents(ctx context.Context, lo
 		if err := r.LifecycleRecorder.ConsoleTerminate(ctx, csl, true, statusCtx.Pod); err != nil {
 			logging.WithNoRecord(logger).Error(err, "failed to record event", "event", "console.terminate")
 		}
+		notification = notifier.EventExpired
+	}
+
+	// Console was in Queued phase, but is about to be deleted.
+	if csl.Queued() && csl.EligibleForGC() {
+		logger.Info("Console expired while queued", "event", ConsoleEnded)
+		if err := r.LifecycleRecorder.ConsoleTerminate(ctx, csl, true, statusCtx.Pod); err != nil {
+			logging.WithNoRecord(logger).Error(err, "failed to record event", "event", "console.terminate")
+		}
 	}
 
 	// Console phase has changed to destroyed (i.e. the job has been removed)
@@ -627,6 +1044,14 @@ func (r *ConsoleReconciler) generateStatusAndAuditEvents(ctx context.Context, lo
 		logger.Info("Console destroyed", "event", ConsoleDestroyed)
 	}
 
+	// Record the notification in the status, which the caller sends once the
+	// status is persisted. Consoles that need no authorisation have nobody to
+	// notify.
+	if notification != "" && string(notification) != csl.Status.LastNotification &&
+		statusCtx.AuthorisationRule != nil && statusCtx.AuthorisationRule.AuthorisationsRequired > 0 {
+		newStatus.LastNotification = string(notification)
+	}
+
 	updatedCsl := csl.DeepCopy()
 	updatedCsl.Status = newStatus
 
@@ -645,20 +1070,203 @@ func calculateStatus(csl *workloadsv1alpha1.Console, statusCtx consoleStatusCont
 		// Running phase, as image pull time could be significant in some cases.
 		jobCreationTime := statusCtx.Job.ObjectMeta.CreationTimestamp.Time
 		expiryTime := metav1.NewTime(
-			jobCreationTime.Add(time.Second * time.Duration(csl.Spec.TimeoutSeconds)),
+			jobCreationTime.Add(time.Second * time.Duration(statusCtx.TimeoutSeconds)),
 		)
 		newStatus.ExpiryTime = &expiryTime
 		newStatus.CompletionTime = statusCtx.Job.Status.CompletionTime
 	}
 	if statusCtx.Pod != nil {
 		newStatus.PodName = statusCtx.Pod.ObjectMeta.Name
+
+		// Retain the exit code once the pod has gone, so that it can still be
+		// reported to the user
+		if terminated := workloadsv1alpha1.ConsoleContainerTerminated(statusCtx.Pod); terminated != nil {
+			exitCode := terminated.ExitCode
+			newStatus.ExitCode = &exitCode
+			newStatus.TerminationReason = terminated.Reason
+		}
+	}
+
+	// Authorisations only matter until the job has been created, so stop
+	// tracking when they lapse from that point onwards.
+	if statusCtx.Job == nil && statusCtx.Authorisation != nil {
+		newStatus.AuthorisationExpiryTime = nil
+		if expiry := statusCtx.Authorisation.AuthorisationExpiryTime(statusCtx.AuthorisationValidity, time.Now()); expiry != nil {
+			t := metav1.NewTime(*expiry)
+			newStatus.AuthorisationExpiryTime = &t
+		}
+	}
+	newStatus.OutstandingAuthorisations = nil
+	if statusCtx.Job == nil && !statusCtx.IsAuthorised && !statusCtx.IsRejected {
+		newStatus.OutstandingAuthorisations = statusCtx.OutstandingClauses
 	}
 
 	newStatus.Phase = calculatePhase(statusCtx)
+	calculateConditions(csl, &newStatus, statusCtx)
+
+	newStatus.Message = ""
+	if condition := newStatus.FailingCondition(); condition != nil {
+		newStatus.Message = condition.Message
+	}
 
 	return newStatus
 }
 
+// calculateConditions updates the conditions describing each stage of the
+// console's progress towards being ready. This must be called once the phase of
+// the new status has been calculated.
+func calculateConditions(csl *workloadsv1alpha1.Console, newStatus *workloadsv1alpha1.ConsoleStatus, statusCtx consoleStatusContext) {
+	setCondition := func(conditionType string, satisfied bool, reason, message string) {
+		status := metav1.ConditionFalse
+		if satisfied {
+			status = metav1.ConditionTrue
+		}
+
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    conditionType,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		})
+	}
+
+	setCondition(
+		workloadsv1alpha1.ConsoleTemplateResolvedCondition, true, workloadsv1alpha1.ReasonTemplateFound,
+		fmt.Sprintf("Using ConsoleTemplate %s", csl.Spec.ConsoleTemplateRef.Name),
+	)
+
+	rule := statusCtx.AuthorisationRule
+	switch {
+	case statusCtx.IsRejected:
+		setCondition(
+			workloadsv1alpha1.ConsoleAuthorisedCondition, false, workloadsv1alpha1.ReasonRejected,
+			rejectionMessage(statusCtx.Authorisation),
+		)
+	case rule == nil || rule.AuthorisationsRequired == 0:
+		setCondition(
+			workloadsv1alpha1.ConsoleAuthorisedCondition, true, workloadsv1alpha1.ReasonAuthorisationNotRequired,
+			"The console command does not require authorisation",
+		)
+	case statusCtx.IsAuthorised:
+		setCondition(
+			workloadsv1alpha1.ConsoleAuthorisedCondition, true, workloadsv1alpha1.ReasonAuthorised,
+			"The console has been authorised",
+		)
+	default:
+		given := 0
+		if statusCtx.Authorisation != nil {
+			given = len(statusCtx.Authorisation.ValidAuthorisations(statusCtx.AuthorisationValidity, time.Now()))
+		}
+		message := fmt.Sprintf("Waiting for authorisation: %d of %d required authorisations given", given, rule.AuthorisationsRequired)
+		if len(statusCtx.OutstandingClauses) > 0 {
+			clauses := []string{}
+			for _, clause := range statusCtx.OutstandingClauses {
+				clauses = append(clauses, fmt.Sprintf("%s (%d of %d)", clause.Name, clause.AuthorisationsGiven, clause.AuthorisationsRequired))
+			}
+			message = fmt.Sprintf("%s, still needed from %s", message, strings.Join(clauses, ", "))
+		}
+		setCondition(
+			workloadsv1alpha1.ConsoleAuthorisedCondition, false, workloadsv1alpha1.ReasonPendingAuthorisation,
+			message,
+		)
+	}
+
+	switch {
+	case statusCtx.Job != nil:
+		setCondition(
+			workloadsv1alpha1.ConsoleJobCreatedCondition, true, workloadsv1alpha1.ReasonJobCreated,
+			fmt.Sprintf("Created job %s", statusCtx.Job.Name),
+		)
+	case statusCtx.IsQueued:
+		setCondition(
+			workloadsv1alpha1.ConsoleJobCreatedCondition, false, workloadsv1alpha1.ReasonQueued,
+			statusCtx.QueueMessage,
+		)
+	case statusCtx.IsRejected || !statusCtx.IsAuthorised:
+		setCondition(
+			workloadsv1alpha1.ConsoleJobCreatedCondition, false, workloadsv1alpha1.ReasonNotAuthorised,
+			"The job will be created once the console is authorised",
+		)
+	default:
+		setCondition(
+			workloadsv1alpha1.ConsoleJobCreatedCondition, false, workloadsv1alpha1.ReasonJobDeleted,
+			"The console's job has been deleted",
+		)
+	}
+
+	// Once the pod has gone, keep the last known scheduling state of the console
+	pod := statusCtx.Pod
+	existingScheduled := meta.FindStatusCondition(newStatus.Conditions, workloadsv1alpha1.ConsolePodScheduledCondition)
+	switch {
+	case pod != nil:
+		scheduled, reason, message := false, workloadsv1alpha1.ReasonPodPending, "Waiting for the pod to be scheduled"
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type != corev1.PodScheduled {
+				continue
+			}
+
+			scheduled = condition.Status == corev1.ConditionTrue
+			if scheduled {
+				reason, message = workloadsv1alpha1.ReasonPodScheduled, fmt.Sprintf("Pod %s has been scheduled", pod.Name)
+			}
+			if !scheduled && condition.Reason != "" {
+				reason, message = condition.Reason, condition.Message
+			}
+		}
+		setCondition(workloadsv1alpha1.ConsolePodScheduledCondition, scheduled, reason, message)
+	case existingScheduled == nil || newStatus.Phase == workloadsv1alpha1.ConsolePending:
+		setCondition(
+			workloadsv1alpha1.ConsolePodScheduledCondition, false, workloadsv1alpha1.ReasonPodNotCreated,
+			"Waiting for the console's pod to be created",
+		)
+	}
+
+	switch {
+	case newStatus.Phase == workloadsv1alpha1.ConsoleRunning:
+		setCondition(
+			workloadsv1alpha1.ConsoleReadyCondition, true, workloadsv1alpha1.ReasonRunning,
+			"The console is running",
+		)
+	case newStatus.Phase == workloadsv1alpha1.ConsoleStopped || newStatus.Phase == workloadsv1alpha1.ConsoleDestroyed:
+		message := "The console has stopped"
+		if newStatus.ExitCode != nil {
+			message = fmt.Sprintf("The console has stopped with exit code %d", *newStatus.ExitCode)
+		}
+		setCondition(workloadsv1alpha1.ConsoleReadyCondition, false, workloadsv1alpha1.ReasonStopped, message)
+	case pod != nil:
+		// Surface why the console container hasn't started, e.g. because its
+		// image can't be pulled
+		reason, message := workloadsv1alpha1.ReasonContainerNotReady, "Waiting for the console container to start"
+		if status := workloadsv1alpha1.ConsoleContainerStatus(pod); status != nil && status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			reason = status.State.Waiting.Reason
+			message = fmt.Sprintf("The console container is waiting: %s", status.State.Waiting.Reason)
+			if status.State.Waiting.Message != "" {
+				message = fmt.Sprintf("%s: %s", message, status.State.Waiting.Message)
+			}
+		}
+		setCondition(workloadsv1alpha1.ConsoleReadyCondition, false, reason, message)
+	default:
+		setCondition(
+			workloadsv1alpha1.ConsoleReadyCondition, false, workloadsv1alpha1.ReasonPodNotCreated,
+			"Waiting for the console's pod to be created",
+		)
+	}
+}
+
+// rejectionMessage describes who rejected the console and why.
+func rejectionMessage(auth *workloadsv1alpha1.ConsoleAuthorisation) string {
+	if auth == nil || len(auth.Spec.Rejections) == 0 {
+		return "The console has been rejected"
+	}
+
+	reasons := make([]string, 0, len(auth.Spec.Rejections))
+	for _, rejection := range auth.Spec.Rejections {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", rejection.Name, rejection.Reason))
+	}
+
+	return fmt.Sprintf("The console has been rejected by %s", strings.Join(reasons, ", "))
+}
+
 func (r *ConsoleReconciler) abort(ctx context.Context, logger logr.Logger, csl *workloadsv1alpha1.Console, job *batchv1.Job, podList *corev1.PodList) error {
 	// Delete job
 	if err := r.Client.Delete(ctx, job); err != nil {
@@ -684,7 +1292,7 @@ func (r *ConsoleReconciler) abort(ctx context.Context, logger logr.Logger, csl *
 	updatedCsl := csl.DeepCopy()
 	updatedCsl.Status = newStatus
 
-	if err := r.createOrUpdate(ctx, logger, csl, csl, Console, consoleDiff); err != nil {
+	if err := r.updateStatus(ctx, logger, updatedCsl); err != nil {
 		return err
 	}
 
@@ -697,20 +1305,24 @@ func (r *ConsoleReconciler) abort(ctx context.Context, logger logr.Logger, csl *
 }
 
 func calculatePhase(statusCtx consoleStatusContext) workloadsv1alpha1.ConsolePhase {
+	if statusCtx.IsRejected {
+		return workloadsv1alpha1.ConsoleRejected
+	}
+
 	if !statusCtx.IsAuthorised {
 		return workloadsv1alpha1.ConsolePendingAuthorisation
 	}
 
+	if statusCtx.IsQueued {
+		return workloadsv1alpha1.ConsoleQueued
+	}
+
 	if statusCtx.Job == nil {
 		return workloadsv1alpha1.ConsoleDestroyed
 	}
 
-	// Currently a job can only have two conditions: Complete and Failed
-	// Both indicate that the console has stopped
-	for _, c := range statusCtx.Job.Status.Conditions {
-		if c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed {
-			return workloadsv1alpha1.ConsoleStopped
-		}
+	if jobFinished(statusCtx.Job) {
+		return workloadsv1alpha1.ConsoleStopped
 	}
 
 	// If the pod exists and is running, then the console is running
@@ -865,8 +1477,8 @@ func (r *ConsoleReconciler) addSessionRecordingToPodTemplate(logger logr.Logger,
 	return mutatedTemplate
 }
 
-func (r *ConsoleReconciler) buildJob(logger logr.Logger, name types.NamespacedName, csl *workloadsv1alpha1.Console, template *workloadsv1alpha1.ConsoleTemplate) *batchv1.Job {
-	timeout := int64(csl.Spec.TimeoutSeconds)
+func (r *ConsoleReconciler) buildJob(logger logr.Logger, name types.NamespacedName, csl *workloadsv1alpha1.Console, template *workloadsv1alpha1.ConsoleTemplate, timeoutSeconds int) *batchv1.Job {
+	timeout := int64(timeoutSeconds)
 
 	username := strings.SplitN(csl.Spec.User, "@", 2)[0]
 	jobTemplate := template.Spec.Template.DeepCopy()
@@ -1029,6 +1641,23 @@ func buildUserRole(name types.NamespacedName, podName string) *rbacv1.Role {
 	}
 }
 
+func buildExtensionRole(name types.NamespacedName, consoleName string) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				Verbs:         []string{"get", "patch", "update"},
+				APIGroups:     []string{"workloads.crd.gocardless.com"},
+				Resources:     []string{"consoles"},
+				ResourceNames: []string{consoleName},
+			},
+		},
+	}
+}
+
 func buildUserDirectoryRoleBinding(name types.NamespacedName, role *rbacv1.Role, subjects []rbacv1.Subject) *rbacv1alpha1.DirectoryRoleBinding {
 	return &rbacv1alpha1.DirectoryRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1055,7 +1684,7 @@ func (r *ConsoleReconciler) createAuthorisationObjects(ctx context.Context, logg
 		},
 		Spec: workloadsv1alpha1.ConsoleAuthorisationSpec{
 			ConsoleRef:     corev1.LocalObjectReference{Name: name.Name},
-			Authorisations: []rbacv1.Subject{},
+			Authorisations: []workloadsv1alpha1.ConsoleAuthorisationEntry{},
 		},
 	}
 
@@ -1131,20 +1760,22 @@ func consoleDiff(expectedObj runtime.Object, existingObj runtime.Object) recutil
 	operation := recutil.None
 
 	// Because this controller is responsible for the Console object the diff
-	// calculation is simple: if any of the spec or status fields, or the
-	// controller reference, have changed then perform an update.
+	// calculation is simple: if any of the spec fields, or the controller
+	// reference, have changed then perform an update. The status is written
+	// separately, through the status subresource, by updateStatus.
 	if !reflect.DeepEqual(expected.ObjectMeta.OwnerReferences, existing.ObjectMeta.OwnerReferences) {
 		existing.ObjectMeta.OwnerReferences = expected.ObjectMeta.OwnerReferences
 		operation = recutil.Update
 	}
 
-	if !reflect.DeepEqual(expected.Spec, existing.Spec) {
-		existing.Spec = expected.Spec
-		operation = recutil.Update
-	}
+	// The timeout extensions are appended by the console owner while the
+	// console is running, so always preserve the existing value rather than
+	// risk overwriting an extension with a stale copy of the console.
+	expectedSpec := expected.Spec.DeepCopy()
+	expectedSpec.TimeoutExtensions = existing.Spec.TimeoutExtensions
 
-	if !reflect.DeepEqual(expected.Status, existing.Status) {
-		existing.Status = expected.Status
+	if !reflect.DeepEqual(*expectedSpec, existing.Spec) {
+		existing.Spec = *expectedSpec
 		operation = recutil.Update
 	}
 
@@ -1237,6 +1868,16 @@ func getAuditLogger(logger logr.Logger, consoleId string, c *workloadsv1alpha1.C
 
 		authorisers, _ := json.Marshal(subjectNames)
 		loggerCtx = loggerCtx.WithValues("console_authorisers", string(authorisers))
+
+		if len(statusCtx.Authorisation.Spec.Rejections) > 0 {
+			rejecterNames := []string{}
+			for _, rejection := range statusCtx.Authorisation.Spec.Rejections {
+				rejecterNames = append(rejecterNames, rejection.Name)
+			}
+
+			rejecters, _ := json.Marshal(rejecterNames)
+			loggerCtx = loggerCtx.WithValues("console_rejecters", string(rejecters))
+		}
 	}
 
 	return loggerCtx
@@ -8,16 +8,19 @@ import (
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	rbacv1alpha1 "github.com/gocardless/theatre/v5/api/rbac/v1alpha1"
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+	"github.com/gocardless/theatre/v5/pkg/workloads/console/notifier"
 )
 
 var _ = Describe("Console", func() {
@@ -172,6 +175,144 @@ var _ = Describe("Console", func() {
 		// test that here.
 	})
 
+	Describe("Extending the console timeout", func() {
+		var job *batchv1.Job
+
+		JustBeforeEach(func() {
+			mustCreateResources()
+
+			job = &batchv1.Job{}
+			Eventually(func() error {
+				identifier := client.ObjectKeyFromObject(csl)
+				identifier.Name += "-console"
+				return mgr.GetClient().Get(context.TODO(), identifier, job)
+			}).ShouldNot(HaveOccurred(),
+				"failed to find associated Job for Console")
+		})
+
+		Context("with an extension", func() {
+			BeforeEach(func() {
+				csl.Spec.TimeoutExtensions = []workloadsv1alpha1.ConsoleTimeoutExtension{
+					{Seconds: 1800, Reason: "need more time"},
+				}
+			})
+
+			It("Adds the extension to the job's ActiveDeadlineSeconds", func() {
+				Expect(*job.Spec.ActiveDeadlineSeconds).To(BeNumerically("==", 5400),
+					"job's ActiveDeadlineSeconds does not include the extension")
+			})
+		})
+
+		Context("with extensions beyond MaxTimeoutSeconds", func() {
+			BeforeEach(func() {
+				csl.Spec.TimeoutExtensions = []workloadsv1alpha1.ConsoleTimeoutExtension{
+					{Seconds: 3600}, {Seconds: 3600},
+				}
+			})
+
+			It("Enforces the console template's MaxTimeoutSeconds", func() {
+				Expect(*job.Spec.ActiveDeadlineSeconds).To(BeNumerically("==", 7200),
+					"job's ActiveDeadlineSeconds exceeds the template's MaxTimeoutSeconds")
+			})
+		})
+	})
+
+	Describe("Enforcing concurrency limits", func() {
+		var queuedCsl *workloadsv1alpha1.Console
+
+		BeforeEach(func() {
+			maxConcurrentConsoles := int32(1)
+			consoleTemplate.Spec.MaxConcurrentConsoles = &maxConcurrentConsoles
+
+			queuedCsl = csl.DeepCopy()
+			queuedCsl.Name = "console-1"
+		})
+
+		JustBeforeEach(func() {
+			mustCreateResources()
+
+			// Wait for the first console to take up the only slot
+			Eventually(func() workloadsv1alpha1.ConsolePhase {
+				mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+				return csl.Status.Phase
+			}).Should(Equal(workloadsv1alpha1.ConsolePending))
+
+			By("Creating a console beyond the limit")
+			Expect(mgr.GetClient().Create(context.TODO(), queuedCsl)).NotTo(
+				HaveOccurred(), "failed to create Console",
+			)
+		})
+
+		It("Queues the console without creating a job", func() {
+			Eventually(func() workloadsv1alpha1.ConsolePhase {
+				mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(queuedCsl), queuedCsl)
+				return queuedCsl.Status.Phase
+			}).Should(Equal(workloadsv1alpha1.ConsoleQueued))
+
+			Expect(queuedCsl.Status.Message).To(ContainSubstring("the maximum is 1"))
+
+			job := &batchv1.Job{}
+			identifier := client.ObjectKeyFromObject(queuedCsl)
+			identifier.Name += "-console"
+			err := mgr.GetClient().Get(context.TODO(), identifier, job)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), "expected no job for queued console")
+		})
+
+		It("Starts the queued console once the running console has gone", func() {
+			Expect(mgr.GetClient().Delete(context.TODO(), csl)).NotTo(HaveOccurred())
+
+			Eventually(func() workloadsv1alpha1.ConsolePhase {
+				mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(queuedCsl), queuedCsl)
+				return queuedCsl.Status.Phase
+			}, 30*time.Second).Should(Equal(workloadsv1alpha1.ConsolePending))
+		})
+	})
+
+	Describe("Enforcing concurrency limits on consoles created together", func() {
+		var otherCsl *workloadsv1alpha1.Console
+
+		BeforeEach(func() {
+			maxConcurrentConsoles := int32(1)
+			consoleTemplate.Spec.MaxConcurrentConsoles = &maxConcurrentConsoles
+
+			otherCsl = csl.DeepCopy()
+			otherCsl.Name = "console-1"
+		})
+
+		JustBeforeEach(func() {
+			mustCreateNamespace()
+
+			By("Creating console template")
+			Expect(mgr.GetClient().Create(context.TODO(), consoleTemplate)).NotTo(
+				HaveOccurred(), "failed to create Console Template",
+			)
+
+			By("Creating both consoles without waiting for either to start")
+			Expect(mgr.GetClient().Create(context.TODO(), csl)).NotTo(
+				HaveOccurred(), "failed to create Console",
+			)
+			Expect(mgr.GetClient().Create(context.TODO(), otherCsl)).NotTo(
+				HaveOccurred(), "failed to create Console",
+			)
+		})
+
+		It("Starts only one of them", func() {
+			phases := func() []workloadsv1alpha1.ConsolePhase {
+				mgr.GetAPIReader().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+				mgr.GetAPIReader().Get(context.TODO(), client.ObjectKeyFromObject(otherCsl), otherCsl)
+				return []workloadsv1alpha1.ConsolePhase{csl.Status.Phase, otherCsl.Status.Phase}
+			}
+			Eventually(phases).Should(ConsistOf(workloadsv1alpha1.ConsolePending, workloadsv1alpha1.ConsoleQueued))
+
+			countJobs := func() int {
+				jobs := &batchv1.JobList{}
+				Expect(mgr.GetAPIReader().List(context.TODO(), jobs, client.InNamespace(namespaceName))).To(Succeed())
+				return len(jobs.Items)
+			}
+			Consistently(countJobs, 5*time.Second).Should(Equal(1), "expected a job for only one console")
+		})
+	})
+
 	Describe("Creating resources", func() {
 		JustBeforeEach(func() {
 			mustCreateResources()
@@ -460,6 +601,27 @@ var _ = Describe("Console", func() {
 			)
 		})
 
+		It("Updates the status with conditions", func() {
+			updatedCsl := &workloadsv1alpha1.Console{}
+			identifier := client.ObjectKeyFromObject(csl)
+			Eventually(func() *metav1.Condition {
+				mgr.GetClient().Get(context.TODO(), identifier, updatedCsl)
+				return meta.FindStatusCondition(updatedCsl.Status.Conditions, workloadsv1alpha1.ConsoleJobCreatedCondition)
+			}).Should(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Status": Equal(metav1.ConditionTrue),
+			})), "the job created condition should be satisfied")
+
+			Expect(meta.IsStatusConditionTrue(updatedCsl.Status.Conditions, workloadsv1alpha1.ConsoleTemplateResolvedCondition)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(updatedCsl.Status.Conditions, workloadsv1alpha1.ConsoleAuthorisedCondition)).To(BeTrue())
+
+			By("Expect the console to be waiting for its pod")
+			Expect(updatedCsl.Status.FailingCondition().Reason).To(Equal(workloadsv1alpha1.ReasonPodNotCreated))
+			Expect(updatedCsl.Status.Message).To(Equal("Waiting for the console's pod to be created"))
+
+			By("Expect the observed generation to be recorded")
+			Expect(updatedCsl.Status.ObservedGeneration).To(Equal(updatedCsl.Generation))
+		})
+
 		It("Updates the status with completion time", func() {
 			updatedCsl := &workloadsv1alpha1.Console{}
 			identifier := client.ObjectKeyFromObject(csl)
@@ -652,9 +814,129 @@ var _ = Describe("Console", func() {
 						return apierrors.ReasonForError(err)
 					}, 10*time.Second).Should(Equal(metav1.StatusReasonNotFound), "expected not to find console, but did")
 				})
+
+				It("Notifies authorisers when the console is requested and when it expires", func() {
+					Eventually(func() []notifier.Event {
+						return notifications.For(csl.Namespace, csl.Name)
+					}, 10*time.Second).Should(Equal([]notifier.Event{notifier.EventRequest, notifier.EventExpired}))
+				})
+			})
+
+			Context("When the matching rule has clauses", func() {
+				BeforeEach(func() {
+					consoleTemplate.Spec.AuthorisationRules[1].ConsoleAuthorisers = workloadsv1alpha1.ConsoleAuthorisers{
+						AuthorisationsRequired: 2,
+						Subjects:               []rbacv1.Subject{},
+						Clauses: []workloadsv1alpha1.ConsoleAuthoriserClause{
+							{
+								Name:                   "sre",
+								AuthorisationsRequired: 1,
+								Subjects:               []rbacv1.Subject{{Kind: "GoogleGroup", Name: "sre@example.com"}},
+							},
+							{
+								Name:                   "payments-leads",
+								AuthorisationsRequired: 1,
+								Subjects:               []rbacv1.Subject{{Kind: "GoogleGroup", Name: "payments-leads@example.com"}},
+							},
+						},
+					}
+				})
+
+				It("Reports the outstanding clauses", func() {
+					Eventually(func() []workloadsv1alpha1.ConsoleOutstandingAuthorisation {
+						mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+						return csl.Status.OutstandingAuthorisations
+					}).Should(Equal([]workloadsv1alpha1.ConsoleOutstandingAuthorisation{
+						{Name: "sre", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+						{Name: "payments-leads", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+					}))
+
+					Expect(csl.Status.Message).To(Equal(
+						"Waiting for authorisation: 0 of 2 required authorisations given, still needed from sre (0 of 1), payments-leads (0 of 1)",
+					))
+				})
+
+				It("Records the request notification in the status", func() {
+					Eventually(func() string {
+						mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+						return csl.Status.LastNotification
+					}).Should(Equal(string(notifier.EventRequest)))
+
+					Consistently(func() []notifier.Event {
+						return notifications.For(csl.Namespace, csl.Name)
+					}, 2*time.Second).Should(Equal([]notifier.Event{notifier.EventRequest}))
+				})
+
+				It("Allows members of each clause to authorise", func() {
+					drb := &rbacv1alpha1.DirectoryRoleBinding{}
+					identifier := client.ObjectKeyFromObject(csl)
+					identifier.Name = fmt.Sprintf("%s-authorisation", identifier.Name)
+					Eventually(func() []rbacv1.Subject {
+						mgr.GetClient().Get(context.TODO(), identifier, drb)
+						return drb.Spec.Subjects
+					}).Should(ConsistOf(
+						rbacv1.Subject{Kind: "GoogleGroup", Name: "sre@example.com"},
+						rbacv1.Subject{Kind: "GoogleGroup", Name: "payments-leads@example.com"},
+					))
+				})
+
+				Context("When a clause names a native group", func() {
+					BeforeEach(func() {
+						consoleTemplate.Spec.AuthorisationRules[1].ConsoleAuthorisers = workloadsv1alpha1.ConsoleAuthorisers{
+							AuthorisationsRequired: 1,
+							Subjects:               []rbacv1.Subject{},
+							Clauses: []workloadsv1alpha1.ConsoleAuthoriserClause{
+								{
+									Name:                   "payments-leads",
+									AuthorisationsRequired: 1,
+									Subjects:               []rbacv1.Subject{{Kind: "Group", APIGroup: rbacv1.GroupName, Name: "payments-leads"}},
+								},
+							},
+						}
+					})
+
+					It("Counts authorisations from members of the group", func() {
+						auth := &workloadsv1alpha1.ConsoleAuthorisation{}
+						Eventually(func() error {
+							return authoriserClient.Get(context.TODO(), client.ObjectKeyFromObject(csl), auth)
+						}).ShouldNot(HaveOccurred(), "failed to find consoleauthorisation")
+
+						auth.Spec.Authorisations = append(auth.Spec.Authorisations, workloadsv1alpha1.ConsoleAuthorisationEntry{
+							Subject: rbacv1.Subject{Kind: "User", Name: "lead@example.com"},
+						})
+						Expect(authoriserClient.Update(context.TODO(), auth)).To(Succeed(), "could not authorise console")
+
+						Eventually(func() bool {
+							mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+							return meta.IsStatusConditionTrue(csl.Status.Conditions, workloadsv1alpha1.ConsoleAuthorisedCondition)
+						}).Should(BeTrue(), "the console should be authorised")
+
+						Expect(csl.Status.OutstandingAuthorisations).To(BeEmpty())
+					})
+				})
 			})
 		})
 	})
+	Describe("Referencing a template that does not exist", func() {
+		JustBeforeEach(func() {
+			mustCreateNamespace()
+
+			By("Creating console")
+			Expect(mgr.GetClient().Create(context.TODO(), csl)).NotTo(
+				HaveOccurred(), "failed to create Console",
+			)
+		})
+
+		It("Records that the template could not be resolved", func() {
+			Eventually(func() string {
+				mgr.GetClient().Get(context.TODO(), client.ObjectKeyFromObject(csl), csl)
+				return csl.Status.Message
+			}).Should(Equal("ConsoleTemplate console-template-0 does not exist"))
+
+			Expect(csl.Status.FailingCondition().Reason).To(Equal(workloadsv1alpha1.ReasonTemplateNotFound))
+		})
+	})
+
 	Describe("Enforcing job name", func() {
 		BeforeEach(func() {
 			consoleName = "very-very-very-very-long-long-long-long-name-very-very-very-very-long-long-long-long-name"
@@ -742,7 +1024,8 @@ var _ = Describe("Console", func() {
 				consoleTemplate.Spec.AuthorisationRules = []workloadsv1alpha1.ConsoleAuthorisationRule{
 					{
 						Name:                 "test",
-						MatchCommandElements: []string{"bash", "**", "abc"},
+						MatchCommandElements: []string{"bash", "re:(abc"},
+						MatcherSyntax:        workloadsv1alpha1.CommandMatcherSyntaxTyped,
 						ConsoleAuthorisers: workloadsv1alpha1.ConsoleAuthorisers{
 							Subjects: []rbacv1.Subject{},
 						},
@@ -751,7 +1034,82 @@ var _ = Describe("Console", func() {
 			})
 
 			It("rejects the template", func() {
-				Expect(createErr).To(MatchError(ContainSubstring("a double wildcard is only valid at the end of the pattern")))
+				Expect(createErr).To(MatchError(ContainSubstring(".spec.authorisationRules[0].matchCommandElements[1]: invalid regular expression")))
+			})
+		})
+
+		Context("when a clause names a kind of subject without a directory", func() {
+			BeforeEach(func() {
+				consoleTemplate.Spec.AuthorisationRules = []workloadsv1alpha1.ConsoleAuthorisationRule{
+					{
+						Name:                 "test",
+						MatchCommandElements: []string{"bash"},
+						ConsoleAuthorisers: workloadsv1alpha1.ConsoleAuthorisers{
+							AuthorisationsRequired: 1,
+							Subjects:               []rbacv1.Subject{},
+							Clauses: []workloadsv1alpha1.ConsoleAuthoriserClause{
+								{
+									Name:                   "leads",
+									AuthorisationsRequired: 1,
+									Subjects:               []rbacv1.Subject{{Kind: "OktaGroup", Name: "payments-leads@example.com"}},
+								},
+							},
+						},
+					},
+				}
+			})
+
+			It("rejects the template", func() {
+				Expect(createErr).To(MatchError(ContainSubstring(
+					".spec.authorisationRules[0].clauses[0].subjects[0]: the members of OktaGroup subjects can't be resolved by the workloads manager",
+				)))
+			})
+		})
+	})
+
+	Describe("Restricting console commands", func() {
+		var (
+			createErr error
+		)
+
+		BeforeEach(func() {
+			consoleTemplate.Spec.RestrictCommands = true
+			consoleTemplate.Spec.AuthorisationRules = []workloadsv1alpha1.ConsoleAuthorisationRule{
+				{
+					Name:                 "rails",
+					MatchCommandElements: []string{"bin/rails", "console", "**"},
+					ConsoleAuthorisers: workloadsv1alpha1.ConsoleAuthorisers{
+						Subjects: []rbacv1.Subject{},
+					},
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			mustCreateNamespace()
+
+			By("Creating console template")
+			Expect(mgr.GetClient().Create(context.TODO(), consoleTemplate)).NotTo(
+				HaveOccurred(), "failed to create Console Template",
+			)
+
+			By("Creating console")
+			createErr = mgr.GetClient().Create(context.TODO(), csl)
+		})
+
+		It("accepts a console with an allowed command", func() {
+			Expect(createErr).NotTo(HaveOccurred())
+		})
+
+		Context("with a command that isn't allowed", func() {
+			BeforeEach(func() {
+				csl.Spec.Command = []string{"bash"}
+			})
+
+			It("rejects the console with the allowed commands", func() {
+				Expect(createErr).To(MatchError(ContainSubstring(
+					`command "bash" is not allowed by console template console-template-0, which only allows commands matching: ["bin/rails", "console", "**"]`,
+				)))
 			})
 		})
 	})
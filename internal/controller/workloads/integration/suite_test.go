@@ -3,6 +3,7 @@ package integration
 import (
 	"context"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -21,16 +23,53 @@ import (
 
 	rbacv1alpha1 "github.com/gocardless/theatre/v5/api/rbac/v1alpha1"
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+	directoryrolebinding "github.com/gocardless/theatre/v5/internal/controller/rbac"
 	consolecontroller "github.com/gocardless/theatre/v5/internal/controller/workloads"
 	internalworkloadsv1alpha1 "github.com/gocardless/theatre/v5/internal/webhook/workloads/v1alpha1"
 	"github.com/gocardless/theatre/v5/pkg/workloads/console/events"
+	"github.com/gocardless/theatre/v5/pkg/workloads/console/notifier"
 )
 
 var (
-	mgr     ctrl.Manager
-	testEnv *envtest.Environment
+	mgr           ctrl.Manager
+	testEnv       *envtest.Environment
+	notifications = &recordingNotifier{}
+
+	// authoriserClient acts as lead@example.com, a member of the payments-leads
+	// group, who can authorise consoles created by the manager's client
+	authoriserClient client.Client
 )
 
+// recordingNotifier keeps the notifications sent by the controller, so tests can
+// check which were sent for their console
+type recordingNotifier struct {
+	sync.Mutex
+	notifications []notifier.Notification
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, n notifier.Notification) error {
+	r.Lock()
+	defer r.Unlock()
+	r.notifications = append(r.notifications, n)
+
+	return nil
+}
+
+// For returns the events that were notified for the console
+func (r *recordingNotifier) For(namespace, name string) []notifier.Event {
+	r.Lock()
+	defer r.Unlock()
+
+	notified := []notifier.Event{}
+	for _, n := range r.notifications {
+		if n.Namespace == namespace && n.Console == name {
+			notified = append(notified, n.Event)
+		}
+	}
+
+	return notified
+}
+
 func TestSuite(t *testing.T) {
 	SetDefaultEventuallyTimeout(3 * time.Second)
 	RegisterFailHandler(Fail)
@@ -64,6 +103,15 @@ var _ = BeforeSuite(func() {
 	err = workloadsv1alpha1.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	authoriser, err := testEnv.AddUser(envtest.User{
+		Name:   "lead@example.com",
+		Groups: []string{"system:masters", "payments-leads"},
+	}, &rest.Config{})
+	Expect(err).ToNot(HaveOccurred())
+
+	authoriserClient, err = client.New(authoriser.Config(), client.Options{Scheme: scheme})
+	Expect(err).ToNot(HaveOccurred())
+
 	idBuilder := workloadsv1alpha1.NewConsoleIdBuilder("test")
 	lifecycleRecorder := workloadsv1alpha1.NewLifecycleEventRecorder("test", ctrl.Log, events.NewNopPublisher(), idBuilder)
 
@@ -80,6 +128,11 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	// Recognise GoogleGroup subjects in authorisation rule clauses, as if the
+	// manager were run with --google
+	directories := directoryrolebinding.DirectoryProvider{}
+	directories.Register(rbacv1alpha1.GoogleGroupKind, directoryrolebinding.NewFakeDirectory(map[string][]string{}))
+
 	// console authenticator webhook
 	mgr.GetWebhookServer().Register("/mutate-consoles", &admission.Webhook{
 		Handler: internalworkloadsv1alpha1.NewConsoleAuthenticatorWebhook(
@@ -89,6 +142,14 @@ var _ = BeforeSuite(func() {
 		),
 	})
 
+	// console authorisation timestamp webhook
+	mgr.GetWebhookServer().Register("/mutate-consoleauthorisations", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleAuthorisationTimestampWebhook(
+			ctrl.Log.WithName("webhooks").WithName("console-authorisation-timestamp"),
+			mgr.GetScheme(),
+		),
+	})
+
 	// console authorisation webhook
 	mgr.GetWebhookServer().Register("/validate-consoleauthorisations", &admission.Webhook{
 		Handler: internalworkloadsv1alpha1.NewConsoleAuthorisationWebhook(
@@ -104,15 +165,36 @@ var _ = BeforeSuite(func() {
 		Handler: internalworkloadsv1alpha1.NewConsoleTemplateValidationWebhook(
 			ctrl.Log.WithName("webhooks").WithName("console-template"),
 			mgr.GetScheme(),
+			directories,
+		),
+	})
+
+	// console update webhook
+	mgr.GetWebhookServer().Register("/validate-consoles", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleUpdateWebhook(
+			ctrl.Log.WithName("webhooks").WithName("console-update"),
+			mgr.GetScheme(),
+		),
+	})
+
+	// console command validation webhook
+	mgr.GetWebhookServer().Register("/validate-console-commands", &admission.Webhook{
+		Handler: internalworkloadsv1alpha1.NewConsoleCommandValidationWebhook(
+			mgr.GetClient(),
+			ctrl.Log.WithName("webhooks").WithName("console-command-validation"),
+			mgr.GetScheme(),
 		),
 	})
 
 	err = (&consolecontroller.ConsoleReconciler{
 		Client:            mgr.GetClient(),
+		APIReader:         mgr.GetAPIReader(),
 		LifecycleRecorder: lifecycleRecorder,
 		Log:               ctrl.Log.WithName("controllers").WithName("console"),
 		Scheme:            mgr.GetScheme(),
 		ConsoleIdBuilder:  workloadsv1alpha1.NewConsoleIdBuilder("test"),
+		Notifier:          notifications,
+		Directories:       directories,
 	}).SetupWithManager(context.TODO(), mgr)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,469 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// ImageConfig is the part of an image's configuration that determines the process a
+// container runs when it doesn't set its own command.
+type ImageConfig struct {
+	Entrypoint []string `json:"Entrypoint"`
+	Cmd        []string `json:"Cmd"`
+}
+
+// ImageResolver looks up the configuration of a container image
+type ImageResolver interface {
+	Resolve(ctx context.Context, image string) (ImageConfig, error)
+}
+
+// PinningImageResolver can also pin an image to the digest of its manifest, which
+// identifies the image configuration even if the image's tag is later moved.
+type PinningImageResolver interface {
+	ImageResolver
+	Pin(ctx context.Context, image string) (string, error)
+}
+
+// Ensure each resolver implements the interface
+var _ PinningImageResolver = &registryResolver{}
+var _ ImageResolver = &cachedResolver{}
+
+const (
+	// DefaultRegistry is used for images that don't name a registry, as Docker does
+	DefaultRegistry = "registry-1.docker.io"
+	// DefaultImagePlatform is the platform we choose from multi-platform images
+	DefaultImagePlatform = "linux/amd64"
+)
+
+// DefaultRegistryHosts are the hosts we contact to resolve images from Docker Hub,
+// which issues tokens from a separate host and redirects blob downloads to its CDN.
+var DefaultRegistryHosts = []string{DefaultRegistry, "auth.docker.io", "production.cloudflare.docker.com"}
+
+// maxRegistryRedirects matches the limit of the default HTTP client
+const maxRegistryRedirects = 10
+
+// These are the manifest media types we know how to read. Indexes list a manifest per
+// platform, while manifests reference the image configuration.
+const (
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var manifestMediaTypes = []string{mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest}
+
+// maxRegistryResponseBytes limits how much we read from a registry, as manifests and
+// image configuration are small
+const maxRegistryResponseBytes = 4 << 20
+
+// registryManifest is either an index of manifests by platform, or a manifest that
+// references the image configuration
+type registryManifest struct {
+	MediaType string `json:"mediaType"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// NewRegistryResolver resolves image configuration from the registry that hosts each
+// image, using the manifest for the given platform from multi-platform images. Only
+// anonymous pulls are supported, so images in private registries must declare their
+// command with an annotation instead.
+//
+// Images are named by whoever creates a pod, so we only contact the given hosts, and
+// only over https. This applies to the registry itself, the realm it asks us to fetch
+// a token from, and any redirect it responds with. Hosts are matched by hostname, or by
+// hostname and port if a port is given.
+func NewRegistryResolver(client *http.Client, platform string, hosts []string) *registryResolver {
+	r := &registryResolver{
+		platform: platform,
+		hosts:    hosts,
+	}
+
+	// Copy the client so that our redirect policy doesn't apply to anyone else using it
+	restricted := *client
+	restricted.CheckRedirect = r.checkRedirect
+	r.client = &restricted
+
+	return r
+}
+
+type registryResolver struct {
+	client   *http.Client
+	platform string
+	hosts    []string
+}
+
+// allowed returns true if we may send requests to the host, which can include a port
+func (r *registryResolver) allowed(host string) bool {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+
+	for _, allowed := range r.hosts {
+		if allowed == host || allowed == hostname {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *registryResolver) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRegistryRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRegistryRedirects)
+	}
+	if req.URL.Scheme != "https" || !r.allowed(req.URL.Host) {
+		return fmt.Errorf("registry redirected to %s://%s, which is not an allowed registry host", req.URL.Scheme, req.URL.Host)
+	}
+
+	return nil
+}
+
+// imageReference identifies an image within a registry
+type imageReference struct {
+	registry   string
+	repository string
+	reference  string // tag or digest
+}
+
+// parseImageReference splits an image into its registry, repository and tag or
+// digest, applying the same defaults as Docker.
+func parseImageReference(image string) (imageReference, error) {
+	ref := imageReference{registry: DefaultRegistry, reference: "latest"}
+
+	// A digest takes precedence over any tag, as it's what the kubelet will pull
+	name, digest, hasDigest := strings.Cut(image, "@")
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		name, ref.reference = name[:idx], name[idx+1:]
+	}
+	if hasDigest {
+		ref.reference = digest
+	}
+
+	// The first component is a registry if it looks like a hostname
+	if idx := strings.Index(name, "/"); idx >= 0 {
+		if domain := name[:idx]; strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			ref.registry, name = domain, name[idx+1:]
+		}
+	}
+
+	if name == "" || ref.reference == "" {
+		return ref, fmt.Errorf("invalid image reference %q", image)
+	}
+
+	if ref.registry == "docker.io" || ref.registry == "index.docker.io" {
+		ref.registry = DefaultRegistry
+	}
+	if ref.registry == DefaultRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+
+	ref.repository = name
+
+	return ref, nil
+}
+
+// isDigest returns true if the reference is a digest rather than a tag, which can't
+// contain a colon
+func (ref imageReference) isDigest() bool {
+	return strings.Contains(ref.reference, ":")
+}
+
+// session starts a session with the registry hosting the image, provided it's one we
+// are allowed to contact
+func (r *registryResolver) session(image string) (*registrySession, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.allowed(ref.registry) {
+		return nil, fmt.Errorf("registry %s is not an allowed registry host", ref.registry)
+	}
+
+	return &registrySession{registryResolver: r, ref: ref}, nil
+}
+
+// Pin returns the image referenced by the digest of its manifest. Images that are
+// already referenced by digest are returned without contacting the registry.
+func (r *registryResolver) Pin(ctx context.Context, image string) (string, error) {
+	session, err := r.session(image)
+	if err != nil {
+		return "", err
+	}
+
+	ref := session.ref
+	if ref.isDigest() {
+		return fmt.Sprintf("%s/%s@%s", ref.registry, ref.repository, ref.reference), nil
+	}
+
+	// Registries return the digest in a header, so a HEAD request usually suffices. This
+	// also avoids counting towards the pull rate limits of registries such as Docker Hub.
+	_, header, err := session.fetch(ctx, http.MethodHead, "manifests/"+ref.reference, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+
+	digest := header.Get("Docker-Content-Digest")
+	if digest == "" {
+		body, _, err := session.fetch(ctx, http.MethodGet, "manifests/"+ref.reference, manifestMediaTypes)
+		if err != nil {
+			return "", err
+		}
+
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+
+	return fmt.Sprintf("%s/%s@%s", ref.registry, ref.repository, digest), nil
+}
+
+func (r *registryResolver) Resolve(ctx context.Context, image string) (ImageConfig, error) {
+	session, err := r.session(image)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	ref := session.ref
+
+	var manifest registryManifest
+	if err := session.get(ctx, "manifests/"+ref.reference, manifestMediaTypes, &manifest); err != nil {
+		return ImageConfig{}, err
+	}
+
+	if manifest.MediaType == mediaTypeOCIIndex || manifest.MediaType == mediaTypeDockerList || len(manifest.Manifests) > 0 {
+		digest := ""
+		for _, m := range manifest.Manifests {
+			platform := m.Platform.OS + "/" + m.Platform.Architecture
+			if platform == r.platform || (m.Platform.Variant != "" && platform+"/"+m.Platform.Variant == r.platform) {
+				digest = m.Digest
+				break
+			}
+		}
+		if digest == "" {
+			return ImageConfig{}, fmt.Errorf("image %s has no manifest for platform %s", image, r.platform)
+		}
+
+		manifest = registryManifest{}
+		if err := session.get(ctx, "manifests/"+digest, manifestMediaTypes, &manifest); err != nil {
+			return ImageConfig{}, err
+		}
+	}
+
+	if manifest.Config.Digest == "" {
+		return ImageConfig{}, fmt.Errorf("manifest for image %s has no config", image)
+	}
+
+	var config struct {
+		Config ImageConfig `json:"config"`
+	}
+	if err := session.get(ctx, "blobs/"+manifest.Config.Digest, nil, &config); err != nil {
+		return ImageConfig{}, err
+	}
+
+	return config.Config, nil
+}
+
+// registrySession makes requests for a single repository, holding any token issued by
+// the registry for it.
+type registrySession struct {
+	*registryResolver
+	ref   imageReference
+	token string
+}
+
+func (s *registrySession) get(ctx context.Context, resource string, accept []string, v interface{}) error {
+	body, _, err := s.fetch(ctx, http.MethodGet, resource, accept)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(json.Unmarshal(body, v), "failed to decode response from registry %s", s.ref.registry)
+}
+
+// fetch requests the resource from the repository, returning the body and headers of
+// the response
+func (s *registrySession) fetch(ctx context.Context, method, resource string, accept []string) ([]byte, http.Header, error) {
+	target := fmt.Sprintf("https://%s/v2/%s/%s", s.ref.registry, s.ref.repository, resource)
+
+	resp, err := s.do(ctx, method, target, accept)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Registries that permit anonymous pulls still require a token, which we request
+	// from the realm they direct us to before trying again
+	if resp.StatusCode == http.StatusUnauthorized && s.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if s.token, err = s.authenticate(ctx, challenge); err != nil {
+			return nil, nil, err
+		}
+		if resp, err = s.do(ctx, method, target, accept); err != nil {
+			return nil, nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("registry %s responded to %s with status %d", s.ref.registry, target, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRegistryResponseBytes))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read response from registry %s", s.ref.registry)
+	}
+
+	return body, resp.Header, nil
+}
+
+func (s *registrySession) do(ctx context.Context, method, target string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query registry %s", s.ref.registry)
+	}
+
+	return resp, nil
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authenticate requests an anonymous pull token for the repository, following the
+// Bearer challenge returned by the registry. The realm is chosen by the registry, so
+// we hold it to the same restrictions as the registry itself.
+func (s *registrySession) authenticate(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("registry %s requires authentication", s.ref.registry)
+	}
+
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry %s returned an invalid authentication challenge", s.ref.registry)
+	}
+
+	if realm.Scheme != "https" || (realm.Host != s.ref.registry && !s.allowed(realm.Host)) {
+		return "", fmt.Errorf("registry %s returned an authentication realm of %s://%s, which is not an allowed registry host", s.ref.registry, realm.Scheme, realm.Host)
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", s.ref.repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to request token for registry %s", s.ref.registry)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s refused anonymous access to %s", s.ref.registry, s.ref.repository)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponseBytes)).Decode(&token); err != nil {
+		return "", errors.Wrapf(err, "failed to decode token for registry %s", s.ref.registry)
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
+
+// NewCachedImageResolver wraps the given resolver so that we cache image configuration
+// for the given TTL. We receive a request for every pod created in an injected
+// namespace, and would otherwise query the registry for each of them.
+//
+// Configuration is cached by the digest of the image's manifest, so that we return the
+// configuration of the image the kubelet will pull even if its tag has been moved. This
+// means tagged images still require a request to the registry, but a cheap one. We keep
+// at most size images, evicting the least recently used.
+func NewCachedImageResolver(logger logr.Logger, resolver PinningImageResolver, ttl time.Duration, size int) *cachedResolver {
+	return &cachedResolver{
+		logger:   logger,
+		resolver: resolver,
+		ttl:      ttl,
+		cache:    cache.NewLRUExpireCache(size),
+	}
+}
+
+type cachedResolver struct {
+	logger   logr.Logger
+	resolver PinningImageResolver
+	ttl      time.Duration
+	cache    *cache.LRUExpireCache
+}
+
+func (r *cachedResolver) Resolve(ctx context.Context, image string) (ImageConfig, error) {
+	pinned, err := r.resolver.Pin(ctx, image)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	if config, ok := r.cache.Get(pinned); ok {
+		return config.(ImageConfig), nil
+	}
+
+	config, err := r.resolver.Resolve(ctx, pinned)
+	if err != nil {
+		return config, err
+	}
+
+	r.logger.Info("cached image config", "event", "cache.add", "image", image, "pinned", pinned)
+	r.cache.Add(pinned, config, r.ttl)
+
+	return config, nil
+}
@@ -0,0 +1,343 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parseImageReference", func() {
+	It("applies Docker defaults", func() {
+		for image, expected := range map[string]imageReference{
+			"nginx":                                {registry: DefaultRegistry, repository: "library/nginx", reference: "latest"},
+			"gocardless/theatre:v5":                {registry: DefaultRegistry, repository: "gocardless/theatre", reference: "v5"},
+			"docker.io/nginx:1.25":                 {registry: DefaultRegistry, repository: "library/nginx", reference: "1.25"},
+			"eu.gcr.io/project/app:abc":            {registry: "eu.gcr.io", repository: "project/app", reference: "abc"},
+			"localhost:5000/app":                   {registry: "localhost:5000", repository: "app", reference: "latest"},
+			"eu.gcr.io/project/app:abc@sha256:123": {registry: "eu.gcr.io", repository: "project/app", reference: "sha256:123"},
+		} {
+			ref, err := parseImageReference(image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ref).To(Equal(expected), image)
+		}
+	})
+
+	It("rejects references without a repository", func() {
+		_, err := parseImageReference(":latest")
+		Expect(err).To(MatchError(ContainSubstring("invalid image reference")))
+	})
+})
+
+var _ = Describe("registryResolver", func() {
+	var (
+		server   *httptest.Server
+		host     string
+		requests []string
+		platform string
+		hosts    []string
+		realm    string
+		resolver *registryResolver
+	)
+
+	BeforeEach(func() {
+		requests = []string{}
+		platform = DefaultImagePlatform
+		realm = ""
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("scope")).To(Equal("repository:team/app:pull"))
+			Expect(r.URL.Query().Get("service")).To(Equal("registry.test"))
+			json.NewEncoder(w).Encode(map[string]string{"token": "anonymous"})
+		})
+		mux.HandleFunc("/v2/team/app/", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if r.Header.Get("Authorization") != "Bearer anonymous" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry.test"`, realm))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch strings.TrimPrefix(r.URL.Path, "/v2/team/app/") {
+			case "manifests/v1", "manifests/sha256:index":
+				Expect(r.Header.Get("Accept")).To(ContainSubstring(mediaTypeOCIIndex))
+				w.Header().Set("Docker-Content-Digest", "sha256:index")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"mediaType": mediaTypeOCIIndex,
+					"manifests": []map[string]interface{}{
+						{"digest": "sha256:arm", "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+						{"digest": "sha256:amd", "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+					},
+				})
+			case "manifests/v2":
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"mediaType": mediaTypeOCIManifest,
+					"config":    map[string]string{"digest": "sha256:elsewhere"},
+				})
+			case "manifests/sha256:amd":
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"mediaType": mediaTypeOCIManifest,
+					"config":    map[string]string{"digest": "sha256:config"},
+				})
+			case "blobs/sha256:config":
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"architecture": "amd64",
+					"config":       map[string]interface{}{"Entrypoint": []string{"/app"}, "Cmd": []string{"serve"}},
+				})
+			case "blobs/sha256:elsewhere":
+				http.Redirect(w, r, "https://blobs.example.com/config", http.StatusTemporaryRedirect)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		server = httptest.NewTLSServer(mux)
+		host = strings.TrimPrefix(server.URL, "https://")
+		hosts = []string{host}
+		realm = server.URL + "/token"
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		resolver = NewRegistryResolver(server.Client(), platform, hosts)
+	})
+
+	Describe("Resolve", func() {
+		var (
+			image  string
+			config ImageConfig
+			err    error
+		)
+
+		BeforeEach(func() {
+			image = host + "/team/app:v1"
+		})
+
+		JustBeforeEach(func() {
+			config, err = resolver.Resolve(context.TODO(), image)
+		})
+
+		It("resolves the configuration of the image for the platform", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(ImageConfig{Entrypoint: []string{"/app"}, Cmd: []string{"serve"}}))
+		})
+
+		It("authenticates once per lookup", func() {
+			Expect(requests).To(Equal([]string{
+				"GET /v2/team/app/manifests/v1",
+				"GET /v2/team/app/manifests/v1",
+				"GET /v2/team/app/manifests/sha256:amd",
+				"GET /v2/team/app/blobs/sha256:config",
+			}))
+		})
+
+		Context("When the image has no manifest for the platform", func() {
+			BeforeEach(func() {
+				platform = "windows/amd64"
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("has no manifest for platform windows/amd64")))
+			})
+		})
+
+		Context("When the registry is not allowed", func() {
+			BeforeEach(func() {
+				hosts = []string{"registry.example.com"}
+			})
+
+			It("returns an error without contacting the registry", func() {
+				Expect(err).To(MatchError(fmt.Sprintf("registry %s is not an allowed registry host", host)))
+				Expect(requests).To(BeEmpty())
+			})
+		})
+
+		Context("When the realm is on a host that is not allowed", func() {
+			BeforeEach(func() {
+				realm = "https://169.254.169.254/token"
+			})
+
+			It("returns an error without requesting a token", func() {
+				Expect(err).To(MatchError(ContainSubstring("returned an authentication realm of https://169.254.169.254, which is not an allowed registry host")))
+			})
+		})
+
+		Context("When the realm is not https", func() {
+			BeforeEach(func() {
+				realm = "http://" + host + "/token"
+			})
+
+			It("returns an error without requesting a token", func() {
+				Expect(err).To(MatchError(ContainSubstring("returned an authentication realm of http://")))
+			})
+		})
+
+		Context("When the registry redirects to a host that is not allowed", func() {
+			BeforeEach(func() {
+				image = host + "/team/app:v2"
+			})
+
+			It("returns an error without following the redirect", func() {
+				Expect(err).To(MatchError(ContainSubstring("registry redirected to https://blobs.example.com, which is not an allowed registry host")))
+			})
+		})
+	})
+
+	Describe("Pin", func() {
+		var (
+			image  string
+			pinned string
+			err    error
+		)
+
+		BeforeEach(func() {
+			image = host + "/team/app:v1"
+		})
+
+		JustBeforeEach(func() {
+			pinned, err = resolver.Pin(context.TODO(), image)
+		})
+
+		It("pins the image to the digest of its manifest", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal(host + "/team/app@sha256:index"))
+			Expect(requests).To(Equal([]string{
+				"HEAD /v2/team/app/manifests/v1",
+				"HEAD /v2/team/app/manifests/v1",
+			}))
+		})
+
+		It("can be resolved", func() {
+			config, err := resolver.Resolve(context.TODO(), pinned)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Entrypoint).To(Equal([]string{"/app"}))
+		})
+
+		Context("When the registry doesn't return the digest", func() {
+			BeforeEach(func() {
+				image = host + "/team/app:v2"
+			})
+
+			It("pins the image to the digest of the manifest it returns", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pinned).To(MatchRegexp(`^%s/team/app@sha256:[0-9a-f]{64}$`, regexp.QuoteMeta(host)))
+			})
+		})
+
+		Context("When the image is referenced by digest", func() {
+			BeforeEach(func() {
+				image = host + "/team/app:v1@sha256:abc"
+			})
+
+			It("returns it without contacting the registry", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pinned).To(Equal(host + "/team/app@sha256:abc"))
+				Expect(requests).To(BeEmpty())
+			})
+		})
+	})
+})
+
+var _ = Describe("cachedResolver", func() {
+	var (
+		resolver *countingImageResolver
+		cached   *cachedResolver
+		clock    *fakeClock
+	)
+
+	BeforeEach(func() {
+		clock = &fakeClock{now: time.Now()}
+		resolver = &countingImageResolver{
+			fakeImageResolver: fakeImageResolver{configs: map[string]ImageConfig{
+				"app@sha256:one":   {Entrypoint: []string{"/app"}},
+				"app@sha256:two":   {Entrypoint: []string{"/app", "--retagged"}},
+				"other@sha256:one": {Entrypoint: []string{"/other"}},
+			}},
+			digests: map[string]string{"app:v1": "app@sha256:one", "other:v1": "other@sha256:one"},
+		}
+		cached = NewCachedImageResolver(logr.Discard(), resolver, time.Minute, 1)
+		cached.cache = cache.NewLRUExpireCacheWithClock(1, clock)
+	})
+
+	It("caches image configuration for the TTL", func() {
+		for range 2 {
+			config, err := cached.Resolve(context.TODO(), "app:v1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Entrypoint).To(Equal([]string{"/app"}))
+		}
+		Expect(resolver.calls).To(Equal(1))
+
+		clock.now = clock.now.Add(2 * time.Minute)
+		_, err := cached.Resolve(context.TODO(), "app:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolver.calls).To(Equal(2))
+	})
+
+	It("resolves images again when their tag is moved", func() {
+		_, err := cached.Resolve(context.TODO(), "app:v1")
+		Expect(err).NotTo(HaveOccurred())
+
+		resolver.digests["app:v1"] = "app@sha256:two"
+		config, err := cached.Resolve(context.TODO(), "app:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Entrypoint).To(Equal([]string{"/app", "--retagged"}))
+		Expect(resolver.calls).To(Equal(2))
+	})
+
+	It("evicts the least recently used image when full", func() {
+		for _, image := range []string{"app:v1", "other:v1", "app:v1"} {
+			_, err := cached.Resolve(context.TODO(), image)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(resolver.calls).To(Equal(3))
+	})
+
+	It("doesn't cache failures", func() {
+		for range 2 {
+			_, err := cached.Resolve(context.TODO(), "missing:v1")
+			Expect(err).To(HaveOccurred())
+		}
+		Expect(resolver.calls).To(Equal(2))
+	})
+})
+
+type countingImageResolver struct {
+	fakeImageResolver
+	digests map[string]string
+	calls   int
+}
+
+func (r *countingImageResolver) Pin(ctx context.Context, image string) (string, error) {
+	if pinned, ok := r.digests[image]; ok {
+		return pinned, nil
+	}
+
+	return image, nil
+}
+
+func (r *countingImageResolver) Resolve(ctx context.Context, image string) (ImageConfig, error) {
+	r.calls++
+	return r.fakeImageResolver.Resolve(ctx, image)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,201 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"gomodules.xyz/jsonpatch/v2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PreviewRequest asks how the secrets injector would mutate a pod. If no ConfigMap is
+// given, the vault config from the cluster is used.
+type PreviewRequest struct {
+	Pod       corev1.Pod        `json:"pod"`
+	ConfigMap *corev1.ConfigMap `json:"configMap,omitempty"`
+}
+
+// PreviewResponse describes the outcome of admitting a pod, without creating it. Pods
+// that aren't allowed give the reason they would be rejected, while allowed pods that
+// are mutated include both the mutated pod and the patch the webhook would respond with.
+type PreviewResponse struct {
+	Allowed bool                           `json:"allowed"`
+	Mutated bool                           `json:"mutated"`
+	Reason  string                         `json:"reason,omitempty"`
+	Pod     *corev1.Pod                    `json:"pod,omitempty"`
+	Patch   []jsonpatch.JsonPatchOperation `json:"patch,omitempty"`
+}
+
+// Preview runs the secrets injector against a pod and vault config, returning what
+// would happen if the pod were created. This lets engineers check how their pods are
+// injected without a cluster. An error is only returned if the vault config is invalid,
+// as the webhook would fail rather than reject the pod.
+func Preview(ctx context.Context, pod corev1.Pod, cfgmap *corev1.ConfigMap, opts SecretsInjectorOptions) (PreviewResponse, error) {
+	if _, ok := getFQDNConfig(pod.Annotations, FQDNArray); !ok {
+		return PreviewResponse{Allowed: true, Reason: "no annotation found"}, nil
+	}
+
+	vaultConfig, err := newVaultConfig(cfgmap)
+	if err != nil {
+		return PreviewResponse{}, fmt.Errorf("invalid vault config: %w", err)
+	}
+
+	mutatedPod, err := podInjector{SecretsInjectorOptions: opts, vaultConfig: vaultConfig}.Inject(ctx, pod)
+	if err != nil {
+		return PreviewResponse{Reason: err.Error()}, nil
+	}
+
+	podBytes, err := json.Marshal(pod)
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+	mutatedPodBytes, err := json.Marshal(mutatedPod)
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+
+	resp := admission.PatchResponseFromRaw(podBytes, mutatedPodBytes)
+	if resp.Result != nil && resp.Result.Code != http.StatusOK {
+		return PreviewResponse{}, fmt.Errorf("failed to generate patch: %s", resp.Result.Message)
+	}
+
+	return PreviewResponse{Allowed: true, Mutated: true, Pod: mutatedPod, Patch: resp.Patches}, nil
+}
+
+// NewPreviewHandler serves previews of the secrets injector over HTTP, accepting a
+// PreviewRequest as the body of a POST.
+//
+// Previews reveal the vault config and may query registries, so requests must bear the
+// token of a user or service account, which we review with the API server. Users can
+// only preview pods that they would be allowed to create.
+func NewPreviewHandler(c client.Client, logger logr.Logger, opts SecretsInjectorOptions) http.Handler {
+	return &previewHandler{client: c, logger: logger, opts: opts}
+}
+
+type previewHandler struct {
+	client client.Client
+	logger logr.Logger
+	opts   SecretsInjectorOptions
+}
+
+func (h *previewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "previews must be requested with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := h.authenticate(r)
+	if err != nil {
+		h.logger.Error(err, "failed to review token")
+		http.Error(w, "failed to authenticate request", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "previews must be requested with a valid bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	var req PreviewRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid preview request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := h.authorise(r, user, req.Pod)
+	if err != nil {
+		h.logger.Error(err, "failed to review access", "user", user.Username)
+		http.Error(w, "failed to authorise request", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("user %s cannot create pods in namespace %q", user.Username, req.Pod.Namespace), http.StatusForbidden)
+		return
+	}
+
+	if req.ConfigMap == nil {
+		req.ConfigMap = &corev1.ConfigMap{}
+		if err := h.client.Get(r.Context(), h.opts.VaultConfigMapKey, req.ConfigMap); err != nil {
+			h.logger.Info("vault config error", "event", "vault.config", "error", err)
+			http.Error(w, fmt.Sprintf("failed to get vault config: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp, err := Preview(r.Context(), req.Pod, req.ConfigMap, h.opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info(
+		"previewed pod",
+		"event", "pod.preview",
+		"user", user.Username,
+		"pod_namespace", req.Pod.Namespace,
+		"pod_name", req.Pod.Name,
+		"allowed", resp.Allowed,
+		"mutated", resp.Mutated,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error(err, "failed to write preview response")
+	}
+}
+
+// authenticate reviews the bearer token of the request, returning the user it belongs
+// to, or nil if the token is missing or invalid.
+func (h *previewHandler) authenticate(r *http.Request) (*authenticationv1.UserInfo, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, nil
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	if err := h.client.Create(r.Context(), review); err != nil {
+		return nil, err
+	}
+
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+
+	return &review.Status.User, nil
+}
+
+// authorise checks whether the user could create the pod
+func (h *previewHandler) authorise(r *http.Request, user *authenticationv1.UserInfo, pod corev1.Pod) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: pod.Namespace,
+				Verb:      "create",
+				Resource:  "pods",
+			},
+		},
+	}
+	if err := h.client.Create(r.Context(), review); err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,202 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("Preview", func() {
+	var (
+		fixture *corev1.Pod
+		cfgmap  *corev1.ConfigMap
+		opts    SecretsInjectorOptions
+		resp    PreviewResponse
+		err     error
+	)
+
+	BeforeEach(func() {
+		fixture = mustPodFixture("./testdata/app_no_config_pod.yaml")
+		cfgmap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "vault-system", Name: "vault-config"},
+			Data: map[string]string{
+				"address":                  "https://vault.example.com",
+				"auth_mount_path":          "kubernetes",
+				"auth_role":                "default",
+				"secret_mount_path_prefix": "secret/data/kubernetes",
+			},
+		}
+		opts = SecretsInjectorOptions{
+			Image:                     "theatre:latest",
+			InstallPath:               "/var/run/theatre-secrets",
+			VaultConfigMapKey:         client.ObjectKey{Namespace: "vault-system", Name: "vault-config"},
+			ServiceAccountTokenFile:   "/var/run/secrets/kubernetes.io/vault/token",
+			ServiceAccountTokenExpiry: 15 * time.Minute,
+			Timeout:                   10 * time.Second,
+		}
+	})
+
+	JustBeforeEach(func() {
+		resp, err = Preview(context.TODO(), *fixture, cfgmap, opts)
+	})
+
+	It("Returns the mutated pod and the patch", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Mutated).To(BeTrue())
+		Expect(resp.Pod.Spec.InitContainers).To(HaveLen(1))
+		Expect(resp.Patch).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Operation": Equal("add"),
+			"Path":      Equal("/spec/initContainers"),
+		})))
+	})
+
+	Context("With a pod that isn't annotated", func() {
+		BeforeEach(func() {
+			fixture = mustPodFixture("./testdata/no_annotations_pod.yaml")
+		})
+
+		It("Allows the pod without mutating it", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(Equal(PreviewResponse{Allowed: true, Reason: "no annotation found"}))
+		})
+	})
+
+	Context("With a pod that would be rejected", func() {
+		BeforeEach(func() {
+			fixture.Annotations[AuthMethodAnnotation] = "ldap"
+		})
+
+		It("Gives the reason", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Reason).To(ContainSubstring(`unsupported auth method "ldap"`))
+		})
+	})
+
+	Context("With an invalid vault config", func() {
+		BeforeEach(func() {
+			cfgmap.Data["max_timeout"] = "forever"
+		})
+
+		It("Returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring("invalid vault config")))
+		})
+	})
+
+	Describe("NewPreviewHandler", func() {
+		var (
+			body     PreviewRequest
+			token    string
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			body = PreviewRequest{Pod: *fixture}
+			token = "alice-token"
+		})
+
+		JustBeforeEach(func() {
+			// Only alice's token is valid, and she can only create pods in staging
+			c := fake.NewClientBuilder().WithObjects(cfgmap).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					switch review := obj.(type) {
+					case *authenticationv1.TokenReview:
+						if review.Spec.Token == "alice-token" {
+							review.Status.Authenticated = true
+							review.Status.User = authenticationv1.UserInfo{Username: "alice@example.com"}
+						}
+					case *authorizationv1.SubjectAccessReview:
+						attrs := review.Spec.ResourceAttributes
+						review.Status.Allowed = review.Spec.User == "alice@example.com" &&
+							attrs.Namespace == "staging" && attrs.Verb == "create" && attrs.Resource == "pods"
+					default:
+						return c.Create(ctx, obj, opts...)
+					}
+
+					return nil
+				},
+			}).Build()
+			handler := NewPreviewHandler(c, logr.Discard(), opts)
+
+			payload, _ := json.Marshal(body)
+			req := httptest.NewRequest(http.MethodPost, "/preview-pods", bytes.NewReader(payload))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+		})
+
+		It("Previews the pod against the vault config from the cluster", func() {
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var resp PreviewResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Mutated).To(BeTrue())
+			Expect(resp.Pod.Spec.Containers[0].Args).To(ContainElements("--vault-address", "https://vault.example.com"))
+		})
+
+		Context("With a vault config in the request", func() {
+			BeforeEach(func() {
+				override := cfgmap.DeepCopy()
+				override.Data["address"] = "https://vault.staging.example.com"
+				body.ConfigMap = override
+			})
+
+			It("Uses the given vault config", func() {
+				var resp PreviewResponse
+				Expect(json.Unmarshal(recorder.Body.Bytes(), &resp)).To(Succeed())
+				Expect(resp.Pod.Spec.Containers[0].Args).To(ContainElements("--vault-address", "https://vault.staging.example.com"))
+			})
+		})
+
+		Context("Without a token", func() {
+			BeforeEach(func() {
+				token = ""
+			})
+
+			It("Rejects the request as unauthenticated", func() {
+				Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("With an invalid token", func() {
+			BeforeEach(func() {
+				token = "mallory-token"
+			})
+
+			It("Rejects the request as unauthenticated", func() {
+				Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("With a pod the user can't create", func() {
+			BeforeEach(func() {
+				body.Pod.Namespace = "production"
+			})
+
+			It("Rejects the request as forbidden", func() {
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+				Expect(recorder.Body.String()).To(ContainSubstring(`user alice@example.com cannot create pods in namespace "production"`))
+			})
+		})
+	})
+})
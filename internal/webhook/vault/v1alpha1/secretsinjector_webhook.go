@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gocardless/theatre/v5/pkg/secrets"
 )
 
 const SecretsInjectorFQDN = "secrets-injector.vault.crd.gocardless.com"
@@ -25,6 +28,32 @@ const EnvconsulInjectorFQDN = "envconsul-injector.vault.crd.gocardless.com"
 
 var FQDNArray = []string{SecretsInjectorFQDN, EnvconsulInjectorFQDN}
 
+// Annotations that configure how theatre-secrets authenticates with Vault. These are only
+// supported on the secrets-injector FQDN.
+var (
+	AuthMethodAnnotation          = fmt.Sprintf("%s/auth-method", SecretsInjectorFQDN)
+	JWTFileAnnotation             = fmt.Sprintf("%s/jwt-file", SecretsInjectorFQDN)
+	AppRoleRoleIDAnnotation       = fmt.Sprintf("%s/approle-role-id", SecretsInjectorFQDN)
+	AppRoleSecretIDFileAnnotation = fmt.Sprintf("%s/approle-secret-id-file", SecretsInjectorFQDN)
+	AgentTokenFileAnnotation      = fmt.Sprintf("%s/agent-token-file", SecretsInjectorFQDN)
+)
+
+// Annotations that override our Vault config for a single pod. Other than debug, each
+// override must be permitted by the allow-lists in the vault config ConfigMap.
+var (
+	RoleAnnotation          = fmt.Sprintf("%s/role", SecretsInjectorFQDN)
+	AuthMountPathAnnotation = fmt.Sprintf("%s/auth-mount-path", SecretsInjectorFQDN)
+	PathPrefixAnnotation    = fmt.Sprintf("%s/path-prefix", SecretsInjectorFQDN)
+	TimeoutAnnotation       = fmt.Sprintf("%s/timeout", SecretsInjectorFQDN)
+	DebugAnnotation         = fmt.Sprintf("%s/debug", SecretsInjectorFQDN)
+)
+
+// CommandAnnotationPrefix is suffixed with a container name to give the command of a
+// container that relies on its image's entrypoint, as a JSON array:
+//
+//	secrets-injector.vault.crd.gocardless.com/command.app: '["bundle", "exec", "puma"]'
+var CommandAnnotationPrefix = fmt.Sprintf("%s/command.", SecretsInjectorFQDN)
+
 type SecretsInjector struct {
 	client  client.Client
 	logger  logr.Logger
@@ -52,6 +81,8 @@ type SecretsInjectorOptions struct {
 	ServiceAccountTokenAudience string           // optional token audience
 	Timeout                     time.Duration    // timeout to use when reading secrets from Vault
 	Debug                       bool             // whether to enable debug mode for verbose loggging
+	ImageResolver               ImageResolver    // optional, resolves the entrypoint of containers without a command
+	ImageResolverTimeout        time.Duration    // optional, limits the time spent resolving the images of a pod
 }
 
 var (
@@ -152,7 +183,11 @@ func (i *SecretsInjector) Handle(ctx context.Context, req admission.Request) (re
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
-	mutatedPod := podInjector{SecretsInjectorOptions: i.opts, vaultConfig: vaultConfig}.Inject(*pod)
+	mutatedPod, err := podInjector{SecretsInjectorOptions: i.opts, vaultConfig: vaultConfig}.Inject(ctx, *pod)
+	if err != nil {
+		logger.Info("invalid pod annotations", "event", "pod.invalid", "error", err)
+		return admission.Denied(err.Error())
+	}
 	if mutatedPod == nil {
 		logger.Info("no annotation found during inject - this should never occur", "event", "pod.skipped", "msg")
 		return admission.Allowed("no annotation found")
@@ -170,16 +205,44 @@ func (i *SecretsInjector) Handle(ctx context.Context, req admission.Request) (re
 // backend in Vault.
 //
 // If we can't parse the configmap into this structure, we should fail our webhook.
+//
+// The allowed_* keys are comma-separated lists of the values pods may choose with
+// override annotations, where * permits any value. Overrides are rejected unless
+// permitted, as are timeouts longer than max_timeout.
 type vaultConfig struct {
-	Address               string `mapstructure:"address"`
-	AuthMountPath         string `mapstructure:"auth_mount_path"`
-	AuthRole              string `mapstructure:"auth_role"`
-	SecretMountPathPrefix string `mapstructure:"secret_mount_path_prefix"`
+	Address                        string        `mapstructure:"address"`
+	AuthMountPath                  string        `mapstructure:"auth_mount_path"`
+	AuthRole                       string        `mapstructure:"auth_role"`
+	SecretMountPathPrefix          string        `mapstructure:"secret_mount_path_prefix"`
+	AllowedAuthRoles               string        `mapstructure:"allowed_auth_roles"`
+	AllowedAuthMountPaths          string        `mapstructure:"allowed_auth_mount_paths"`
+	AllowedSecretMountPathPrefixes string        `mapstructure:"allowed_secret_mount_path_prefixes"`
+	MaxTimeout                     time.Duration `mapstructure:"max_timeout"`
 }
 
 func newVaultConfig(cfgmap *corev1.ConfigMap) (vaultConfig, error) {
 	var cfg vaultConfig
-	return cfg, mapstructure.Decode(cfgmap.Data, &cfg)
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, decoder.Decode(cfgmap.Data)
+}
+
+// allowList splits a comma-separated list of permitted values from our Vault config
+func allowList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
 }
 
 // podInjector isolates the logic around injecting theatre-secrets away from anything to
@@ -191,17 +254,30 @@ type podInjector struct {
 }
 
 // Inject configures the given pod to use theatre-secrets. If it returns nil, it's
-// because the pod isn't configured for injection.
-func (i podInjector) Inject(pod corev1.Pod) *corev1.Pod {
+// because the pod isn't configured for injection. An error is returned if the pod's
+// annotations are invalid.
+func (i podInjector) Inject(ctx context.Context, pod corev1.Pod) (*corev1.Pod, error) {
 	containerConfigs := parseContainerConfigs(pod)
 	if containerConfigs == nil {
-		return nil
+		return nil, nil
+	}
+
+	opts, err := i.parseVaultOptions(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolving images may query a registry several times per container, which must all
+	// complete before the API server gives up on our admission response
+	if i.ImageResolver != nil && i.ImageResolverTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.ImageResolverTimeout)
+		defer cancel()
 	}
 
 	mutatedPod := pod.DeepCopy()
 	expirySeconds := int64(i.ServiceAccountTokenExpiry / time.Second)
 
-	mutatedPod.Spec.InitContainers = append(mutatedPod.Spec.InitContainers, i.buildInitContainer())
 	mutatedPod.Spec.Volumes = append(
 		mutatedPod.Spec.Volumes,
 		// Installation directory for theatre binaries, used as a scratch installation path
@@ -246,29 +322,215 @@ func (i podInjector) Inject(pod corev1.Pod) *corev1.Pod {
 		mutatedPod.Spec.SecurityContext.FSGroup = &defaultFSGroup
 	}
 
-	secretMountPathPrefix := path.Join(i.vaultConfig.SecretMountPathPrefix, pod.Namespace, pod.Spec.ServiceAccountName)
-
 	for idx, container := range mutatedPod.Spec.Containers {
 		containerConfigPath, ok := containerConfigs[container.Name]
 		if !ok {
 			continue
 		}
 
-		mutatedPod.Spec.Containers[idx] = i.configureContainer(container, containerConfigPath, secretMountPathPrefix)
+		container, err := i.resolveCommand(ctx, pod, container)
+		if err != nil {
+			return nil, err
+		}
+
+		mutatedPod.Spec.Containers[idx] = i.configureContainer(container, containerConfigPath, opts)
+	}
+
+	// The binaries must be installed before any init container that uses them runs, so
+	// we place our init container immediately before the first of them. Init containers
+	// that come earlier, such as a Vault Agent sidecar, continue to start first.
+	installIdx := len(mutatedPod.Spec.InitContainers)
+	for idx := len(mutatedPod.Spec.InitContainers) - 1; idx >= 0; idx-- {
+		container := mutatedPod.Spec.InitContainers[idx]
+		containerConfigPath, ok := containerConfigs[initContainerPrefix+container.Name]
+		if !ok {
+			continue
+		}
+
+		container, err := i.resolveCommand(ctx, pod, container)
+		if err != nil {
+			return nil, err
+		}
+
+		mutatedPod.Spec.InitContainers[idx] = i.configureContainer(container, containerConfigPath, opts)
+		installIdx = idx
 	}
 
-	return mutatedPod
+	mutatedPod.Spec.InitContainers = append(
+		mutatedPod.Spec.InitContainers[:installIdx],
+		append([]corev1.Container{i.buildInitContainer()}, mutatedPod.Spec.InitContainers[installIdx:]...)...,
+	)
+
+	return mutatedPod, nil
 }
 
+// vaultOptions configure how theatre-secrets communicates with Vault from a pod's
+// containers
+type vaultOptions struct {
+	Auth       secrets.Auth
+	PathPrefix string
+	Timeout    time.Duration
+	Debug      bool
+}
+
+// parseVaultOptions applies any overrides in the pod annotations to our Vault config
+// and injector options, rejecting those not permitted by the Vault config:
+//
+//	secrets-injector.vault.crd.gocardless.com/role: payments
+//	secrets-injector.vault.crd.gocardless.com/auth-mount-path: kubernetes.payments
+//	secrets-injector.vault.crd.gocardless.com/path-prefix: secret/data/payments
+//	secrets-injector.vault.crd.gocardless.com/timeout: 30s
+//	secrets-injector.vault.crd.gocardless.com/debug: "true"
+//
+// Unlike the default prefix, the path-prefix is used as given rather than having the
+// namespace and service account appended to it.
+func (i podInjector) parseVaultOptions(pod corev1.Pod) (vaultOptions, error) {
+	auth, err := i.parseAuth(pod)
+	if err != nil {
+		return vaultOptions{}, err
+	}
+
+	opts := vaultOptions{
+		Auth:       auth,
+		PathPrefix: path.Join(i.SecretMountPathPrefix, pod.Namespace, pod.Spec.ServiceAccountName),
+		Timeout:    i.Timeout,
+		Debug:      i.Debug,
+	}
+
+	if role, ok := pod.Annotations[RoleAnnotation]; ok {
+		if opts.Auth.Method != secrets.AuthMethodKubernetes && opts.Auth.Method != secrets.AuthMethodJWT {
+			return opts, fmt.Errorf("invalid %s annotation: the %s auth method does not use a role", RoleAnnotation, opts.Auth.Method)
+		}
+		if err := checkAllowed(RoleAnnotation, role, i.AllowedAuthRoles, "allowed_auth_roles", isAllowedValue); err != nil {
+			return opts, err
+		}
+		opts.Auth.Role = role
+	}
+
+	if mountPath, ok := pod.Annotations[AuthMountPathAnnotation]; ok {
+		if opts.Auth.Method == secrets.AuthMethodAgent {
+			return opts, fmt.Errorf("invalid %s annotation: the %s auth method does not use an auth mount", AuthMountPathAnnotation, opts.Auth.Method)
+		}
+		if err := checkAllowed(AuthMountPathAnnotation, mountPath, i.AllowedAuthMountPaths, "allowed_auth_mount_paths", isAllowedValue); err != nil {
+			return opts, err
+		}
+		opts.Auth.MountPath = mountPath
+	}
+
+	if pathPrefix, ok := pod.Annotations[PathPrefixAnnotation]; ok {
+		pathPrefix = path.Clean(pathPrefix)
+		if err := checkAllowed(PathPrefixAnnotation, pathPrefix, i.AllowedSecretMountPathPrefixes, "allowed_secret_mount_path_prefixes", isAllowedPath); err != nil {
+			return opts, err
+		}
+		opts.PathPrefix = pathPrefix
+	}
+
+	if value, ok := pod.Annotations[TimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return opts, fmt.Errorf("invalid %s annotation: %q is not a positive duration, such as 30s", TimeoutAnnotation, value)
+		}
+		if i.MaxTimeout == 0 {
+			return opts, fmt.Errorf("invalid %s annotation: timeouts cannot be overridden, as max_timeout is not set in the vault config", TimeoutAnnotation)
+		}
+		if timeout > i.MaxTimeout {
+			return opts, fmt.Errorf("invalid %s annotation: %s exceeds the max_timeout of %s", TimeoutAnnotation, timeout, i.MaxTimeout)
+		}
+		opts.Timeout = timeout
+	}
+
+	if value, ok := pod.Annotations[DebugAnnotation]; ok {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s annotation: %q is not a boolean", DebugAnnotation, value)
+		}
+		opts.Debug = debug
+	}
+
+	return opts, nil
+}
+
+// checkAllowed returns an error unless the value of the annotation is permitted by an
+// allow-list from our Vault config
+func checkAllowed(annotation, value, list, key string, allowed func(value, permitted string) bool) error {
+	permitted := allowList(list)
+	if len(permitted) == 0 {
+		return fmt.Errorf("invalid %s annotation: overrides are not permitted, as %s is not set in the vault config", annotation, key)
+	}
+
+	for _, p := range permitted {
+		if p == "*" || allowed(value, p) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid %s annotation: %q is not permitted, must be one of: %s", annotation, value, strings.Join(permitted, ", "))
+}
+
+func isAllowedValue(value, permitted string) bool {
+	return value == permitted
+}
+
+// isAllowedPath permits the path itself and any path nested beneath it
+func isAllowedPath(value, permitted string) bool {
+	permitted = path.Clean(permitted)
+	return value == permitted || strings.HasPrefix(value, permitted+"/")
+}
+
+// parseAuth determines how theatre-secrets should authenticate with Vault, using the
+// kubernetes auth backend from our Vault config unless the pod annotations choose a
+// different method:
+//
+//	secrets-injector.vault.crd.gocardless.com/auth-method: approle
+//	secrets-injector.vault.crd.gocardless.com/approle-role-id: 0a1b2c3d
+//	secrets-injector.vault.crd.gocardless.com/approle-secret-id-file: /etc/approle/secret-id
+//
+// The jwt method presents the projected service account token unless a jwt-file is
+// given, and the agent method requires the agent-token-file of a Vault Agent sidecar.
+func (i podInjector) parseAuth(pod corev1.Pod) (secrets.Auth, error) {
+	auth := secrets.Auth{
+		Method:       pod.Annotations[AuthMethodAnnotation],
+		JWTFile:      pod.Annotations[JWTFileAnnotation],
+		RoleID:       pod.Annotations[AppRoleRoleIDAnnotation],
+		SecretIDFile: pod.Annotations[AppRoleSecretIDFileAnnotation],
+		TokenFile:    pod.Annotations[AgentTokenFileAnnotation],
+	}
+
+	switch auth.Method {
+	case "", secrets.AuthMethodKubernetes:
+		auth.Method = secrets.AuthMethodKubernetes
+		auth.MountPath = i.AuthMountPath
+		auth.Role = i.AuthRole
+	case secrets.AuthMethodJWT:
+		auth.Role = i.AuthRole
+		if auth.JWTFile == "" {
+			auth.JWTFile = i.ServiceAccountTokenFile
+		}
+	}
+
+	if err := auth.Validate(); err != nil {
+		return auth, fmt.Errorf("invalid %s annotation: %w", AuthMethodAnnotation, err)
+	}
+
+	return auth, nil
+}
+
+// initContainerPrefix marks a container in the configs annotation as an init container.
+// Container names can't contain a slash, so this can't be confused with a name.
+const initContainerPrefix = "init/"
+
 // parseContainerConfigs extracts the pod annotation and parses that configuration
 // required for this container.
 //
-//	secrets-injector.vault.crd.gocardless.com/configs: app:config.yaml,sidecar
+//	secrets-injector.vault.crd.gocardless.com/configs: app:config.yaml,sidecar,init/migrate
 //
 // Valid values for the annotation are:
 //
 //	annotation ::= container_config | ',' annotation
-//	container_config ::= container_name ( ':' config_file )?
+//	container_config ::= ( 'init/' )? container_name ( ':' config_file )?
+//
+// Containers prefixed with init/ are init containers, including native sidecars that
+// have a restartPolicy of Always. Their keys in the returned map keep the prefix.
 //
 // If no config file is specified, we inject theatre-secrets but don't load
 // configuration from files, relying solely on environment variables.
@@ -291,6 +553,56 @@ func parseContainerConfigs(pod corev1.Pod) map[string]string {
 	return containerConfigs
 }
 
+// resolveCommand ensures the container sets its command, as theatre-secrets must be
+// told what to exec once it has resolved secrets. Containers that rely on the entrypoint
+// of their image take their command from an annotation if present, otherwise from the
+// image configuration in the registry. If neither is available, we return an error so
+// the pod is rejected, rather than running theatre-secrets with nothing to exec.
+func (i podInjector) resolveCommand(ctx context.Context, pod corev1.Pod, container corev1.Container) (corev1.Container, error) {
+	if len(container.Command) > 0 {
+		return container, nil
+	}
+
+	annotation := CommandAnnotationPrefix + container.Name
+	if value, ok := pod.Annotations[annotation]; ok {
+		var command []string
+		if err := json.Unmarshal([]byte(value), &command); err != nil || len(command) == 0 {
+			return container, fmt.Errorf(`invalid %s annotation: expected a JSON array of strings, such as ["bundle", "exec", "puma"]`, annotation)
+		}
+
+		container.Command = command
+		return container, nil
+	}
+
+	reason := "image entrypoint resolution is not enabled"
+	if i.ImageResolver != nil {
+		config, err := i.ImageResolver.Resolve(ctx, container.Image)
+		if err != nil {
+			reason = err.Error()
+		} else {
+			// The image's CMD is only used when the container doesn't set its own args,
+			// matching how Kubernetes combines them with the entrypoint.
+			args := container.Args
+			if len(args) == 0 {
+				args = config.Cmd
+			}
+
+			command := append(append([]string{}, config.Entrypoint...), args...)
+			if len(command) > 0 {
+				container.Command, container.Args = command, nil
+				return container, nil
+			}
+
+			reason = fmt.Sprintf("image %s has no entrypoint or cmd", container.Image)
+		}
+	}
+
+	return container, fmt.Errorf(
+		"container %s has no command and the entrypoint of its image could not be determined (%s): set the command of the container, or the %s annotation",
+		container.Name, reason, annotation,
+	)
+}
+
 func (i podInjector) buildInitContainer() corev1.Container {
 	return corev1.Container{
 		Name:            "theatre-secrets-injector",
@@ -319,20 +631,42 @@ func (i podInjector) buildInitContainer() corev1.Container {
 
 // configureContainer returns a copy with the command modified to run theatre-secrets,
 // along with a volume mount that will contain the secrets binaries.
-func (i podInjector) configureContainer(reference corev1.Container, containerConfigPath, secretMountPathPrefix string) corev1.Container {
+func (i podInjector) configureContainer(reference corev1.Container, containerConfigPath string, opts vaultOptions) corev1.Container {
 	c := &reference
+	auth := opts.Auth
 
 	args := []string{"exec"}
-	if i.Debug {
+	if opts.Debug {
 		args = append(args, "--debug")
 	}
 
 	args = append(args, "--vault-address", i.Address)
-	args = append(args, "--vault-http-timeout", i.Timeout.String())
-	args = append(args, "--vault-path-prefix", secretMountPathPrefix)
-	args = append(args, "--auth-backend-mount-path", i.AuthMountPath)
-	args = append(args, "--auth-backend-role", i.AuthRole)
-	args = append(args, "--service-account-token-file", i.ServiceAccountTokenFile)
+	args = append(args, "--vault-http-timeout", opts.Timeout.String())
+	args = append(args, "--vault-path-prefix", opts.PathPrefix)
+
+	switch auth.Method {
+	case secrets.AuthMethodKubernetes:
+		args = append(args, "--auth-backend-mount-path", auth.MountPath)
+		args = append(args, "--auth-backend-role", auth.Role)
+		args = append(args, "--service-account-token-file", i.ServiceAccountTokenFile)
+	case secrets.AuthMethodJWT:
+		args = append(args, "--auth-method", auth.Method)
+		if auth.MountPath != "" {
+			args = append(args, "--auth-backend-mount-path", auth.MountPath)
+		}
+		args = append(args, "--auth-backend-role", auth.Role)
+		args = append(args, "--jwt-file", auth.JWTFile)
+	case secrets.AuthMethodAppRole:
+		args = append(args, "--auth-method", auth.Method)
+		if auth.MountPath != "" {
+			args = append(args, "--auth-backend-mount-path", auth.MountPath)
+		}
+		args = append(args, "--approle-role-id", auth.RoleID)
+		args = append(args, "--approle-secret-id-file", auth.SecretIDFile)
+	case secrets.AuthMethodAgent:
+		args = append(args, "--auth-method", auth.Method)
+		args = append(args, "--agent-token-file", auth.TokenFile)
+	}
 
 	if containerConfigPath != "" {
 		args = append(args, "--config-file", containerConfigPath)
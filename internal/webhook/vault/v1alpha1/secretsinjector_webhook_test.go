@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -26,12 +27,32 @@ var _ = Describe("PodInjector", func() {
 		injector *podInjector
 		fixture  *corev1.Pod
 		pod      *corev1.Pod
+		err      error
 	)
 
 	JustBeforeEach(func() {
-		pod = injector.Inject(*fixture)
+		pod, err = injector.Inject(context.TODO(), *fixture)
 	})
 
+	appArgs := func() []string {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == "app" {
+				return container.Args
+			}
+		}
+		return nil
+	}
+
+	// appCommand returns the command theatre-secrets will exec in the app container
+	appCommand := func() []string {
+		for idx, arg := range appArgs() {
+			if arg == "--" {
+				return appArgs()[idx+1:]
+			}
+		}
+		return nil
+	}
+
 	BeforeEach(func() {
 		injector = &podInjector{
 			vaultConfig: vaultConfig{
@@ -62,6 +83,7 @@ var _ = Describe("PodInjector", func() {
 		})
 
 		It("Returns unmutated pod", func() {
+			Expect(err).NotTo(HaveOccurred())
 			Expect(pod).To(BeNil(), "expected nil, as it isn't annotated for mutation")
 		})
 	})
@@ -260,6 +282,404 @@ var _ = Describe("PodInjector", func() {
 			)
 		})
 	})
+
+	Context("Pod with annotated init containers", func() {
+		initContainer := func(name string) corev1.Container {
+			for _, container := range pod.Spec.InitContainers {
+				if container.Name == name {
+					return container
+				}
+			}
+			return corev1.Container{}
+		}
+
+		initContainerNames := func() []string {
+			names := []string{}
+			for _, container := range pod.Spec.InitContainers {
+				names = append(names, container.Name)
+			}
+			return names
+		}
+
+		BeforeEach(func() {
+			fixture = mustPodFixture("./testdata/init_containers_pod.yaml")
+		})
+
+		It("Installs theatre-secrets before the first injected init container", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(initContainerNames()).To(Equal([]string{"setup", "theatre-secrets-injector", "migrate", "proxy"}))
+		})
+
+		It("Modifies the command of injected init containers", func() {
+			migrate := initContainer("migrate")
+			Expect(migrate.Command).To(Equal([]string{"/var/run/theatre-secrets/theatre-secrets"}))
+			Expect(migrate.Args).To(ContainElements("--config-file", "config/migrate.yaml"))
+			Expect(migrate.Args[len(migrate.Args)-3:]).To(Equal([]string{"--", "rake", "db:migrate"}))
+		})
+
+		It("Injects native sidecars", func() {
+			proxy := initContainer("proxy")
+			Expect(proxy.Args[len(proxy.Args)-2:]).To(Equal([]string{"--", "proxy"}))
+			Expect(*proxy.RestartPolicy).To(Equal(corev1.ContainerRestartPolicyAlways))
+			Expect(proxy.VolumeMounts).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("theatre-secrets-install"),
+			})))
+		})
+
+		It("Doesn't inject init containers that aren't annotated", func() {
+			Expect(initContainer("setup").Command).To(Equal([]string{"echo", "setup"}))
+		})
+
+		It("Injects containers", func() {
+			Expect(appArgs()).To(ContainElements("--", "echo", "inject", "only"))
+			Expect(appArgs()[0]).To(Equal("exec"))
+		})
+
+		Context("When an init container is annotated without the prefix", func() {
+			BeforeEach(func() {
+				fixture.Annotations[fmt.Sprintf("%s/configs", SecretsInjectorFQDN)] = "migrate"
+			})
+
+			It("Only targets init containers with the init/ prefix", func() {
+				Expect(initContainer("migrate").Command).To(Equal([]string{"rake", "db:migrate"}))
+				Expect(initContainerNames()).To(Equal([]string{"setup", "migrate", "proxy", "theatre-secrets-injector"}))
+			})
+		})
+	})
+
+	Context("Pod with a container that relies on its image entrypoint", func() {
+		BeforeEach(func() {
+			fixture = mustPodFixture("./testdata/app_no_config_pod.yaml")
+			fixture.Spec.Containers[0].Image = "app:v1"
+			fixture.Spec.Containers[0].Command = nil
+		})
+
+		Context("Without a command annotation or image resolver", func() {
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(
+					"container app has no command and the entrypoint of its image could not be determined (image entrypoint resolution is not enabled)",
+				)))
+			})
+		})
+
+		Context("With a command annotation", func() {
+			BeforeEach(func() {
+				fixture.Annotations[CommandAnnotationPrefix+"app"] = `["bundle", "exec", "puma"]`
+				fixture.Spec.Containers[0].Args = []string{"--port", "8080"}
+			})
+
+			It("Execs the annotated command with the container's args", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appCommand()).To(Equal([]string{"bundle", "exec", "puma", "--port", "8080"}))
+			})
+
+			Context("That isn't a JSON array", func() {
+				BeforeEach(func() {
+					fixture.Annotations[CommandAnnotationPrefix+"app"] = "bundle exec puma"
+				})
+
+				It("Returns an error", func() {
+					Expect(err).To(MatchError(ContainSubstring("expected a JSON array of strings")))
+				})
+			})
+		})
+
+		Context("With an image resolver", func() {
+			var resolver *fakeImageResolver
+
+			BeforeEach(func() {
+				resolver = &fakeImageResolver{configs: map[string]ImageConfig{
+					"app:v1": {Entrypoint: []string{"/sbin/tini", "--"}, Cmd: []string{"server"}},
+				}}
+				injector.ImageResolver = resolver
+			})
+
+			It("Execs the image entrypoint and cmd", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appCommand()).To(Equal([]string{"/sbin/tini", "--", "server"}))
+			})
+
+			Context("When the container sets args", func() {
+				BeforeEach(func() {
+					fixture.Spec.Containers[0].Args = []string{"worker"}
+				})
+
+				It("Replaces the image cmd with the args", func() {
+					Expect(appCommand()).To(Equal([]string{"/sbin/tini", "--", "worker"}))
+				})
+			})
+
+			Context("When the image can't be resolved", func() {
+				BeforeEach(func() {
+					fixture.Spec.Containers[0].Image = "private.example.com/app:v1"
+				})
+
+				It("Returns an error with the reason", func() {
+					Expect(err).To(MatchError(ContainSubstring("(image private.example.com/app:v1 not found)")))
+				})
+			})
+
+			Context("With a timeout", func() {
+				BeforeEach(func() {
+					injector.ImageResolverTimeout = time.Minute
+				})
+
+				It("Resolves images within the timeout", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resolver.deadline).To(BeTemporally("~", time.Now().Add(time.Minute), 5*time.Second))
+				})
+			})
+		})
+	})
+
+	Context("Pod with auth method annotations", func() {
+		BeforeEach(func() {
+			fixture = mustPodFixture("./testdata/app_no_config_pod.yaml")
+		})
+
+		Context("With the jwt method", func() {
+			BeforeEach(func() {
+				fixture.Annotations[AuthMethodAnnotation] = "jwt"
+			})
+
+			It("Presents the projected service account token to the jwt backend", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appArgs()).To(ContainElements(
+					"--auth-method", "jwt",
+					"--auth-backend-role", "default",
+					"--jwt-file", "/var/run/secrets/kubernetes.io/vault/token",
+				))
+				Expect(appArgs()).NotTo(ContainElement("--auth-backend-mount-path"))
+			})
+
+			Context("And a jwt file", func() {
+				BeforeEach(func() {
+					fixture.Annotations[JWTFileAnnotation] = "/var/run/secrets/oidc/token"
+				})
+
+				It("Presents the given token", func() {
+					Expect(appArgs()).To(ContainElements("--jwt-file", "/var/run/secrets/oidc/token"))
+				})
+			})
+		})
+
+		Context("With the approle method", func() {
+			BeforeEach(func() {
+				fixture.Annotations[AuthMethodAnnotation] = "approle"
+				fixture.Annotations[AppRoleRoleIDAnnotation] = "role-id"
+				fixture.Annotations[AppRoleSecretIDFileAnnotation] = "/etc/approle/secret-id"
+			})
+
+			It("Configures the role and secret ID", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appArgs()).To(ContainElements(
+					"--auth-method", "approle",
+					"--approle-role-id", "role-id",
+					"--approle-secret-id-file", "/etc/approle/secret-id",
+				))
+			})
+
+			Context("Without a secret ID file", func() {
+				BeforeEach(func() {
+					delete(fixture.Annotations, AppRoleSecretIDFileAnnotation)
+				})
+
+				It("Returns an error", func() {
+					Expect(err).To(MatchError(ContainSubstring("approle auth method requires a secret ID")))
+				})
+			})
+		})
+
+		Context("With the agent method", func() {
+			BeforeEach(func() {
+				fixture.Annotations[AuthMethodAnnotation] = "agent"
+				fixture.Annotations[AgentTokenFileAnnotation] = "/vault/.vault-token"
+			})
+
+			It("Reads the token from the agent's sink", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appArgs()).To(ContainElements("--auth-method", "agent", "--agent-token-file", "/vault/.vault-token"))
+				Expect(appArgs()).NotTo(ContainElement("--service-account-token-file"))
+			})
+		})
+
+		Context("With an unknown method", func() {
+			BeforeEach(func() {
+				fixture.Annotations[AuthMethodAnnotation] = "ldap"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(`unsupported auth method "ldap"`)))
+			})
+		})
+	})
+
+	Context("Pod with override annotations", func() {
+		BeforeEach(func() {
+			fixture = mustPodFixture("./testdata/app_no_config_pod.yaml")
+			injector.AllowedAuthRoles = "default, payments"
+			injector.AllowedAuthMountPaths = "kubernetes.payments"
+			injector.AllowedSecretMountPathPrefixes = "secret/data/shared"
+			injector.MaxTimeout = time.Minute
+		})
+
+		Context("With permitted values", func() {
+			BeforeEach(func() {
+				fixture.Annotations[RoleAnnotation] = "payments"
+				fixture.Annotations[AuthMountPathAnnotation] = "kubernetes.payments"
+				fixture.Annotations[PathPrefixAnnotation] = "secret/data/shared/payments/"
+				fixture.Annotations[TimeoutAnnotation] = "30s"
+				fixture.Annotations[DebugAnnotation] = "false"
+			})
+
+			It("Configures theatre-secrets with the overrides", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appArgs()).To(Equal([]string{
+					"exec",
+					"--vault-address", "https://vault.example.com",
+					"--vault-http-timeout", "30s",
+					"--vault-path-prefix", "secret/data/shared/payments",
+					"--auth-backend-mount-path", "kubernetes.payments",
+					"--auth-backend-role", "payments",
+					"--service-account-token-file", "/var/run/secrets/kubernetes.io/vault/token",
+					"--",
+					"echo", "inject", "only",
+				}))
+			})
+		})
+
+		Context("With a role that isn't allowed", func() {
+			BeforeEach(func() {
+				fixture.Annotations[RoleAnnotation] = "admin"
+			})
+
+			It("Returns an error listing the permitted roles", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"admin" is not permitted, must be one of: default, payments`)))
+			})
+		})
+
+		Context("With a wildcard allow-list", func() {
+			BeforeEach(func() {
+				injector.AllowedAuthRoles = "*"
+				fixture.Annotations[RoleAnnotation] = "admin"
+			})
+
+			It("Permits any role", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(appArgs()).To(ContainElements("--auth-backend-role", "admin"))
+			})
+		})
+
+		Context("With a role for the approle method", func() {
+			BeforeEach(func() {
+				fixture.Annotations[AuthMethodAnnotation] = "approle"
+				fixture.Annotations[AppRoleRoleIDAnnotation] = "role-id"
+				fixture.Annotations[AppRoleSecretIDFileAnnotation] = "/etc/approle/secret-id"
+				fixture.Annotations[RoleAnnotation] = "payments"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("the approle auth method does not use a role")))
+			})
+		})
+
+		Context("With an auth mount path when none are allowed", func() {
+			BeforeEach(func() {
+				injector.AllowedAuthMountPaths = ""
+				fixture.Annotations[AuthMountPathAnnotation] = "kubernetes.payments"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("overrides are not permitted, as allowed_auth_mount_paths is not set")))
+			})
+		})
+
+		Context("With a path prefix outside the allowed prefixes", func() {
+			BeforeEach(func() {
+				fixture.Annotations[PathPrefixAnnotation] = "secret/data/shared-other"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"secret/data/shared-other" is not permitted`)))
+			})
+		})
+
+		Context("With a path prefix that escapes the allowed prefixes", func() {
+			BeforeEach(func() {
+				fixture.Annotations[PathPrefixAnnotation] = "secret/data/shared/../kubernetes"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"secret/data/kubernetes" is not permitted`)))
+			})
+		})
+
+		Context("With a timeout above the maximum", func() {
+			BeforeEach(func() {
+				fixture.Annotations[TimeoutAnnotation] = "5m"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("5m0s exceeds the max_timeout of 1m0s")))
+			})
+		})
+
+		Context("With an invalid timeout", func() {
+			BeforeEach(func() {
+				fixture.Annotations[TimeoutAnnotation] = "soon"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"soon" is not a positive duration`)))
+			})
+		})
+
+		Context("With an invalid debug value", func() {
+			BeforeEach(func() {
+				fixture.Annotations[DebugAnnotation] = "loud"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"loud" is not a boolean`)))
+			})
+		})
+	})
+})
+
+type fakeImageResolver struct {
+	configs  map[string]ImageConfig
+	deadline time.Time
+}
+
+func (r *fakeImageResolver) Resolve(ctx context.Context, image string) (ImageConfig, error) {
+	r.deadline, _ = ctx.Deadline()
+
+	config, ok := r.configs[image]
+	if !ok {
+		return config, fmt.Errorf("image %s not found", image)
+	}
+
+	return config, nil
+}
+
+var _ = Describe("newVaultConfig", func() {
+	It("Parses allow-lists and the max timeout", func() {
+		cfg, err := newVaultConfig(&corev1.ConfigMap{
+			Data: map[string]string{
+				"address":                            "https://vault.example.com",
+				"allowed_auth_roles":                 "default,payments",
+				"allowed_secret_mount_path_prefixes": "secret/data/shared",
+				"max_timeout":                        "1m",
+				"disable_iss_validation":             "true",
+			},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Address).To(Equal("https://vault.example.com"))
+		Expect(allowList(cfg.AllowedAuthRoles)).To(Equal([]string{"default", "payments"}))
+		Expect(allowList(cfg.AllowedAuthMountPaths)).To(BeEmpty())
+		Expect(cfg.MaxTimeout).To(Equal(time.Minute))
+	})
 })
 
 var _ = Describe("parseContainerConfigs", func() {
@@ -307,6 +727,16 @@ var _ = Describe("parseContainerConfigs", func() {
 			})
 		})
 
+		Context("With init containers", func() {
+			BeforeEach(func() {
+				fixture.ObjectMeta.Annotations = map[string]string{fmt.Sprintf("%s/configs", SecretsInjectorFQDN): "app, init/migrate: path/to/config.yaml"}
+			})
+
+			It("Returns init containers with their prefix", func() {
+				Expect(containerConfigs).To(Equal(map[string]string{"app": "", "init/migrate": "path/to/config.yaml"}))
+			})
+		})
+
 		Context("With multiple apps with and without config", func() {
 			BeforeEach(func() {
 				fixture.ObjectMeta.Annotations = map[string]string{fmt.Sprintf("%s/configs", SecretsInjectorFQDN): "app: path/to/config.yaml, app2, app3: path/to/config3.yaml"}
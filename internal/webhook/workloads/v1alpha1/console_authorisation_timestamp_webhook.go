@@ -0,0 +1,98 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+	rbacutils "github.com/gocardless/theatre/v5/pkg/rbac"
+)
+
+// ConsoleAuthorisationTimestampWebhook records the time at which each
+// authorisation, rejection or timeout extension authorisation is given, and the
+// groups of the user giving each authorisation. Authorisations can be
+// configured to lapse after a period of time, and count towards clauses naming
+// groups, so neither can be left to the authoriser to provide.
+// +kubebuilder:object:generate=false
+type ConsoleAuthorisationTimestampWebhook struct {
+	logger  logr.Logger
+	decoder admission.Decoder
+}
+
+func NewConsoleAuthorisationTimestampWebhook(logger logr.Logger, scheme *runtime.Scheme) *ConsoleAuthorisationTimestampWebhook {
+	decoder := admission.NewDecoder(scheme)
+
+	return &ConsoleAuthorisationTimestampWebhook{
+		logger:  logger,
+		decoder: decoder,
+	}
+}
+
+func (c *ConsoleAuthorisationTimestampWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := c.logger.WithValues("uuid", string(req.UID))
+	logger.Info("starting request", "event", "request.start")
+	defer func(start time.Time) {
+		logger.Info("completed request", "event", "request.end", "duration", time.Since(start).Seconds())
+	}(time.Now())
+
+	updatedAuth := &workloadsv1alpha1.ConsoleAuthorisation{}
+	if err := c.decoder.DecodeRaw(req.Object, updatedAuth); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	existingAuth := &workloadsv1alpha1.ConsoleAuthorisation{}
+	if err := c.decoder.DecodeRaw(req.OldObject, existingAuth); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	copy := stampAuthorisations(existingAuth, updatedAuth, req.AdmissionRequest.UserInfo.Groups, time.Now())
+
+	copyBytes, err := json.Marshal(copy)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, copyBytes)
+}
+
+// stampAuthorisations sets the time of any authorisations, rejections and
+// timeout extension authorisations that have been added in the update, and the
+// groups of the user adding each authorisation, overriding any value supplied
+// by the user.
+func stampAuthorisations(existingAuth, updatedAuth *workloadsv1alpha1.ConsoleAuthorisation, groups []string, now time.Time) *workloadsv1alpha1.ConsoleAuthorisation {
+	copy := updatedAuth.DeepCopy()
+	existingSubjects := existingAuth.Subjects()
+
+	for idx, entry := range copy.Spec.Authorisations {
+		if rbacutils.IncludesSubject(existingSubjects, entry.Subject) {
+			continue
+		}
+
+		authorisedAt := metav1.NewTime(now)
+		copy.Spec.Authorisations[idx].AuthorisedAt = &authorisedAt
+		copy.Spec.Authorisations[idx].Groups = groups
+	}
+
+	// Rejections can only be appended to, so any beyond the existing ones have
+	// been added in this update
+	for idx := len(existingAuth.Spec.Rejections); idx < len(copy.Spec.Rejections); idx++ {
+		rejectedAt := metav1.NewTime(now)
+		copy.Spec.Rejections[idx].RejectedAt = &rejectedAt
+	}
+
+	// As are timeout extension authorisations
+	for idx := len(existingAuth.Spec.TimeoutExtensionAuthorisations); idx < len(copy.Spec.TimeoutExtensionAuthorisations); idx++ {
+		authorisedAt := metav1.NewTime(now)
+		copy.Spec.TimeoutExtensionAuthorisations[idx].AuthorisedAt = &authorisedAt
+		copy.Spec.TimeoutExtensionAuthorisations[idx].Groups = groups
+	}
+
+	return copy
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -70,6 +71,8 @@ func (c *ConsoleAuthorisationWebhook) Handle(ctx context.Context, req admission.
 		updatedAuth:  updatedAuth,
 		user:         user,
 		owner:        csl.Spec.User,
+		extensions:   len(csl.Spec.TimeoutExtensions),
+		pendingJob:   csl.PendingJob(),
 	}
 
 	if err := update.Validate(); err != nil {
@@ -77,6 +80,23 @@ func (c *ConsoleAuthorisationWebhook) Handle(ctx context.Context, req admission.
 		return admission.ValidationResponse(false, fmt.Sprintf("the console authorisation spec is invalid: %v", err))
 	}
 
+	if rejection := update.addedRejection(); rejection != nil {
+		logger.Info("rejection successful", "event", "rejection.success")
+		err = c.lifecycleRecorder.ConsoleReject(ctx, csl, user, rejection.Reason)
+		if err != nil {
+			logging.WithNoRecord(logger).Error(err, "failed to record event", "event", "console.reject")
+		}
+
+		return admission.ValidationResponse(true, "")
+	}
+
+	// Updates that only authorise a timeout extension don't authorise the
+	// console itself, so they aren't recorded as such
+	if len(update.addedAuthorisers()) == 0 {
+		logger.Info("update successful", "event", "update.success")
+		return admission.ValidationResponse(true, "")
+	}
+
 	logger.Info("authorisation successful", "event", "authorisation.success")
 	err = c.lifecycleRecorder.ConsoleAuthorise(ctx, csl, user)
 	if err != nil {
@@ -102,6 +122,8 @@ type ConsoleAuthorisationUpdate struct {
 	updatedAuth  *workloadsv1alpha1.ConsoleAuthorisation
 	user         string
 	owner        string
+	extensions   int
+	pendingJob   bool
 }
 
 func (u *ConsoleAuthorisationUpdate) Validate() error {
@@ -113,13 +135,28 @@ func (u *ConsoleAuthorisationUpdate) Validate() error {
 	}
 
 	// check no existing authorisation subjects have been modified and that a single subject has been added
-	add := rbacutils.Diff(u.updatedAuth.Spec.Authorisations, u.existingAuth.Spec.Authorisations)
-	remove := rbacutils.Diff(u.existingAuth.Spec.Authorisations, u.updatedAuth.Spec.Authorisations)
+	add := u.addedAuthorisers()
+	remove := rbacutils.Diff(u.existingAuth.Subjects(), u.updatedAuth.Subjects())
 
 	if len(add) > 1 || len(remove) != 0 {
 		err = multierror.Append(err, errors.New("the spec.authorisations field can only be appended to (with one subject) per update"))
 	}
 
+	// check the time and comment of existing authorisations haven't been
+	// modified, e.g. to refresh an authorisation that would otherwise lapse
+	modified := false
+	for _, existing := range u.existingAuth.Spec.Authorisations {
+		for _, updated := range u.updatedAuth.Spec.Authorisations {
+			if rbacutils.IncludesSubject([]rbacv1.Subject{existing.Subject}, updated.Subject) && !reflect.DeepEqual(updated, existing) {
+				modified = true
+			}
+		}
+	}
+
+	if modified {
+		err = multierror.Append(err, errors.New("existing entries in the spec.authorisations field cannot be modified"))
+	}
+
 	// check the user is only adding themselves to the list of authorisers
 	for _, s := range add {
 		if s.Name != u.user {
@@ -136,5 +173,82 @@ func (u *ConsoleAuthorisationUpdate) Validate() error {
 		}
 	}
 
+	// check the user isn't authorising a console they have already rejected
+	for _, s := range add {
+		if u.existingAuth.RejectedBy(s) {
+			err = multierror.Append(err, errors.New("a console cannot be authorised by a user who has already rejected it"))
+			break
+		}
+	}
+
+	// check no existing rejections have been modified and that a single
+	// rejection has been added
+	existingRejections := u.existingAuth.Spec.Rejections
+	updatedRejections := u.updatedAuth.Spec.Rejections
+
+	if len(updatedRejections) < len(existingRejections) ||
+		(len(existingRejections) > 0 && !reflect.DeepEqual(updatedRejections[:len(existingRejections)], existingRejections)) ||
+		len(updatedRejections)-len(existingRejections) > 1 {
+		err = multierror.Append(err, errors.New("the spec.rejections field can only be appended to (with one rejection) per update"))
+	} else if rejection := u.addedRejection(); rejection != nil {
+		if len(add) > 0 {
+			err = multierror.Append(err, errors.New("a console cannot be authorised and rejected in the same update"))
+		}
+		if rejection.Name != u.user {
+			err = multierror.Append(err, errors.New("only the current user can be added as a rejecter"))
+		}
+		if rejection.Name == u.owner {
+			err = multierror.Append(err, errors.New("a console cannot be rejected by its owner"))
+		}
+		if rbacutils.IncludesSubject(u.existingAuth.Subjects(), rejection.Subject) {
+			err = multierror.Append(err, errors.New("a console cannot be rejected by a user who has already authorised it"))
+		}
+		if rejection.Reason == "" {
+			err = multierror.Append(err, errors.New("a reason must be given when rejecting a console"))
+		}
+		if !u.pendingJob {
+			err = multierror.Append(err, errors.New("a console can only be rejected before it has started"))
+		}
+	}
+
+	// check no existing timeout extension authorisations have been modified and
+	// that a single authorisation has been added
+	existingExtAuths := u.existingAuth.Spec.TimeoutExtensionAuthorisations
+	updatedExtAuths := u.updatedAuth.Spec.TimeoutExtensionAuthorisations
+
+	if len(updatedExtAuths) < len(existingExtAuths) ||
+		(len(existingExtAuths) > 0 && !reflect.DeepEqual(updatedExtAuths[:len(existingExtAuths)], existingExtAuths)) ||
+		len(updatedExtAuths)-len(existingExtAuths) > 1 {
+		err = multierror.Append(err, errors.New("the spec.timeoutExtensionAuthorisations field can only be appended to (with one authorisation) per update"))
+	} else {
+		for _, a := range updatedExtAuths[len(existingExtAuths):] {
+			if a.Name != u.user {
+				err = multierror.Append(err, errors.New("only the current user can be added as an authoriser"))
+			}
+			if a.Name == u.owner {
+				err = multierror.Append(err, errors.New("an authoriser cannot authorise their own console"))
+			}
+			if a.TimeoutExtension >= u.extensions {
+				err = multierror.Append(err, fmt.Errorf("timeout extension %d does not exist", a.TimeoutExtension))
+			}
+		}
+	}
+
 	return err
 }
+
+// addedAuthorisers returns the subjects added to spec.authorisations in the
+// update.
+func (u *ConsoleAuthorisationUpdate) addedAuthorisers() []rbacv1.Subject {
+	return rbacutils.Diff(u.updatedAuth.Subjects(), u.existingAuth.Subjects())
+}
+
+// addedRejection returns the rejection added in the update, if there is one.
+func (u *ConsoleAuthorisationUpdate) addedRejection() *workloadsv1alpha1.ConsoleRejection {
+	existing := len(u.existingAuth.Spec.Rejections)
+	if len(u.updatedAuth.Spec.Rejections) <= existing {
+		return nil
+	}
+
+	return &u.updatedAuth.Spec.Rejections[existing]
+}
@@ -3,6 +3,7 @@ package v1alpha1
 import (
 	"net/http"
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,20 +30,28 @@ func mustConsoleAuthorisationFixture(path string) *workloadsv1alpha1.ConsoleAuth
 var _ = Describe("Authorisation webhook", func() {
 	Describe("Validate", func() {
 		var (
-			updateFixture string
-			update        *ConsoleAuthorisationUpdate
-			err           error
+			existingFixture string
+			updateFixture   string
+			pendingJob      bool
+			update          *ConsoleAuthorisationUpdate
+			err             error
 		)
 
-		existingAuth := mustConsoleAuthorisationFixture("./testdata/console_authorisation_existing.yaml")
+		BeforeEach(func() {
+			existingFixture = "./testdata/console_authorisation_existing.yaml"
+			pendingJob = true
+		})
 
 		JustBeforeEach(func() {
+			existingAuth := mustConsoleAuthorisationFixture(existingFixture)
 			updatedAuth := mustConsoleAuthorisationFixture(updateFixture)
 			update = &ConsoleAuthorisationUpdate{
 				existingAuth: existingAuth,
 				updatedAuth:  updatedAuth,
 				user:         "current-user",
 				owner:        "user",
+				extensions:   1,
+				pendingJob:   pendingJob,
 			}
 
 			err = update.Validate()
@@ -56,6 +65,10 @@ var _ = Describe("Authorisation webhook", func() {
 			It("Returns no errors", func() {
 				Expect(err).To(BeNil())
 			})
+
+			It("Reports the added authoriser", func() {
+				Expect(update.addedAuthorisers()).To(HaveLen(1))
+			})
 		})
 
 		// We don't want to prevent an update if there's changes to parts of the
@@ -103,6 +116,77 @@ var _ = Describe("Authorisation webhook", func() {
 			})
 		})
 
+		Context("Modifying the time of an existing authorisation", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_modify_existing.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("existing entries in the spec.authorisations field cannot be modified")))
+			})
+		})
+
+		Context("Rejecting the console", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_add_rejection.yaml"
+			})
+
+			It("Returns no errors", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("Returns the added rejection", func() {
+				Expect(update.addedRejection()).NotTo(BeNil())
+				Expect(update.addedRejection().Reason).To(Equal("the command drops a table"))
+			})
+
+			Context("after the console has started", func() {
+				BeforeEach(func() {
+					pendingJob = false
+				})
+
+				It("Returns an error", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(err).To(MatchError(ContainSubstring("can only be rejected before it has started")))
+				})
+			})
+		})
+
+		Context("Rejecting the console as another user", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_rejection_another_user.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("only the current user can be added as a rejecter")))
+			})
+		})
+
+		Context("Rejecting the console without a reason", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_rejection_no_reason.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("a reason must be given")))
+			})
+		})
+
+		Context("Authorising a console the user has already rejected", func() {
+			BeforeEach(func() {
+				existingFixture = "./testdata/console_authorisation_existing_rejected.yaml"
+				updateFixture = "./testdata/console_authorisation_update_add_after_rejection.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("already rejected it")))
+			})
+		})
+
 		Context("Changing immutable fields", func() {
 			BeforeEach(func() {
 				updateFixture = "./testdata/console_authorisation_update_immutables.yaml"
@@ -114,6 +198,42 @@ var _ = Describe("Authorisation webhook", func() {
 			})
 		})
 
+		Context("Authorising a timeout extension", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_add_extension.yaml"
+			})
+
+			It("Returns no errors", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("Doesn't report an added authoriser", func() {
+				Expect(update.addedAuthorisers()).To(BeEmpty())
+			})
+		})
+
+		Context("Authorising a timeout extension that does not exist", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_add_missing_extension.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("timeout extension 1 does not exist")))
+			})
+		})
+
+		Context("Authorising a timeout extension as another user", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_authorisation_update_add_extension_another_user.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("only the current user can be added as an authoriser")))
+			})
+		})
+
 		Context("Removing an existing authoriser", func() {
 			BeforeEach(func() {
 				updateFixture = "./testdata/console_authorisation_update_remove.yaml"
@@ -125,4 +245,61 @@ var _ = Describe("Authorisation webhook", func() {
 			})
 		})
 	})
+
+	Describe("stampAuthorisations", func() {
+		var (
+			now     time.Time
+			groups  []string
+			stamped *workloadsv1alpha1.ConsoleAuthorisation
+		)
+
+		existingAuth := mustConsoleAuthorisationFixture("./testdata/console_authorisation_existing.yaml")
+
+		BeforeEach(func() {
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			groups = []string{"payments-leads", "system:authenticated"}
+			updatedAuth := mustConsoleAuthorisationFixture("./testdata/console_authorisation_update_add_with_comment.yaml")
+			stamped = stampAuthorisations(existingAuth, updatedAuth, groups, now)
+		})
+
+		It("Sets the time of the added authorisation, ignoring any supplied value", func() {
+			Expect(stamped.Spec.Authorisations[1].AuthorisedAt.Time).To(Equal(now))
+		})
+
+		It("Sets the groups of the added authorisation to those of the user", func() {
+			Expect(stamped.Spec.Authorisations[1].Groups).To(Equal(groups))
+		})
+
+		It("Keeps the comment of the added authorisation", func() {
+			Expect(stamped.Spec.Authorisations[1].Comment).To(Equal("checked the command with the requester"))
+		})
+
+		It("Leaves existing authorisations untouched", func() {
+			Expect(stamped.Spec.Authorisations[0].AuthorisedAt).To(BeNil())
+			Expect(stamped.Spec.Authorisations[0].Groups).To(BeEmpty())
+		})
+
+		Context("when a rejection is added", func() {
+			BeforeEach(func() {
+				updatedAuth := mustConsoleAuthorisationFixture("./testdata/console_authorisation_update_add_rejection.yaml")
+				stamped = stampAuthorisations(existingAuth, updatedAuth, groups, now)
+			})
+
+			It("Sets the time of the added rejection", func() {
+				Expect(stamped.Spec.Rejections[0].RejectedAt.Time).To(Equal(now))
+			})
+		})
+
+		Context("when a timeout extension authorisation is added", func() {
+			BeforeEach(func() {
+				updatedAuth := mustConsoleAuthorisationFixture("./testdata/console_authorisation_update_add_extension.yaml")
+				stamped = stampAuthorisations(existingAuth, updatedAuth, groups, now)
+			})
+
+			It("Sets the time of the added extension authorisation", func() {
+				Expect(stamped.Spec.TimeoutExtensionAuthorisations[0].AuthorisedAt.Time).To(Equal(now))
+				Expect(stamped.Spec.TimeoutExtensionAuthorisations[0].Groups).To(Equal(groups))
+			})
+		})
+	})
 })
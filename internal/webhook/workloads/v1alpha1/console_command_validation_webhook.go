@@ -0,0 +1,84 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+// ConsoleCommandValidationWebhook rejects consoles whose command isn't allowed
+// by their template, so that users learn which commands they can run when they
+// create the console, rather than from a failing condition once it has been
+// reconciled.
+// +kubebuilder:object:generate=false
+type ConsoleCommandValidationWebhook struct {
+	client  client.Client
+	logger  logr.Logger
+	decoder admission.Decoder
+}
+
+func NewConsoleCommandValidationWebhook(c client.Client, logger logr.Logger, scheme *runtime.Scheme) *ConsoleCommandValidationWebhook {
+	decoder := admission.NewDecoder(scheme)
+
+	return &ConsoleCommandValidationWebhook{
+		client:  c,
+		logger:  logger,
+		decoder: decoder,
+	}
+}
+
+func (c *ConsoleCommandValidationWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := c.logger.WithValues("uuid", string(req.UID))
+	logger.Info("starting request", "event", "request.start")
+
+	defer func(start time.Time) {
+		logger.Info("request completed", "event", "request.end", "duration", time.Since(start).Seconds())
+	}(time.Now())
+
+	csl := &workloadsv1alpha1.Console{}
+	if err := c.decoder.Decode(req, csl); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	logger = logger.WithValues("console_template", csl.Spec.ConsoleTemplateRef.Name)
+
+	tpl := &workloadsv1alpha1.ConsoleTemplate{}
+	key := client.ObjectKey{Namespace: req.Namespace, Name: csl.Spec.ConsoleTemplateRef.Name}
+	if err := c.client.Get(ctx, key, tpl); err != nil {
+		// The console controller reports consoles that reference a template that
+		// doesn't exist, so there's nothing for us to validate
+		if apierrors.IsNotFound(err) {
+			return admission.ValidationResponse(true, "console template not found")
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if !tpl.Spec.RestrictCommands {
+		return admission.ValidationResponse(true, "console template doesn't restrict commands")
+	}
+
+	command := csl.Spec.Command
+	if len(command) == 0 {
+		var err error
+		if command, err = tpl.GetDefaultCommandWithArgs(); err != nil {
+			return admission.ValidationResponse(false, fmt.Sprintf("the console has no command: %v", err))
+		}
+	}
+
+	if err := tpl.AllowsCommand(command); err != nil {
+		logger.Info("validation failure", "event", "validation.failure", "error", err)
+		return admission.ValidationResponse(false, err.Error())
+	}
+
+	logger.Info("completed validation", "event", "validation.success")
+	return admission.ValidationResponse(true, "")
+}
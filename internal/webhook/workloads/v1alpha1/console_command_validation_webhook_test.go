@@ -0,0 +1,137 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+var _ = Describe("Console command validation webhook", func() {
+	var (
+		tpl     *workloadsv1alpha1.ConsoleTemplate
+		csl     *workloadsv1alpha1.Console
+		objects []runtime.Object
+		resp    admission.Response
+	)
+
+	BeforeEach(func() {
+		tpl = &workloadsv1alpha1.ConsoleTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "app"},
+			Spec: workloadsv1alpha1.ConsoleTemplateSpec{
+				Template: workloadsv1alpha1.PodTemplatePreserveMetadataSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "app", Command: []string{"rake", "db:migrate"}}},
+					},
+				},
+				RestrictCommands: true,
+				AuthorisationRules: []workloadsv1alpha1.ConsoleAuthorisationRule{
+					{
+						Name:                 "migrations",
+						MatchCommandElements: []string{"rake", "re:db:(migrate|rollback)"},
+						MatcherSyntax:        workloadsv1alpha1.CommandMatcherSyntaxTyped,
+					},
+				},
+			},
+		}
+		csl = &workloadsv1alpha1.Console{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "app-abc"},
+			Spec: workloadsv1alpha1.ConsoleSpec{
+				ConsoleTemplateRef: corev1.LocalObjectReference{Name: "app"},
+				Command:            []string{"rake", "db:rollback"},
+			},
+		}
+		objects = []runtime.Object{tpl}
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(workloadsv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		raw, err := json.Marshal(csl)
+		Expect(err).NotTo(HaveOccurred())
+
+		webhook := NewConsoleCommandValidationWebhook(
+			fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build(),
+			logr.Discard(),
+			scheme,
+		)
+
+		resp = webhook.Handle(context.TODO(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Namespace: "payments",
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+	})
+
+	It("allows a command that matches a rule", func() {
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	Context("With a command that doesn't match a rule", func() {
+		BeforeEach(func() {
+			csl.Spec.Command = []string{"rails", "console"}
+		})
+
+		It("rejects the console, listing the allowed commands", func() {
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(Equal(
+				`command "rails console" is not allowed by console template app, which only allows commands matching: ["rake", "re:db:(migrate|rollback)"]`,
+			))
+		})
+
+		Context("When the template doesn't restrict commands", func() {
+			BeforeEach(func() {
+				tpl.Spec.RestrictCommands = false
+			})
+
+			It("allows the console", func() {
+				Expect(resp.Allowed).To(BeTrue())
+			})
+		})
+	})
+
+	Context("Without a command", func() {
+		BeforeEach(func() {
+			csl.Spec.Command = nil
+		})
+
+		It("validates the template's default command", func() {
+			Expect(resp.Allowed).To(BeTrue())
+		})
+
+		Context("When the default command isn't allowed", func() {
+			BeforeEach(func() {
+				tpl.Spec.Template.Spec.Containers[0].Command = []string{"bash"}
+			})
+
+			It("rejects the console", func() {
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring(`command "bash" is not allowed`))
+			})
+		})
+	})
+
+	Context("When the template doesn't exist", func() {
+		BeforeEach(func() {
+			objects = nil
+		})
+
+		It("allows the console, leaving the controller to report it", func() {
+			Expect(resp.Allowed).To(BeTrue())
+		})
+	})
+})
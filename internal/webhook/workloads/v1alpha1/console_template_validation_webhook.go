@@ -10,21 +10,27 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+	directoryrolebinding "github.com/gocardless/theatre/v5/internal/controller/rbac"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // +kubebuilder:object:generate=false
 type ConsoleTemplateValidationWebhook struct {
-	logger  logr.Logger
-	decoder admission.Decoder
+	logger      logr.Logger
+	decoder     admission.Decoder
+	directories directoryrolebinding.DirectoryProvider
 }
 
-func NewConsoleTemplateValidationWebhook(logger logr.Logger, scheme *runtime.Scheme) *ConsoleTemplateValidationWebhook {
+// NewConsoleTemplateValidationWebhook creates a webhook that validates console
+// templates, rejecting clauses that name subjects of a kind with no directory
+// among those the workloads-manager is run with.
+func NewConsoleTemplateValidationWebhook(logger logr.Logger, scheme *runtime.Scheme, directories directoryrolebinding.DirectoryProvider) *ConsoleTemplateValidationWebhook {
 	decoder := admission.NewDecoder(scheme)
 
 	return &ConsoleTemplateValidationWebhook{
-		logger:  logger,
-		decoder: decoder,
+		logger:      logger,
+		decoder:     decoder,
+		directories: directories,
 	}
 }
 
@@ -41,7 +47,13 @@ func (c *ConsoleTemplateValidationWebhook) Handle(ctx context.Context, req admis
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	if err := template.Validate(); err != nil {
+	err := template.Validate()
+	if err == nil {
+		err = template.ValidateSubjectKinds(func(kind string) bool {
+			return c.directories.Get(kind) != nil
+		})
+	}
+	if err != nil {
 		logger.Info("validation failure", "event", "validation.failure")
 		return admission.ValidationResponse(false, fmt.Sprintf("the console template spec is invalid: %v", err))
 	}
@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+// +kubebuilder:object:generate=false
+type ConsoleUpdateWebhook struct {
+	logger  logr.Logger
+	decoder admission.Decoder
+}
+
+func NewConsoleUpdateWebhook(logger logr.Logger, scheme *runtime.Scheme) *ConsoleUpdateWebhook {
+	decoder := admission.NewDecoder(scheme)
+
+	return &ConsoleUpdateWebhook{
+		logger:  logger,
+		decoder: decoder,
+	}
+}
+
+func (c *ConsoleUpdateWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := c.logger.WithValues("uuid", string(req.UID))
+	logger.Info("starting request", "event", "request.start")
+	defer func(start time.Time) {
+		logger.Info("completed request", "event", "request.end", "duration", time.Since(start).Seconds())
+	}(time.Now())
+
+	// requested console object
+	updatedCsl := &workloadsv1alpha1.Console{}
+	if err := c.decoder.DecodeRaw(req.Object, updatedCsl); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// existing console object
+	existingCsl := &workloadsv1alpha1.Console{}
+	if err := c.decoder.DecodeRaw(req.OldObject, existingCsl); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	update := &ConsoleUpdate{
+		existingCsl: existingCsl,
+		updatedCsl:  updatedCsl,
+		user:        req.AdmissionRequest.UserInfo.Username,
+	}
+
+	if err := update.Validate(); err != nil {
+		logger.Info("validation failure", "event", "validation.failure", "error", err)
+		return admission.ValidationResponse(false, fmt.Sprintf("the console update is invalid: %v", err))
+	}
+
+	logger.Info("completed validation", "event", "validation.success")
+	return admission.ValidationResponse(true, "")
+}
+
+// ConsoleUpdate represents an update to a console. Console owners are granted
+// permission to update their own console so that they can request timeout
+// extensions, which means we have to ensure that is the only change they make.
+type ConsoleUpdate struct {
+	existingCsl *workloadsv1alpha1.Console
+	updatedCsl  *workloadsv1alpha1.Console
+	user        string
+}
+
+func (u *ConsoleUpdate) Validate() error {
+	// Updates made by anyone other than the console owner are governed purely by
+	// RBAC, e.g. the workloads-manager reconciling the console.
+	if u.user != u.existingCsl.Spec.User {
+		return nil
+	}
+
+	var err error
+
+	existingExtensions := u.existingCsl.Spec.TimeoutExtensions
+	updatedExtensions := u.updatedCsl.Spec.TimeoutExtensions
+
+	// check existing extensions haven't been modified and that a single
+	// extension has been added
+	if len(updatedExtensions) < len(existingExtensions) ||
+		(len(existingExtensions) > 0 && !reflect.DeepEqual(updatedExtensions[:len(existingExtensions)], existingExtensions)) ||
+		len(updatedExtensions)-len(existingExtensions) > 1 {
+		err = multierror.Append(err, errors.New("the spec.timeoutExtensions field can only be appended to (with one extension) per update"))
+	}
+
+	// check the rest of the spec hasn't been modified
+	existingSpec := u.existingCsl.Spec.DeepCopy()
+	existingSpec.TimeoutExtensions = nil
+	updatedSpec := u.updatedCsl.Spec.DeepCopy()
+	updatedSpec.TimeoutExtensions = nil
+
+	if !reflect.DeepEqual(existingSpec, updatedSpec) {
+		err = multierror.Append(err, errors.New("the console owner can only modify the spec.timeoutExtensions field"))
+	}
+
+	// check the metadata hasn't been modified, as otherwise the owner could
+	// strip the finalizers or owner references. The API server maintains the
+	// resource version, managed fields and generation on every update, so
+	// changes to those are expected.
+	existingMeta := u.existingCsl.ObjectMeta.DeepCopy()
+	updatedMeta := u.updatedCsl.ObjectMeta.DeepCopy()
+	for _, meta := range []*metav1.ObjectMeta{existingMeta, updatedMeta} {
+		meta.ResourceVersion = ""
+		meta.ManagedFields = nil
+		meta.Generation = 0
+	}
+
+	if !reflect.DeepEqual(existingMeta, updatedMeta) {
+		err = multierror.Append(err, errors.New("the console owner cannot modify the console metadata"))
+	}
+
+	if !reflect.DeepEqual(u.existingCsl.Status, u.updatedCsl.Status) {
+		err = multierror.Append(err, errors.New("the console owner cannot modify the console status"))
+	}
+
+	return err
+}
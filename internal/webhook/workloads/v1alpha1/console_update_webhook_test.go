@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	"net/http"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+func mustConsoleFixture(path string) *workloadsv1alpha1.Console {
+	console := &workloadsv1alpha1.Console{}
+
+	consoleFixtureYAML, _ := os.ReadFile(path)
+
+	decoder := serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer()
+	if err := runtime.DecodeInto(decoder, consoleFixtureYAML, console); err != nil {
+		admission.Errored(http.StatusBadRequest, err)
+	}
+
+	return console
+}
+
+var _ = Describe("Console update webhook", func() {
+	Describe("Validate", func() {
+		var (
+			updateFixture string
+			user          string
+			err           error
+		)
+
+		existingCsl := mustConsoleFixture("./testdata/console_existing.yaml")
+
+		BeforeEach(func() {
+			user = "user"
+		})
+
+		JustBeforeEach(func() {
+			update := &ConsoleUpdate{
+				existingCsl: existingCsl,
+				updatedCsl:  mustConsoleFixture(updateFixture),
+				user:        user,
+			}
+
+			err = update.Validate()
+		})
+
+		Context("Owner adding a single timeout extension", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_add_extension.yaml"
+			})
+
+			It("Returns no errors", func() {
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("Owner adding multiple timeout extensions", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_add_multiple_extensions.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("spec.timeoutExtensions field can only be appended to")))
+			})
+		})
+
+		Context("Owner modifying an existing timeout extension", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_modify_extension.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("spec.timeoutExtensions field can only be appended to")))
+			})
+		})
+
+		Context("Owner modifying other spec fields", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_modify_spec.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("can only modify the spec.timeoutExtensions field")))
+			})
+		})
+
+		Context("Owner modifying the metadata", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_modify_metadata.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("cannot modify the console metadata")))
+			})
+		})
+
+		Context("Owner modifying the status", func() {
+			BeforeEach(func() {
+				updateFixture = "./testdata/console_update_modify_status.yaml"
+			})
+
+			It("Returns an error", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(ContainSubstring("cannot modify the console status")))
+			})
+		})
+
+		Context("Another user modifying the console", func() {
+			BeforeEach(func() {
+				user = "system:serviceaccount:theatre-system:workloads-manager"
+				updateFixture = "./testdata/console_update_modify_status.yaml"
+			})
+
+			It("Returns no errors", func() {
+				Expect(err).To(BeNil())
+			})
+		})
+	})
+})
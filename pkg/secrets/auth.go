@@ -0,0 +1,180 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// These are the methods that can be used to obtain a Vault token
+const (
+	// AuthMethodKubernetes exchanges a Kubernetes service account token for a
+	// Vault token, using the Kubernetes auth backend
+	AuthMethodKubernetes = "kubernetes"
+	// AuthMethodJWT exchanges a JWT, such as an OIDC token, for a Vault token,
+	// using the JWT auth backend
+	AuthMethodJWT = "jwt"
+	// AuthMethodAppRole exchanges a role ID and secret ID for a Vault token,
+	// using the AppRole auth backend
+	AuthMethodAppRole = "approle"
+	// AuthMethodAgent reads a Vault token from the sink file of a Vault Agent,
+	// which is responsible for authenticating and renewing the token
+	AuthMethodAgent = "agent"
+)
+
+// AuthMethods are all the supported auth methods
+var AuthMethods = []string{AuthMethodKubernetes, AuthMethodJWT, AuthMethodAppRole, AuthMethodAgent}
+
+// Auth describes how to obtain a Vault token. Which fields are used depends on
+// the method.
+type Auth struct {
+	Method string
+	// MountPath of the auth backend, defaulting to the name of the method
+	MountPath string
+	// Role to request from the kubernetes and jwt backends
+	Role string
+	// JWT to present to the kubernetes and jwt backends. If empty, it is read
+	// from JWTFile.
+	JWT     string
+	JWTFile string
+	// RoleID and SecretID to present to the approle backend. If SecretID is
+	// empty, it is read from SecretIDFile.
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+	// TokenFile is the sink file of a Vault Agent
+	TokenFile string
+}
+
+// Validate checks that the fields required by the method are set
+func (a Auth) Validate() error {
+	switch a.Method {
+	case AuthMethodKubernetes:
+		return nil
+	case AuthMethodJWT:
+		if a.JWT == "" && a.JWTFile == "" {
+			return fmt.Errorf("%s auth method requires a JWT file", a.Method)
+		}
+	case AuthMethodAppRole:
+		if a.RoleID == "" {
+			return fmt.Errorf("%s auth method requires a role ID", a.Method)
+		}
+		if a.SecretID == "" && a.SecretIDFile == "" {
+			return fmt.Errorf("%s auth method requires a secret ID", a.Method)
+		}
+	case AuthMethodAgent:
+		if a.TokenFile == "" {
+			return fmt.Errorf("%s auth method requires a token file", a.Method)
+		}
+	default:
+		return fmt.Errorf("unsupported auth method %q, must be one of: %s", a.Method, strings.Join(AuthMethods, ", "))
+	}
+
+	return nil
+}
+
+// Mount returns the mount path of the auth backend
+func (a Auth) Mount() string {
+	if a.MountPath != "" {
+		return a.MountPath
+	}
+
+	return a.Method
+}
+
+// Login obtains a Vault token using the configured method
+func (a Auth) Login(client *api.Client, logger logr.Logger) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	var body map[string]string
+	switch a.Method {
+	case AuthMethodAgent:
+		// The agent has already logged in for us, so we only need its token
+		token, err := readCredentialFile(a.TokenFile)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read vault agent token file")
+		}
+
+		return token, nil
+
+	case AuthMethodKubernetes, AuthMethodJWT:
+		jwt := a.JWT
+		if jwt == "" {
+			var err error
+			if jwt, err = readCredentialFile(a.JWTFile); err != nil {
+				return "", errors.Wrap(err, "failed to read JWT file")
+			}
+		}
+		body = map[string]string{"jwt": jwt, "role": a.Role}
+
+	case AuthMethodAppRole:
+		secretID := a.SecretID
+		if secretID == "" {
+			contents, err := os.ReadFile(a.SecretIDFile)
+			if err != nil {
+				return "", errors.Wrap(err, "failed to read approle secret ID file")
+			}
+			secretID = strings.TrimSpace(string(contents))
+			clear(contents)
+		}
+		body = map[string]string{"role_id": a.RoleID, "secret_id": secretID}
+	}
+
+	req := client.NewRequest("POST", fmt.Sprintf("/v1/auth/%s/login", a.Mount()))
+	if err := req.SetJSONBody(body); err != nil {
+		return "", errors.Wrap(err, "failed to encode vault login request")
+	}
+
+	// The request body contains long-lived credentials, such as the AppRole
+	// secret ID, so don't leave it in memory once we're done with it
+	defer clear(req.BodyBytes)
+
+	start := time.Now()
+	resp, err := client.RawRequest(req)
+
+	// Use verbosity 1, which is equal to debug level
+	logger.V(1).Info(
+		"Vault login finished",
+		"event", "vault_login_request.finished",
+		"method", a.Method,
+		"duration", time.Since(start).Seconds(),
+		"outcome", outcome(err),
+	)
+
+	if err != nil {
+		return "", errors.Wrap(err, "failed to perform login POST request against Vault auth backend mount")
+	}
+
+	if err := resp.Error(); err != nil {
+		return "", errors.Wrap(err, "received error response from login POST request against Vault auth backend mount")
+	}
+
+	var secret api.Secret
+	if err := resp.DecodeJSON(&secret); err != nil {
+		return "", errors.Wrap(err, "failed to decode vault login response")
+	}
+
+	if secret.Auth == nil {
+		return "", fmt.Errorf("vault login response contained no token")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+// readCredentialFile reads a token or secret from a file, ignoring surrounding
+// whitespace such as a trailing newline
+func readCredentialFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auth", func() {
+	var (
+		server *httptest.Server
+		client *api.Client
+		auth   Auth
+		logins map[string]map[string]string
+		token  string
+		err    error
+	)
+
+	BeforeEach(func() {
+		logins = map[string]map[string]string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			logins[r.URL.Path] = body
+
+			fmt.Fprint(w, `{"auth":{"client_token":"s.vault-token"}}`)
+		}))
+
+		cfg := api.DefaultConfig()
+		cfg.Address = server.URL
+		client, err = api.NewClient(cfg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		token, err = auth.Login(client, logr.Discard())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("with the kubernetes method", func() {
+		BeforeEach(func() {
+			auth = Auth{Method: AuthMethodKubernetes, MountPath: "kubernetes.cluster", Role: "default", JWT: "service-account-token"}
+		})
+
+		It("logs in with the service account token", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("s.vault-token"))
+			Expect(logins).To(Equal(map[string]map[string]string{
+				"/v1/auth/kubernetes.cluster/login": {"jwt": "service-account-token", "role": "default"},
+			}))
+		})
+	})
+
+	Context("with the jwt method", func() {
+		BeforeEach(func() {
+			path := filepath.Join(tempDir, "token")
+			Expect(os.WriteFile(path, []byte("oidc-token\n"), 0600)).To(Succeed())
+			auth = Auth{Method: AuthMethodJWT, Role: "app", JWTFile: path}
+		})
+
+		It("logs in with the token from the file, using the default mount", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logins).To(Equal(map[string]map[string]string{
+				"/v1/auth/jwt/login": {"jwt": "oidc-token", "role": "app"},
+			}))
+		})
+	})
+
+	Context("with the approle method", func() {
+		BeforeEach(func() {
+			path := filepath.Join(tempDir, "secret-id")
+			Expect(os.WriteFile(path, []byte("secret-id"), 0600)).To(Succeed())
+			auth = Auth{Method: AuthMethodAppRole, RoleID: "role-id", SecretIDFile: path}
+		})
+
+		It("logs in with the role and secret IDs", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logins).To(Equal(map[string]map[string]string{
+				"/v1/auth/approle/login": {"role_id": "role-id", "secret_id": "secret-id"},
+			}))
+		})
+
+		Context("without a role ID", func() {
+			BeforeEach(func() {
+				auth.RoleID = ""
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("requires a role ID")))
+				Expect(logins).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("with the agent method", func() {
+		BeforeEach(func() {
+			path := filepath.Join(tempDir, ".vault-token")
+			Expect(os.WriteFile(path, []byte("s.agent-token\n"), 0600)).To(Succeed())
+			auth = Auth{Method: AuthMethodAgent, TokenFile: path}
+		})
+
+		It("uses the token from the sink without logging in", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("s.agent-token"))
+			Expect(logins).To(BeEmpty())
+		})
+	})
+
+	Context("with an unknown method", func() {
+		BeforeEach(func() {
+			auth = Auth{Method: "ldap"}
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring(`unsupported auth method "ldap"`)))
+		})
+	})
+})
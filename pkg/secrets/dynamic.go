@@ -0,0 +1,171 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Lease describes how long a secret from a dynamic secrets engine is valid for,
+// and whether it can be renewed.
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+}
+
+func leaseFromSecret(secret *api.Secret) *Lease {
+	return &Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}
+}
+
+// LeaseEnvironment returns the environment variables that expose a lease to the
+// wrapped process, named after the variable that referenced the secret.
+func LeaseEnvironment(key string, lease *Lease) map[string]string {
+	return map[string]string{
+		key + "_LEASE_ID":       lease.ID,
+		key + "_LEASE_DURATION": strconv.Itoa(int(lease.Duration.Seconds())),
+	}
+}
+
+// ReadDynamic generates a secret from a dynamic secrets engine, such as the
+// database or AWS engines. Unlike KV secrets, the path is not relative to the
+// path prefix of the reader, and the fields are not nested under a data key.
+func (r *Reader) ReadDynamic(path string) (Secret, error) {
+	resp, err := r.request("vault_dynamic_request.finished", path, func() (*api.Secret, error) {
+		return r.Client.Logical().Read(path)
+	})
+	if err != nil {
+		return Secret{}, errors.Wrap(err, "failed to generate dynamic secret from Vault")
+	}
+
+	if resp == nil {
+		return Secret{}, &SecretNotFoundError{Path: path}
+	}
+
+	if resp.Data == nil {
+		return Secret{}, &MalformedSecretError{Path: path}
+	}
+
+	return Secret{Path: path, Data: resp.Data, Lease: leaseFromSecret(resp)}, nil
+}
+
+// ReadAllDynamic generates a secret from each of the given paths, returning
+// them keyed by path
+func (r *Reader) ReadAllDynamic(paths []string) (map[string]Secret, error) {
+	secrets := make(map[string]Secret, len(paths))
+	for _, path := range paths {
+		secret, err := r.ReadDynamic(path)
+		if err != nil {
+			return nil, err
+		}
+		secrets[path] = secret
+	}
+
+	return secrets, nil
+}
+
+// These are the names of the files that an issued certificate is written to,
+// matching those of a kubernetes.io/tls secret
+const (
+	CertificateFile = "tls.crt"
+	PrivateKeyFile  = "tls.key"
+	CAFile          = "ca.crt"
+)
+
+// Certificate is a certificate issued by a PKI secrets engine
+type Certificate struct {
+	Path        string
+	Certificate string
+	PrivateKey  string
+	IssuingCA   string
+	CAChain     []string
+	Lease       *Lease
+}
+
+// IssueCertificate requests a new certificate from a PKI secrets engine
+func (r *Reader) IssueCertificate(ref PKIReference) (*Certificate, error) {
+	parameters := make(map[string]interface{}, len(ref.Parameters))
+	for key, value := range ref.Parameters {
+		parameters[key] = value
+	}
+
+	resp, err := r.request("vault_pki_request.finished", ref.Path, func() (*api.Secret, error) {
+		return r.Client.Logical().Write(ref.Path, parameters)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to issue certificate from Vault")
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, &MalformedSecretError{Path: ref.Path}
+	}
+
+	secret := Secret{Path: ref.Path, Data: resp.Data}
+	cert := &Certificate{Path: ref.Path, Lease: leaseFromSecret(resp)}
+	for field, value := range map[string]*string{
+		"certificate": &cert.Certificate,
+		"private_key": &cert.PrivateKey,
+		"issuing_ca":  &cert.IssuingCA,
+	} {
+		if *value, err = secret.Field(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if chain, ok := resp.Data["ca_chain"].([]interface{}); ok {
+		for _, ca := range chain {
+			cert.CAChain = append(cert.CAChain, fmt.Sprint(ca))
+		}
+	}
+
+	// The PKI engine doesn't create leases for certificates unless the role asks
+	// it to, so fall back to the expiry of the certificate to tell the process
+	// how long it is valid for.
+	if cert.Lease.Duration == 0 {
+		if expiration, ok := resp.Data["expiration"].(json.Number); ok {
+			if seconds, err := expiration.Int64(); err == nil {
+				cert.Lease.Duration = time.Until(time.Unix(seconds, 0)).Truncate(time.Second)
+			}
+		}
+	}
+
+	return cert, nil
+}
+
+// WriteFiles writes the certificate, private key and CA certificates to the
+// given directory, creating it if necessary.
+func (c *Certificate) WriteFiles(directory string) error {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return errors.Wrap(err, "failed to ensure path structure is available")
+	}
+
+	ca := c.IssuingCA + "\n"
+	for _, chained := range c.CAChain {
+		if chained != c.IssuingCA {
+			ca += chained + "\n"
+		}
+	}
+
+	for name, contents := range map[string]string{
+		CertificateFile: c.Certificate + "\n",
+		PrivateKeyFile:  c.PrivateKey + "\n",
+		CAFile:          ca,
+	} {
+		path := filepath.Join(directory, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			return errors.Wrapf(err, "failed to write certificate file %s", path)
+		}
+	}
+
+	return nil
+}
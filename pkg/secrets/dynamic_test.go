@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynamic secrets", func() {
+	var (
+		server   *httptest.Server
+		reader   *Reader
+		requests []*http.Request
+		bodies   []map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		requests, bodies = nil, nil
+		expiration := time.Now().Add(time.Hour).Unix()
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+
+			switch strings.TrimPrefix(r.URL.Path, "/v1/") {
+			case "database/creds/app":
+				fmt.Fprint(w, `{
+					"lease_id": "database/creds/app/abc123",
+					"lease_duration": 3600,
+					"renewable": true,
+					"data": {"username": "v-app-xyz", "password": "hunter2"}
+				}`)
+			case "pki/issue/web":
+				fmt.Fprintf(w, `{
+					"data": {
+						"certificate": "CERT",
+						"private_key": "KEY",
+						"issuing_ca": "CA",
+						"ca_chain": ["CA", "ROOT"],
+						"expiration": %d
+					}
+				}`, expiration)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+			}
+		}))
+
+		cfg := api.DefaultConfig()
+		cfg.Address = server.URL
+		client, err := api.NewClient(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		reader = &Reader{Client: client, PathPrefix: "secret/data", Logger: logr.Discard()}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("ReadDynamic", func() {
+		It("reads fields and the lease without applying the path prefix", func() {
+			secret, err := reader.ReadDynamic("database/creds/app")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests[0].URL.Path).To(Equal("/v1/database/creds/app"))
+			Expect(secret.Field("username")).To(Equal("v-app-xyz"))
+			Expect(secret.Field("password")).To(Equal("hunter2"))
+			Expect(secret.Lease).To(Equal(&Lease{
+				ID:        "database/creds/app/abc123",
+				Duration:  time.Hour,
+				Renewable: true,
+			}))
+		})
+
+		It("returns a SecretNotFoundError for missing paths", func() {
+			_, err := reader.ReadDynamic("database/creds/missing")
+			Expect(err).To(Equal(&SecretNotFoundError{Path: "database/creds/missing"}))
+		})
+
+		It("reads each path once in ReadAllDynamic", func() {
+			secrets, err := reader.ReadAllDynamic([]string{"database/creds/app"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(HaveKey("database/creds/app"))
+			Expect(requests).To(HaveLen(1))
+		})
+	})
+
+	Describe("IssueCertificate", func() {
+		var (
+			cert *Certificate
+			err  error
+		)
+
+		BeforeEach(func() {
+			cert, err = reader.IssueCertificate(PKIReference{
+				Path:       "pki/issue/web",
+				Parameters: map[string]string{"common_name": "web.example.com"},
+			})
+		})
+
+		It("sends the parameters and returns the certificate", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests[0].Method).To(Equal(http.MethodPut))
+			Expect(bodies[0]).To(Equal(map[string]interface{}{"common_name": "web.example.com"}))
+			Expect(cert.Certificate).To(Equal("CERT"))
+			Expect(cert.PrivateKey).To(Equal("KEY"))
+			Expect(cert.IssuingCA).To(Equal("CA"))
+			Expect(cert.CAChain).To(Equal([]string{"CA", "ROOT"}))
+		})
+
+		It("uses the certificate expiry as the lease duration", func() {
+			Expect(cert.Lease.ID).To(BeEmpty())
+			Expect(cert.Lease.Duration).To(BeNumerically("~", time.Hour, time.Minute))
+		})
+
+		It("writes the certificate files", func() {
+			directory := filepath.Join(tempDir, "tls")
+			Expect(cert.WriteFiles(directory)).To(Succeed())
+
+			for name, contents := range map[string]string{
+				CertificateFile: "CERT\n",
+				PrivateKeyFile:  "KEY\n",
+				CAFile:          "CA\nROOT\n",
+			} {
+				data, err := os.ReadFile(filepath.Join(directory, name))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).To(Equal(contents))
+			}
+		})
+	})
+})
+
+var _ = Describe("LeaseEnvironment", func() {
+	It("names variables after the referencing variable", func() {
+		Expect(LeaseEnvironment("PG_USER", &Lease{ID: "database/creds/app/abc123", Duration: time.Hour})).To(Equal(map[string]string{
+			"PG_USER_LEASE_ID":       "database/creds/app/abc123",
+			"PG_USER_LEASE_DURATION": "3600",
+		}))
+	})
+})
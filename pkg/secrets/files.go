@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFileAtomic writes data to a temporary file in the same directory as path
+// and renames it into place, so that readers never see a partially written
+// file. It returns whether the contents of the file changed.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, errors.Wrap(err, "failed to ensure path structure is available")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to create temporary file for %s", path)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, errors.Wrapf(err, "failed to write temporary file for %s", path)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return false, errors.Wrapf(err, "failed to write temporary file for %s", path)
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return false, errors.Wrapf(err, "failed to set permissions of %s", path)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, errors.Wrapf(err, "failed to move temporary file to %s", path)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,268 @@
+package secrets
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// These prefixes mark environment variables whose values reference secrets in
+// Vault, rather than being plain values
+const (
+	// PrefixVault replaces the value of the environment variable with the
+	// secret, e.g. vault:db/creds#password
+	PrefixVault = "vault:"
+	// PrefixVaultFile writes the secret to a file and replaces the value of the
+	// environment variable with its path, e.g.
+	// vault-file:ssh-key/2021010100:/home/user/.ssh/id_rsa
+	PrefixVaultFile = "vault-file:"
+	// PrefixVaultExpand sets an environment variable for every field of the
+	// secret, named after the original variable and the field, e.g.
+	// DATABASE=vault-expand:db/creds sets DATABASE_USERNAME and
+	// DATABASE_PASSWORD
+	PrefixVaultExpand = "vault-expand:"
+	// PrefixVaultDynamic replaces the value of the environment variable with a
+	// field of a secret from a dynamic secrets engine, such as database or AWS
+	// credentials, e.g. vault-dynamic:database/creds/app#username
+	PrefixVaultDynamic = "vault-dynamic:"
+	// PrefixVaultPKI issues a certificate from a PKI secrets engine, writes it to
+	// a directory and replaces the value of the environment variable with the
+	// path of the directory, e.g.
+	// vault-pki:pki/issue/web?common_name=web.example.com:/etc/tls
+	PrefixVaultPKI = "vault-pki:"
+)
+
+// DefaultField is the field of a secret that is used when a reference doesn't
+// select one
+const DefaultField = "data"
+
+// Reference identifies a field of a secret stored at a Vault path, written as
+// path#field. The field defaults to DefaultField if not given.
+type Reference struct {
+	Path  string
+	Field string
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%s#%s", r.Path, r.Field)
+}
+
+// ParseReference parses a reference in the form path or path#field
+func ParseReference(value string) (Reference, error) {
+	path, field, found := strings.Cut(strings.TrimSpace(value), "#")
+	if path == "" {
+		return Reference{}, fmt.Errorf("missing secret path in reference: %q", value)
+	}
+	if found && field == "" {
+		return Reference{}, fmt.Errorf("missing field after # in reference: %q", value)
+	}
+	if !found {
+		field = DefaultField
+	}
+
+	return Reference{Path: path, Field: field}, nil
+}
+
+// FileReference is a reference to a secret to be written to a file. If
+// FilesystemPath is empty, a temporary file is used.
+type FileReference struct {
+	Reference
+	FilesystemPath string
+}
+
+// ParseFileReference parses a reference in the form path[#field][:filesystem-path]
+func ParseFileReference(value string) (FileReference, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return FileReference{}, fmt.Errorf("empty vault-file reference")
+	}
+
+	secret, filesystemPath, _ := strings.Cut(trimmed, ":")
+	ref, err := ParseReference(secret)
+	if err != nil {
+		return FileReference{}, err
+	}
+
+	return FileReference{Reference: ref, FilesystemPath: filesystemPath}, nil
+}
+
+// PKIReference is a request to issue a certificate from a PKI secrets engine.
+// Parameters are sent with the request, and must include those required by the
+// role, such as common_name. If Directory is empty, a temporary directory is
+// used.
+type PKIReference struct {
+	Path       string
+	Parameters map[string]string
+	Directory  string
+}
+
+// ParsePKIReference parses a reference in the form
+// path[?parameter=value&...][#directory]. Parameter values can contain colons,
+// e.g. IP or URI SANs, but a # must be escaped as %23.
+func ParsePKIReference(value string) (PKIReference, error) {
+	trimmed := strings.TrimSpace(value)
+	request, directory, _ := strings.Cut(trimmed, "#")
+	path, query, _ := strings.Cut(request, "?")
+	if path == "" {
+		return PKIReference{}, fmt.Errorf("missing secret path in reference: %q", value)
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return PKIReference{}, fmt.Errorf("invalid parameters in reference %q: %w", value, err)
+	}
+
+	parameters := map[string]string{}
+	for key := range values {
+		parameters[key] = values.Get(key)
+	}
+
+	return PKIReference{Path: path, Parameters: parameters, Directory: directory}, nil
+}
+
+// EnvironmentReferences is the result of parsing an environment for references
+// to Vault secrets, keyed by environment variable name
+type EnvironmentReferences struct {
+	// Variables that don't reference a secret
+	Plain map[string]string
+	// Variables to be replaced with the value of a secret
+	Values map[string]Reference
+	// Variables to be replaced with the path of a file containing a secret
+	Files map[string]FileReference
+	// Variables to be expanded into one variable per field of a secret. Only
+	// the path of these references is used.
+	Expanded map[string]Reference
+	// Variables to be replaced with a field of a secret from a dynamic secrets
+	// engine
+	Dynamic map[string]Reference
+	// Variables to be replaced with the path of a directory containing an
+	// issued certificate
+	PKI map[string]PKIReference
+}
+
+// ParseEnvironment sorts the environment into plain variables and those that
+// reference secrets, returning an error for any malformed reference.
+func ParseEnvironment(env map[string]string) (*EnvironmentReferences, error) {
+	refs := newEnvironmentReferences()
+	for key, value := range env {
+		if err := refs.add(key, value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	return refs, nil
+}
+
+func newEnvironmentReferences() *EnvironmentReferences {
+	return &EnvironmentReferences{
+		Plain:    map[string]string{},
+		Values:   map[string]Reference{},
+		Files:    map[string]FileReference{},
+		Expanded: map[string]Reference{},
+		Dynamic:  map[string]Reference{},
+		PKI:      map[string]PKIReference{},
+	}
+}
+
+// add parses a single environment variable into the references
+func (e *EnvironmentReferences) add(key, value string) error {
+	switch {
+	case strings.HasPrefix(value, PrefixVault):
+		ref, err := ParseReference(strings.TrimPrefix(value, PrefixVault))
+		if err != nil {
+			return err
+		}
+		e.Values[key] = ref
+
+	case strings.HasPrefix(value, PrefixVaultFile):
+		ref, err := ParseFileReference(strings.TrimPrefix(value, PrefixVaultFile))
+		if err != nil {
+			return err
+		}
+		e.Files[key] = ref
+
+	case strings.HasPrefix(value, PrefixVaultExpand):
+		ref, err := ParseReference(strings.TrimPrefix(value, PrefixVaultExpand))
+		if err != nil {
+			return err
+		}
+		if strings.Contains(value, "#") {
+			return fmt.Errorf("%s references cannot select a field", PrefixVaultExpand)
+		}
+		e.Expanded[key] = ref
+
+	case strings.HasPrefix(value, PrefixVaultDynamic):
+		ref, err := ParseReference(strings.TrimPrefix(value, PrefixVaultDynamic))
+		if err != nil {
+			return err
+		}
+		// Dynamic secrets have no conventional field, so one must be selected
+		if !strings.Contains(value, "#") {
+			return fmt.Errorf("%s references must select a field", PrefixVaultDynamic)
+		}
+		e.Dynamic[key] = ref
+
+	case strings.HasPrefix(value, PrefixVaultPKI):
+		ref, err := ParsePKIReference(strings.TrimPrefix(value, PrefixVaultPKI))
+		if err != nil {
+			return err
+		}
+		e.PKI[key] = ref
+
+	default:
+		e.Plain[key] = value
+	}
+
+	return nil
+}
+
+// Paths returns the distinct KV paths referenced by the environment, so that
+// each secret is only read once.
+func (e *EnvironmentReferences) Paths() []string {
+	set := map[string]bool{}
+	for _, ref := range e.Values {
+		set[ref.Path] = true
+	}
+	for _, ref := range e.Files {
+		set[ref.Path] = true
+	}
+	for _, ref := range e.Expanded {
+		set[ref.Path] = true
+	}
+
+	return sortedKeys(set)
+}
+
+// DynamicPaths returns the distinct dynamic secret paths referenced by the
+// environment. Each read of a dynamic secret generates new credentials, so
+// variables that reference the same path must share a single read for their
+// fields to match, e.g. a database username and password.
+func (e *EnvironmentReferences) DynamicPaths() []string {
+	set := map[string]bool{}
+	for _, ref := range e.Dynamic {
+		set[ref.Path] = true
+	}
+
+	return sortedKeys(set)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+var invalidEnvironmentCharacters = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// ExpandedName returns the name of the environment variable that a field of an
+// expanded secret is stored in, e.g. DATABASE_PASSWORD for the password field
+// of DATABASE=vault-expand:db/creds.
+func ExpandedName(key, field string) string {
+	return key + "_" + invalidEnvironmentCharacters.ReplaceAllString(strings.ToUpper(field), "_")
+}
@@ -0,0 +1,170 @@
+package secrets
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseReference", func() {
+	It("defaults the field", func() {
+		Expect(ParseReference("db/creds")).To(Equal(Reference{Path: "db/creds", Field: DefaultField}))
+	})
+
+	It("selects a field after #", func() {
+		Expect(ParseReference("db/creds#password")).To(Equal(Reference{Path: "db/creds", Field: "password"}))
+	})
+
+	It("rejects a reference without a path", func() {
+		_, err := ParseReference("#password")
+		Expect(err).To(MatchError(ContainSubstring("missing secret path")))
+	})
+
+	It("rejects a reference with an empty field", func() {
+		_, err := ParseReference("db/creds#")
+		Expect(err).To(MatchError(ContainSubstring("missing field")))
+	})
+})
+
+var _ = Describe("ParseFileReference", func() {
+	It("parses a reference without a filesystem path", func() {
+		Expect(ParseFileReference("tls-key/2021010100")).To(Equal(FileReference{
+			Reference: Reference{Path: "tls-key/2021010100", Field: DefaultField},
+		}))
+	})
+
+	It("parses a reference with a field and filesystem path", func() {
+		Expect(ParseFileReference("ssh-key#private:/home/user/.ssh/id_rsa")).To(Equal(FileReference{
+			Reference:      Reference{Path: "ssh-key", Field: "private"},
+			FilesystemPath: "/home/user/.ssh/id_rsa",
+		}))
+	})
+
+	It("rejects an empty reference", func() {
+		_, err := ParseFileReference("  ")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ParsePKIReference", func() {
+	It("parses parameters and a directory", func() {
+		Expect(ParsePKIReference("pki/issue/web?common_name=web.example.com&ttl=24h#/etc/tls")).To(Equal(PKIReference{
+			Path:       "pki/issue/web",
+			Parameters: map[string]string{"common_name": "web.example.com", "ttl": "24h"},
+			Directory:  "/etc/tls",
+		}))
+	})
+
+	It("parses parameters containing colons", func() {
+		Expect(ParsePKIReference("pki/issue/web?common_name=web&ip_sans=::1,fd00::2&uri_sans=spiffe://cluster/web#/etc/tls")).To(Equal(PKIReference{
+			Path: "pki/issue/web",
+			Parameters: map[string]string{
+				"common_name": "web",
+				"ip_sans":     "::1,fd00::2",
+				"uri_sans":    "spiffe://cluster/web",
+			},
+			Directory: "/etc/tls",
+		}))
+	})
+
+	It("parses a reference with only a path", func() {
+		Expect(ParsePKIReference("pki/issue/web")).To(Equal(PKIReference{
+			Path:       "pki/issue/web",
+			Parameters: map[string]string{},
+		}))
+	})
+
+	It("rejects a reference without a path", func() {
+		_, err := ParsePKIReference("?common_name=web")
+		Expect(err).To(MatchError(ContainSubstring("missing secret path")))
+	})
+})
+
+var _ = Describe("ParseEnvironment", func() {
+	var (
+		env  map[string]string
+		refs *EnvironmentReferences
+		err  error
+	)
+
+	JustBeforeEach(func() {
+		refs, err = ParseEnvironment(env)
+	})
+
+	BeforeEach(func() {
+		env = map[string]string{
+			"HOME":        "/home/user",
+			"DB_PASSWORD": "vault:db/creds#password",
+			"API_KEY":     "vault:api-key",
+			"SSH_KEY":     "vault-file:ssh-key:/home/user/.ssh/id_rsa",
+			"DATABASE":    "vault-expand:db/creds",
+			"PG_USER":     "vault-dynamic:database/creds/app#username",
+			"PG_PASSWORD": "vault-dynamic:database/creds/app#password",
+			"TLS":         "vault-pki:pki/issue/web?common_name=web#/etc/tls",
+		}
+	})
+
+	It("sorts variables by how they reference secrets", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs.Plain).To(Equal(map[string]string{"HOME": "/home/user"}))
+		Expect(refs.Values).To(Equal(map[string]Reference{
+			"DB_PASSWORD": {Path: "db/creds", Field: "password"},
+			"API_KEY":     {Path: "api-key", Field: DefaultField},
+		}))
+		Expect(refs.Files).To(HaveKeyWithValue("SSH_KEY", FileReference{
+			Reference:      Reference{Path: "ssh-key", Field: DefaultField},
+			FilesystemPath: "/home/user/.ssh/id_rsa",
+		}))
+		Expect(refs.Expanded).To(HaveKeyWithValue("DATABASE", Reference{Path: "db/creds", Field: DefaultField}))
+		Expect(refs.Dynamic).To(Equal(map[string]Reference{
+			"PG_USER":     {Path: "database/creds/app", Field: "username"},
+			"PG_PASSWORD": {Path: "database/creds/app", Field: "password"},
+		}))
+		Expect(refs.PKI).To(HaveKeyWithValue("TLS", PKIReference{
+			Path:       "pki/issue/web",
+			Parameters: map[string]string{"common_name": "web"},
+			Directory:  "/etc/tls",
+		}))
+	})
+
+	It("returns each referenced path once", func() {
+		Expect(refs.Paths()).To(Equal([]string{"api-key", "db/creds", "ssh-key"}))
+		Expect(refs.DynamicPaths()).To(Equal([]string{"database/creds/app"}))
+	})
+
+	Context("with a dynamic reference that doesn't select a field", func() {
+		BeforeEach(func() {
+			env["PG_USER"] = "vault-dynamic:database/creds/app"
+		})
+
+		It("returns an error naming the variable", func() {
+			Expect(err).To(MatchError(ContainSubstring("invalid PG_USER")))
+		})
+	})
+
+	Context("with an expand reference that selects a field", func() {
+		BeforeEach(func() {
+			env["DATABASE"] = "vault-expand:db/creds#password"
+		})
+
+		It("returns an error naming the variable", func() {
+			Expect(err).To(MatchError(ContainSubstring("invalid DATABASE")))
+		})
+	})
+
+	Context("with a malformed reference", func() {
+		BeforeEach(func() {
+			env["API_KEY"] = "vault:"
+		})
+
+		It("returns an error naming the variable", func() {
+			Expect(err).To(MatchError(ContainSubstring("invalid API_KEY")))
+		})
+	})
+})
+
+var _ = Describe("ExpandedName", func() {
+	It("upper-cases the field and replaces invalid characters", func() {
+		Expect(ExpandedName("DATABASE", "password")).To(Equal("DATABASE_PASSWORD"))
+		Expect(ExpandedName("DATABASE", "read-only.url")).To(Equal("DATABASE_READ_ONLY_URL"))
+	})
+})
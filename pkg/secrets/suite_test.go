@@ -0,0 +1,28 @@
+package secrets
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "pkg/secrets")
+}
+
+// tempDir is a temporary directory for each spec to write files to, removed
+// once the spec has finished
+var tempDir string
+
+var _ = BeforeEach(func() {
+	var err error
+	tempDir, err = os.MkdirTemp("", "theatre-secrets-")
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterEach(func() {
+	Expect(os.RemoveAll(tempDir)).To(Succeed())
+})
@@ -0,0 +1,466 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are passed on to the wrapped process, so that it behaves as
+// if it had been exec'd directly.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// renewalRetryInterval is how long to wait before retrying a failed renewal
+const renewalRetryInterval = 10 * time.Second
+
+// ParseSignal parses a signal name such as SIGHUP or HUP
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("unrecognised signal: %s", name)
+	}
+
+	return sig, nil
+}
+
+// ExitError is returned by Supervisor.Run when the wrapped process exits
+// unsuccessfully
+type ExitError struct {
+	ExitCode int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("wrapped process exited with code %d", e.ExitCode)
+}
+
+// Supervisor runs the wrapped process as a child, rather than replacing the
+// current process with it. While the child runs, it periodically rewrites
+// secret files with the latest values from Vault and renews the Vault token and
+// the leases of dynamic secrets.
+type Supervisor struct {
+	Reader *Reader
+	// Files to refresh, keyed by environment variable. The FilesystemPath of
+	// each must be set.
+	Files map[string]FileReference
+	// Templates to re-render
+	Templates []FileTemplate
+	// Leases to renew for as long as the child is running
+	Leases []*Lease
+	// Token is the lease of the Vault token, which is renewed if renewable
+	Token *Lease
+	// RefreshInterval is how often to re-read secret files from Vault
+	RefreshInterval time.Duration
+	// ReloadSignal is sent to the child whenever a secret file changes, if set
+	ReloadSignal os.Signal
+	// ReapChildren reaps any process that exits while parented to us, not just
+	// the child. This is needed when running as PID 1 in a container, where
+	// orphaned descendants of the child are reparented to us and would
+	// otherwise remain as zombies.
+	ReapChildren bool
+	Logger       logr.Logger
+}
+
+// renewal tracks when a lease is next due to be renewed
+type renewal struct {
+	name  string
+	lease *Lease
+	renew func() (*Lease, error)
+	due   time.Time
+}
+
+// Run starts the command and supervises it until it exits. Signals received by
+// the current process are forwarded to the command, as is SIGTERM when the
+// context is cancelled. An ExitError is returned if the command exits
+// unsuccessfully.
+func (s *Supervisor) Run(ctx context.Context, cmd *exec.Cmd) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	// When reaping, listen for SIGCHLD before starting the child so that we
+	// can't miss it exiting. The reaper collects the exit status of the child
+	// along with any other process, so we mustn't also wait on the child.
+	var childExited chan os.Signal
+	if s.ReapChildren {
+		childExited = make(chan os.Signal, 1)
+		signal.Notify(childExited, syscall.SIGCHLD)
+		defer signal.Stop(childExited)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to start wrapped program")
+	}
+
+	s.Logger.Info(
+		"supervising wrapped application",
+		"event", "supervisor.start",
+		"pid", cmd.Process.Pid,
+	)
+
+	exited := make(chan error, 1)
+	if !s.ReapChildren {
+		go func() {
+			exited <- cmd.Wait()
+		}()
+	}
+
+	var refresh <-chan time.Time
+	if (len(s.Files) > 0 || len(s.Templates) > 0) && s.RefreshInterval > 0 {
+		ticker := time.NewTicker(s.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	renewals := s.renewals()
+	renewTimer := time.NewTimer(0)
+	defer renewTimer.Stop()
+	renew := s.scheduleRenewal(renewTimer, renewals)
+
+	done := ctx.Done()
+	for {
+		select {
+		case sig := <-signals:
+			s.signal(cmd, sig)
+
+		case <-done:
+			s.signal(cmd, syscall.SIGTERM)
+			done = nil
+
+		case <-refresh:
+			changed, err := s.refresh()
+			if err != nil {
+				// Continue to run the child with its existing secrets, as Vault being
+				// briefly unavailable shouldn't take down the application.
+				s.Logger.Error(err, "failed to refresh secret files", "event", "supervisor.refresh_failed")
+			}
+			if changed && s.ReloadSignal != nil {
+				s.signal(cmd, s.ReloadSignal)
+			}
+
+		case <-renew:
+			renewals = s.renew(renewals)
+			renew = s.scheduleRenewal(renewTimer, renewals)
+
+		case <-childExited:
+			if status, ok := s.reap(cmd.Process.Pid); ok {
+				cmd.Process.Release()
+				return exitStatusError(status)
+			}
+
+		case err := <-exited:
+			return exitError(err)
+		}
+	}
+}
+
+// reap collects the exit status of every process parented to us that has
+// exited, returning the status of the child if it is among them. Signals are
+// coalesced, so a single SIGCHLD may cover several processes.
+func (s *Supervisor) reap(child int) (syscall.WaitStatus, bool) {
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		// ECHILD means there are no processes left to wait on, and a pid of 0
+		// that none of them have exited
+		if err != nil || pid <= 0 {
+			return 0, false
+		}
+
+		if pid == child {
+			return status, true
+		}
+
+		s.Logger.Info(
+			"reaped orphaned process",
+			"event", "supervisor.reap",
+			"pid", pid,
+		)
+	}
+}
+
+func (s *Supervisor) signal(cmd *exec.Cmd, sig os.Signal) {
+	s.Logger.Info(
+		"sending signal to wrapped application",
+		"event", "supervisor.signal",
+		"signal", sig.String(),
+	)
+
+	if err := cmd.Process.Signal(sig); err != nil {
+		s.Logger.Error(err, "failed to signal wrapped application", "signal", sig.String())
+	}
+}
+
+// refresh re-reads each secret file and template from Vault and atomically
+// rewrites those that have changed, returning whether any did.
+func (s *Supervisor) refresh() (bool, error) {
+	paths := map[string]bool{}
+	for _, file := range s.Files {
+		paths[file.Path] = true
+	}
+	for _, tmpl := range s.Templates {
+		refs, err := tmpl.References()
+		if err != nil {
+			return false, err
+		}
+		for _, ref := range refs {
+			paths[ref.Path] = true
+		}
+	}
+
+	secrets, err := s.Reader.ReadAll(sortedKeys(paths))
+	if err != nil {
+		return false, err
+	}
+
+	anyChanged := false
+	for key, file := range s.Files {
+		value, err := secrets[file.Path].Get(file.Reference)
+		if err != nil {
+			return anyChanged, errors.Wrap(err, fmt.Sprintf("failed to resolve %s", key))
+		}
+
+		changed, err := WriteFileAtomic(file.FilesystemPath, []byte(value), 0600)
+		if err != nil {
+			return anyChanged, err
+		}
+
+		if changed {
+			s.Logger.Info(
+				"updated vault secret file",
+				"event", "secret_file.update",
+				"path", file.FilesystemPath,
+			)
+			anyChanged = true
+		}
+	}
+
+	for _, tmpl := range s.Templates {
+		changed, err := tmpl.Write(secrets)
+		if err != nil {
+			return anyChanged, err
+		}
+
+		if changed {
+			s.Logger.Info(
+				"updated vault secret template",
+				"event", "secret_template.update",
+				"path", tmpl.Path,
+			)
+			anyChanged = true
+		}
+	}
+
+	return anyChanged, nil
+}
+
+// renewals returns the renewable leases held by the supervisor, each due for
+// renewal half way through its duration.
+func (s *Supervisor) renewals() []*renewal {
+	now := time.Now()
+	renewals := []*renewal{}
+
+	if s.Token != nil && s.Token.Renewable {
+		renewals = append(renewals, &renewal{
+			name:  "token",
+			lease: s.Token,
+			renew: s.Reader.RenewToken,
+			due:   now.Add(s.Token.Duration / 2),
+		})
+	}
+
+	for _, lease := range s.Leases {
+		if !lease.Renewable || lease.ID == "" {
+			continue
+		}
+
+		lease := lease
+		renewals = append(renewals, &renewal{
+			name:  lease.ID,
+			lease: lease,
+			renew: func() (*Lease, error) { return s.Reader.RenewLease(lease.ID) },
+			due:   now.Add(lease.Duration / 2),
+		})
+	}
+
+	return renewals
+}
+
+// renew renews each lease that is due, returning those that remain renewable.
+func (s *Supervisor) renew(renewals []*renewal) []*renewal {
+	now := time.Now()
+	remaining := []*renewal{}
+
+	for _, r := range renewals {
+		if now.Before(r.due) {
+			remaining = append(remaining, r)
+			continue
+		}
+
+		lease, err := r.renew()
+		if err != nil {
+			s.Logger.Error(err, "failed to renew vault lease", "event", "vault_lease.renew_failed", "lease", r.name)
+			r.due = now.Add(renewalRetryInterval)
+			remaining = append(remaining, r)
+			continue
+		}
+
+		*r.lease = *lease
+		s.Logger.Info(
+			"renewed vault lease",
+			"event", "vault_lease.renew",
+			"lease", r.name,
+			"lease_duration", lease.Duration.Seconds(),
+		)
+
+		// Leases stop being renewable once they reach their maximum TTL, after which
+		// the wrapped process must be restarted to obtain new credentials.
+		if !lease.Renewable || lease.Duration == 0 {
+			s.Logger.Info(
+				"vault lease can no longer be renewed",
+				"event", "vault_lease.expiring",
+				"lease", r.name,
+			)
+			continue
+		}
+
+		r.due = now.Add(lease.Duration / 2)
+		remaining = append(remaining, r)
+	}
+
+	return remaining
+}
+
+// scheduleRenewal resets the timer to fire when the next lease is due,
+// returning a nil channel if there are no leases to renew.
+func (s *Supervisor) scheduleRenewal(timer *time.Timer, renewals []*renewal) <-chan time.Time {
+	if len(renewals) == 0 {
+		return nil
+	}
+
+	sort.Slice(renewals, func(i, j int) bool {
+		return renewals[i].due.Before(renewals[j].due)
+	})
+
+	timer.Stop()
+	select {
+	case <-timer.C:
+	default:
+	}
+	timer.Reset(time.Until(renewals[0].due))
+
+	return timer.C
+}
+
+// exitError converts the result of waiting on the child into an ExitError,
+// following the shell convention of 128+n for children killed by signal n.
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return errors.Wrap(err, "failed to wait for wrapped program")
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		return exitStatusError(status)
+	}
+
+	return &ExitError{ExitCode: exitErr.ExitCode()}
+}
+
+// exitStatusError converts the wait status of the child into an ExitError, or
+// nil if it exited successfully.
+func exitStatusError(status syscall.WaitStatus) error {
+	if status.Signaled() {
+		return &ExitError{ExitCode: 128 + int(status.Signal())}
+	}
+
+	if status.ExitStatus() != 0 {
+		return &ExitError{ExitCode: status.ExitStatus()}
+	}
+
+	return nil
+}
+
+// TokenLease looks up the lease of the token used by the reader
+func (r *Reader) TokenLease() (*Lease, error) {
+	resp, err := r.request("vault_token_lookup.finished", "auth/token/lookup-self", func() (*api.Secret, error) {
+		return r.Client.Auth().Token().LookupSelf()
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up vault token")
+	}
+
+	if resp == nil || resp.Data == nil {
+		return nil, &MalformedSecretError{Path: "auth/token/lookup-self"}
+	}
+
+	lease := &Lease{}
+	if ttl, ok := resp.Data["ttl"].(json.Number); ok {
+		seconds, _ := ttl.Int64()
+		lease.Duration = time.Duration(seconds) * time.Second
+	}
+	lease.Renewable, _ = resp.Data["renewable"].(bool)
+
+	return lease, nil
+}
+
+// RenewToken renews the token used by the reader
+func (r *Reader) RenewToken() (*Lease, error) {
+	resp, err := r.request("vault_token_renew.finished", "auth/token/renew-self", func() (*api.Secret, error) {
+		return r.Client.Auth().Token().RenewSelf(0)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew vault token")
+	}
+
+	if resp == nil || resp.Auth == nil {
+		return nil, &MalformedSecretError{Path: "auth/token/renew-self"}
+	}
+
+	return &Lease{
+		Duration:  time.Duration(resp.Auth.LeaseDuration) * time.Second,
+		Renewable: resp.Auth.Renewable,
+	}, nil
+}
+
+// RenewLease renews the lease of a dynamic secret
+func (r *Reader) RenewLease(id string) (*Lease, error) {
+	resp, err := r.request("vault_lease_renew.finished", "sys/leases/renew", func() (*api.Secret, error) {
+		return r.Client.Sys().Renew(id, 0)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew vault lease")
+	}
+
+	if resp == nil {
+		return nil, &MalformedSecretError{Path: "sys/leases/renew"}
+	}
+
+	return leaseFromSecret(resp), nil
+}
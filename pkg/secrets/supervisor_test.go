@@ -0,0 +1,317 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseSignal", func() {
+	It("parses signals with and without the SIG prefix", func() {
+		Expect(ParseSignal("SIGHUP")).To(Equal(syscall.SIGHUP))
+		Expect(ParseSignal("usr1")).To(Equal(syscall.SIGUSR1))
+	})
+
+	It("rejects unknown signals", func() {
+		_, err := ParseSignal("SIGNOPE")
+		Expect(err).To(MatchError(ContainSubstring("unrecognised signal")))
+	})
+})
+
+var _ = Describe("WriteFileAtomic", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(tempDir, "nested", "secret")
+	})
+
+	It("writes the file and reports whether it changed", func() {
+		Expect(WriteFileAtomic(path, []byte("one"), 0600)).To(BeTrue())
+		Expect(WriteFileAtomic(path, []byte("one"), 0600)).To(BeFalse())
+		Expect(WriteFileAtomic(path, []byte("two"), 0600)).To(BeTrue())
+
+		Expect(os.ReadFile(path)).To(Equal([]byte("two")))
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1), "temporary files should be cleaned up")
+	})
+})
+
+var _ = Describe("Supervisor", func() {
+	var (
+		server     *httptest.Server
+		supervisor *Supervisor
+		dir        string
+
+		mu       sync.Mutex
+		value    string
+		renewals map[string]int
+	)
+
+	BeforeEach(func() {
+		dir = tempDir
+		value = "one"
+		renewals = map[string]int{}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			renewals[r.URL.Path]++
+			switch r.URL.Path {
+			case "/v1/secret/data/app":
+				fmt.Fprintf(w, `{"data":{"data":{"data":%q}}}`, value)
+			case "/v1/sys/leases/renew":
+				fmt.Fprint(w, `{"lease_id":"database/creds/app/abc123","lease_duration":3600,"renewable":true}`)
+			case "/v1/auth/token/renew-self":
+				fmt.Fprint(w, `{"auth":{"client_token":"token","lease_duration":3600,"renewable":true}}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+			}
+		}))
+
+		cfg := api.DefaultConfig()
+		cfg.Address = server.URL
+		client, err := api.NewClient(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		supervisor = &Supervisor{
+			Reader: &Reader{Client: client, PathPrefix: "secret/data", Logger: logr.Discard()},
+			Files: map[string]FileReference{
+				"APP_SECRET": {
+					Reference:      Reference{Path: "app", Field: DefaultField},
+					FilesystemPath: filepath.Join(dir, "secret"),
+				},
+			},
+			Logger: logr.Discard(),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("refresh", func() {
+		It("rewrites files only when their secret changes", func() {
+			Expect(supervisor.refresh()).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(dir, "secret"))).To(Equal([]byte("one")))
+
+			Expect(supervisor.refresh()).To(BeFalse())
+
+			mu.Lock()
+			value = "two"
+			mu.Unlock()
+
+			Expect(supervisor.refresh()).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(dir, "secret"))).To(Equal([]byte("two")))
+		})
+
+		It("re-renders templates", func() {
+			supervisor.Files = nil
+			supervisor.Templates = []FileTemplate{{
+				Path:     filepath.Join(dir, "config"),
+				Template: `secret: {{ secret "app" }}`,
+			}}
+
+			Expect(supervisor.refresh()).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(dir, "config"))).To(Equal([]byte("secret: one")))
+
+			mu.Lock()
+			value = "two"
+			mu.Unlock()
+
+			Expect(supervisor.refresh()).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(dir, "config"))).To(Equal([]byte("secret: two")))
+		})
+	})
+
+	Describe("renew", func() {
+		var lease *Lease
+
+		BeforeEach(func() {
+			lease = &Lease{ID: "database/creds/app/abc123", Duration: time.Minute, Renewable: true}
+			supervisor.Leases = []*Lease{lease, {ID: "static", Duration: time.Minute}}
+			supervisor.Token = &Lease{Duration: time.Minute, Renewable: true}
+		})
+
+		It("renews the token and renewable leases once they are due", func() {
+			renewable := supervisor.renewals()
+			Expect(renewable).To(HaveLen(2))
+
+			renewable = supervisor.renew(renewable)
+			Expect(renewals).NotTo(HaveKey("/v1/sys/leases/renew"), "leases should not be renewed early")
+
+			for _, r := range renewable {
+				r.due = time.Now()
+			}
+			renewable = supervisor.renew(renewable)
+
+			Expect(renewals).To(HaveKeyWithValue("/v1/sys/leases/renew", 1))
+			Expect(renewals).To(HaveKeyWithValue("/v1/auth/token/renew-self", 1))
+			Expect(lease.Duration).To(Equal(time.Hour))
+			Expect(renewable).To(HaveLen(2))
+			for _, r := range renewable {
+				Expect(r.due).To(BeTemporally("~", time.Now().Add(30*time.Minute), time.Minute))
+			}
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			ctx    context.Context
+			cancel func()
+			cmd    *exec.Cmd
+			err    error
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		JustBeforeEach(func() {
+			err = supervisor.Run(ctx, cmd)
+		})
+
+		Context("when the command exits unsuccessfully", func() {
+			BeforeEach(func() {
+				cmd = exec.Command("sh", "-c", "exit 3")
+			})
+
+			It("returns its exit code", func() {
+				Expect(err).To(Equal(&ExitError{ExitCode: 3}))
+			})
+		})
+
+		Context("when a secret file changes", func() {
+			BeforeEach(func() {
+				supervisor.RefreshInterval = 50 * time.Millisecond
+				supervisor.ReloadSignal = syscall.SIGHUP
+				Expect(supervisor.refresh()).To(BeTrue())
+
+				mu.Lock()
+				value = "two"
+				mu.Unlock()
+
+				// Exit successfully once reloaded, with the new contents of the file
+				marker := filepath.Join(dir, "reloaded")
+				cmd = exec.Command("sh", "-c", fmt.Sprintf(
+					`trap 'cp %s %s; exit 0' HUP; while true; do sleep 0.01; done`,
+					filepath.Join(dir, "secret"), marker,
+				))
+			})
+
+			It("sends the reload signal to the command", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.ReadFile(filepath.Join(dir, "reloaded"))).To(Equal([]byte("two")))
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			BeforeEach(func() {
+				cmd = exec.Command("sh", "-c", "while true; do sleep 0.01; done")
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					cancel()
+				}()
+			})
+
+			It("terminates the command", func() {
+				Expect(err).To(Equal(&ExitError{ExitCode: 128 + int(syscall.SIGTERM)}))
+			})
+		})
+
+		Context("when reaping children", func() {
+			BeforeEach(func() {
+				supervisor.ReapChildren = true
+				cmd = exec.Command("sh", "-c", "sleep 0.05; exit 3")
+			})
+
+			It("returns the exit code of the command", func() {
+				Expect(err).To(Equal(&ExitError{ExitCode: 3}))
+			})
+
+			Context("and the command succeeds", func() {
+				BeforeEach(func() {
+					cmd = exec.Command("sh", "-c", "exit 0")
+				})
+
+				It("returns no error", func() {
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+		})
+	})
+
+	Describe("reap", func() {
+		var reaped chan interface{}
+
+		BeforeEach(func() {
+			reaped = make(chan interface{}, 10)
+			supervisor.Logger = logr.New(&reapSink{reaped: reaped})
+		})
+
+		It("reaps exited processes other than the child, without reaping the child", func() {
+			orphan, err := os.StartProcess("/bin/sh", []string{"sh", "-c", "exit 0"}, &os.ProcAttr{})
+			Expect(err).NotTo(HaveOccurred())
+			child, err := os.StartProcess("/bin/sh", []string{"sh", "-c", "sleep 0.2; exit 4"}, &os.ProcAttr{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() bool {
+				_, ok := supervisor.reap(child.Pid)
+				Expect(ok).To(BeFalse(), "the child should still be running")
+				return len(reaped) > 0
+			}).Should(BeTrue())
+			Expect(<-reaped).To(Equal(orphan.Pid))
+
+			var (
+				status syscall.WaitStatus
+				ok     bool
+			)
+			Eventually(func() bool {
+				status, ok = supervisor.reap(child.Pid)
+				return ok
+			}, 2*time.Second).Should(BeTrue())
+			Expect(status.ExitStatus()).To(Equal(4))
+		})
+	})
+})
+
+// reapSink records the pid of each process logged as reaped
+type reapSink struct {
+	reaped chan interface{}
+}
+
+func (s *reapSink) Init(info logr.RuntimeInfo)                      {}
+func (s *reapSink) Enabled(level int) bool                          { return true }
+func (s *reapSink) Error(err error, msg string, kvs ...interface{}) {}
+func (s *reapSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == "pid" {
+			s.reaped <- keysAndValues[i+1]
+		}
+	}
+}
+
+func (s *reapSink) WithValues(keysAndValues ...interface{}) logr.LogSink { return s }
+func (s *reapSink) WithName(name string) logr.LogSink                    { return s }
@@ -0,0 +1,246 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFileMode is the mode of rendered files that don't specify one
+const DefaultFileMode os.FileMode = 0600
+
+// FileTemplate is a file rendered from a Go template that can reference Vault
+// secrets, for applications that need several secrets combined into a single
+// configuration file. Secrets are referenced with the secret function, which
+// takes a reference in the same form as a vault: environment variable:
+//
+//	password: {{ secret "db/creds#password" }}
+type FileTemplate struct {
+	Path     string `yaml:"path"`
+	Template string `yaml:"template"`
+	// Mode is the octal permissions of the file, e.g. "0640"
+	Mode string `yaml:"mode"`
+	// Owner and Group are the numeric IDs to change the ownership of the file
+	// to, if set
+	Owner *int `yaml:"owner"`
+	Group *int `yaml:"group"`
+}
+
+// Validate checks that the template can be rendered, returning the first
+// problem found
+func (f FileTemplate) Validate() error {
+	if errs := f.validate(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// validate returns every problem with the template
+func (f FileTemplate) validate() []error {
+	errs := []error{}
+	if f.Path == "" {
+		errs = append(errs, fmt.Errorf("file template is missing a path"))
+	}
+
+	if _, err := f.FileMode(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := f.References(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// FileMode parses the mode of the file, defaulting to DefaultFileMode
+func (f FileTemplate) FileMode() (os.FileMode, error) {
+	if f.Mode == "" {
+		return DefaultFileMode, nil
+	}
+
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q for file %s, expected octal permissions such as 0640", f.Mode, f.Path)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// References returns every secret referenced by the template, so that they can
+// be read from Vault before rendering. Only references given as string
+// literals are supported.
+func (f FileTemplate) References() ([]Reference, error) {
+	tmpl, err := f.parse(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []Reference{}
+	var walkErr error
+	visit := func(cmd *parse.CommandNode) {
+		if walkErr != nil || len(cmd.Args) == 0 {
+			return
+		}
+
+		ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+		if !ok || ident.Ident != "secret" {
+			return
+		}
+
+		if len(cmd.Args) != 2 {
+			walkErr = fmt.Errorf("template for file %s: secret takes a single reference", f.Path)
+			return
+		}
+
+		literal, ok := cmd.Args[1].(*parse.StringNode)
+		if !ok {
+			walkErr = fmt.Errorf("template for file %s: secret references must be string literals, not %s", f.Path, cmd.Args[1])
+			return
+		}
+
+		ref, err := ParseReference(literal.Text)
+		if err != nil {
+			walkErr = errors.Wrap(err, fmt.Sprintf("template for file %s", f.Path))
+			return
+		}
+
+		refs = append(refs, ref)
+	}
+
+	// Include any templates defined within the template
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkTemplate(t.Tree.Root, visit)
+		}
+	}
+
+	return refs, walkErr
+}
+
+// Render executes the template against secrets read from Vault, keyed by path
+func (f FileTemplate) Render(secrets map[string]Secret) ([]byte, error) {
+	tmpl, err := f.parse(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to render template for file %s", f.Path))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Write renders the template and atomically writes it to its path with the
+// configured mode and ownership, returning whether the contents changed.
+func (f FileTemplate) Write(secrets map[string]Secret) (bool, error) {
+	mode, err := f.FileMode()
+	if err != nil {
+		return false, err
+	}
+
+	contents, err := f.Render(secrets)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := WriteFileAtomic(f.Path, contents, mode)
+	if err != nil {
+		return false, err
+	}
+
+	// Apply the mode even if the contents are unchanged, in case the mode in the
+	// configuration has changed since the file was written
+	if err := os.Chmod(f.Path, mode); err != nil {
+		return changed, errors.Wrapf(err, "failed to set permissions of %s", f.Path)
+	}
+
+	if f.Owner != nil || f.Group != nil {
+		uid, gid := -1, -1
+		if f.Owner != nil {
+			uid = *f.Owner
+		}
+		if f.Group != nil {
+			gid = *f.Group
+		}
+
+		if err := os.Chown(f.Path, uid, gid); err != nil {
+			return changed, errors.Wrapf(err, "failed to change ownership of %s", f.Path)
+		}
+	}
+
+	return changed, nil
+}
+
+func (f FileTemplate) parse(secrets map[string]Secret) (*template.Template, error) {
+	tmpl, err := template.New(f.Path).Funcs(template.FuncMap{
+		"secret": func(value string) (string, error) {
+			ref, err := ParseReference(value)
+			if err != nil {
+				return "", err
+			}
+
+			secret, ok := secrets[ref.Path]
+			if !ok {
+				return "", fmt.Errorf("secret %s was not read from Vault", ref.Path)
+			}
+
+			return secret.Get(ref)
+		},
+	}).Parse(f.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse template for file %s", f.Path))
+	}
+
+	return tmpl, nil
+}
+
+// walkTemplate calls fn for every command in the template, including those
+// nested in pipelines and control structures.
+func walkTemplate(node parse.Node, fn func(*parse.CommandNode)) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			walkTemplate(child, fn)
+		}
+	case *parse.ActionNode:
+		walkTemplate(node.Pipe, fn)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			walkTemplate(cmd, fn)
+		}
+	case *parse.CommandNode:
+		fn(node)
+		for _, arg := range node.Args {
+			walkTemplate(arg, fn)
+		}
+	case *parse.IfNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkTemplate(node.Pipe, fn)
+	}
+}
+
+func walkBranch(node *parse.BranchNode, fn func(*parse.CommandNode)) {
+	walkTemplate(node.Pipe, fn)
+	walkTemplate(node.List, fn)
+	walkTemplate(node.ElseList, fn)
+}
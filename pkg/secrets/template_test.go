@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileTemplate", func() {
+	var (
+		tmpl    FileTemplate
+		secrets map[string]Secret
+	)
+
+	BeforeEach(func() {
+		tmpl = FileTemplate{
+			Path: filepath.Join(tempDir, "config", "database.yml"),
+			Template: `production:
+  username: {{ secret "db/creds#username" }}
+  password: {{ secret "db/creds#password" | printf "%q" }}
+{{- if true }}
+  api_key: {{ secret "api-key" }}
+{{- end }}
+`,
+		}
+		secrets = map[string]Secret{
+			"db/creds": {Path: "secret/data/db/creds", Data: map[string]interface{}{"username": "app", "password": "hunter2"}},
+			"api-key":  {Path: "secret/data/api-key", Data: map[string]interface{}{"data": "abc"}},
+		}
+	})
+
+	Describe("References", func() {
+		It("finds references in actions, pipelines and control structures", func() {
+			Expect(tmpl.References()).To(ConsistOf(
+				Reference{Path: "db/creds", Field: "username"},
+				Reference{Path: "db/creds", Field: "password"},
+				Reference{Path: "api-key", Field: DefaultField},
+			))
+		})
+
+		It("rejects references that aren't string literals", func() {
+			tmpl.Template = `{{ $path := "db/creds" }}{{ secret $path }}`
+			_, err := tmpl.References()
+			Expect(err).To(MatchError(ContainSubstring("must be string literals")))
+		})
+
+		It("rejects templates that don't parse", func() {
+			tmpl.Template = `{{ secret "db/creds" `
+			_, err := tmpl.References()
+			Expect(err).To(MatchError(ContainSubstring("failed to parse template")))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts a valid template", func() {
+			Expect(tmpl.Validate()).To(Succeed())
+		})
+
+		It("requires a path", func() {
+			tmpl.Path = ""
+			Expect(tmpl.Validate()).To(MatchError(ContainSubstring("missing a path")))
+		})
+
+		It("requires an octal mode", func() {
+			tmpl.Mode = "rw-r--r--"
+			Expect(tmpl.Validate()).To(MatchError(ContainSubstring("invalid mode")))
+		})
+	})
+
+	Describe("Write", func() {
+		It("renders the template with the default mode", func() {
+			Expect(tmpl.Write(secrets)).To(BeTrue())
+			Expect(os.ReadFile(tmpl.Path)).To(Equal([]byte(`production:
+  username: app
+  password: "hunter2"
+  api_key: abc
+`)))
+
+			info, err := os.Stat(tmpl.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(DefaultFileMode))
+		})
+
+		It("applies the configured mode and ownership", func() {
+			tmpl.Mode = "0640"
+			uid, gid := os.Getuid(), os.Getgid()
+			tmpl.Owner, tmpl.Group = &uid, &gid
+
+			Expect(tmpl.Write(secrets)).To(BeTrue())
+			info, err := os.Stat(tmpl.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		})
+
+		It("returns an error when a field is missing", func() {
+			tmpl.Template = `{{ secret "db/creds#host" }}`
+			_, err := tmpl.Write(secrets)
+			Expect(err).To(MatchError(ContainSubstring(`has no field "host"`)))
+		})
+
+		It("returns an error when a secret wasn't read", func() {
+			tmpl.Template = `{{ secret "other" }}`
+			_, err := tmpl.Write(secrets)
+			Expect(err).To(MatchError(ContainSubstring("secret other was not read from Vault")))
+		})
+	})
+})
@@ -0,0 +1,233 @@
+package secrets
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Problem is an issue found when validating references to Vault secrets.
+// Source identifies where the reference came from, such as the name of an
+// environment variable.
+type Problem struct {
+	Source string
+	Err    error
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Source, p.Err)
+}
+
+// Validate checks the syntax of every reference in the environment and every
+// file template, and that no two of them write to conflicting paths. Unlike
+// ParseEnvironment, it reports every problem rather than stopping at the first.
+// The valid references are returned, so they can be checked against Vault.
+func Validate(env map[string]string, templates []FileTemplate) (*EnvironmentReferences, []Problem) {
+	refs := newEnvironmentReferences()
+	problems := []Problem{}
+
+	for _, key := range sortedKeys(env) {
+		if err := refs.add(key, env[key]); err != nil {
+			problems = append(problems, Problem{Source: key, Err: err})
+		}
+	}
+
+	for idx, tmpl := range templates {
+		for _, err := range tmpl.validate() {
+			problems = append(problems, Problem{Source: templateSource(idx, tmpl), Err: err})
+		}
+	}
+
+	problems = append(problems, validateLeaseNames(env, refs)...)
+	problems = append(problems, validateFilePaths(refs, templates)...)
+
+	return refs, problems
+}
+
+// validateLeaseNames checks that the variables exposing leases won't overwrite
+// any that are already defined.
+func validateLeaseNames(env map[string]string, refs *EnvironmentReferences) []Problem {
+	problems := []Problem{}
+	keys := append(sortedKeys(refs.Dynamic), sortedKeys(refs.PKI)...)
+	for _, key := range keys {
+		for name := range LeaseEnvironment(key, &Lease{}) {
+			if _, ok := env[name]; ok {
+				problems = append(problems, Problem{
+					Source: key,
+					Err:    fmt.Errorf("lease would overwrite existing environment variable %s", name),
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// writtenFile is a file that will be written by theatre-secrets
+type writtenFile struct {
+	path   string
+	source string
+}
+
+// validateFilePaths checks that no two references write the same file, and that
+// no reference writes a file where another needs a directory.
+func validateFilePaths(refs *EnvironmentReferences, templates []FileTemplate) []Problem {
+	files := []writtenFile{}
+	for key, ref := range refs.Files {
+		// Files without a path are written to unique temporary files
+		if ref.FilesystemPath != "" {
+			files = append(files, writtenFile{path: ref.FilesystemPath, source: key})
+		}
+	}
+	for key, ref := range refs.PKI {
+		if ref.Directory != "" {
+			for _, name := range []string{CertificateFile, PrivateKeyFile, CAFile} {
+				files = append(files, writtenFile{path: filepath.Join(ref.Directory, name), source: key})
+			}
+		}
+	}
+	for idx, tmpl := range templates {
+		if tmpl.Path != "" {
+			files = append(files, writtenFile{path: tmpl.Path, source: templateSource(idx, tmpl)})
+		}
+	}
+
+	for idx := range files {
+		files[idx].path = filepath.Clean(files[idx].path)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].path == files[j].path {
+			return files[i].source < files[j].source
+		}
+		return files[i].path < files[j].path
+	})
+
+	problems := []Problem{}
+	for i, file := range files {
+		for _, other := range files[i+1:] {
+			switch {
+			case file.path == other.path:
+				problems = append(problems, Problem{
+					Source: other.source,
+					Err:    fmt.Errorf("file %s is also written by %s", other.path, file.source),
+				})
+			case strings.HasPrefix(other.path, file.path+string(filepath.Separator)):
+				problems = append(problems, Problem{
+					Source: other.source,
+					Err:    fmt.Errorf("file %s is inside %s, which is written as a file by %s", other.path, file.path, file.source),
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// ValidateVault checks that every referenced secret exists and is readable with
+// the token of the reader. KV secrets are read to check that referenced fields
+// exist, but dynamic secrets and certificates are only checked by the
+// capabilities of the token, as reading them would generate new credentials.
+func (r *Reader) ValidateVault(refs *EnvironmentReferences, templates []FileTemplate) []Problem {
+	problems := []Problem{}
+
+	// Gather every reference to a KV secret, by source
+	kvRefs := map[string][]Reference{}
+	for key, ref := range refs.Values {
+		kvRefs[key] = append(kvRefs[key], ref)
+	}
+	for key, ref := range refs.Files {
+		kvRefs[key] = append(kvRefs[key], ref.Reference)
+	}
+	for key, ref := range refs.Expanded {
+		kvRefs[key] = append(kvRefs[key], ref)
+	}
+	for idx, tmpl := range templates {
+		// Invalid templates have already been reported by Validate
+		tmplRefs, _ := tmpl.References()
+		source := templateSource(idx, tmpl)
+		kvRefs[source] = append(kvRefs[source], tmplRefs...)
+	}
+
+	secrets := map[string]Secret{}
+	failed := map[string]error{}
+	for _, source := range sortedKeys(kvRefs) {
+		for _, ref := range kvRefs[source] {
+			if err, ok := failed[ref.Path]; ok {
+				problems = append(problems, Problem{Source: source, Err: err})
+				continue
+			}
+
+			secret, ok := secrets[ref.Path]
+			if !ok {
+				var err error
+				if secret, err = r.Read(ref.Path); err != nil {
+					failed[ref.Path] = err
+					problems = append(problems, Problem{Source: source, Err: err})
+					continue
+				}
+				secrets[ref.Path] = secret
+			}
+
+			// Expanded references use every field, rather than the default field
+			if _, expanded := refs.Expanded[source]; expanded {
+				_, err := secret.Fields()
+				if err != nil {
+					problems = append(problems, Problem{Source: source, Err: err})
+				}
+				continue
+			}
+
+			if _, err := secret.Get(ref); err != nil {
+				problems = append(problems, Problem{Source: source, Err: err})
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(refs.Dynamic) {
+		if err := r.checkCapability(refs.Dynamic[key].Path, "read"); err != nil {
+			problems = append(problems, Problem{Source: key, Err: err})
+		}
+	}
+
+	for _, key := range sortedKeys(refs.PKI) {
+		if err := r.checkCapability(refs.PKI[key].Path, "update"); err != nil {
+			problems = append(problems, Problem{Source: key, Err: err})
+		}
+	}
+
+	return problems
+}
+
+// checkCapability checks that the token of the reader has the capability on
+// the path
+func (r *Reader) checkCapability(path, capability string) error {
+	var capabilities []string
+	_, err := r.request("vault_capabilities_request.finished", path, func() (*api.Secret, error) {
+		var err error
+		capabilities, err = r.Client.Sys().CapabilitiesSelf(path)
+		return nil, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to check capabilities of vault token")
+	}
+
+	for _, granted := range capabilities {
+		if granted == capability || granted == "root" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("vault token does not have %s capability on %s", capability, path)
+}
+
+func templateSource(idx int, tmpl FileTemplate) string {
+	if tmpl.Path == "" {
+		return fmt.Sprintf("files[%d]", idx)
+	}
+
+	return fmt.Sprintf("files[%d] (%s)", idx, tmpl.Path)
+}
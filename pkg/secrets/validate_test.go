@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// problemStrings formats problems to make them easier to match
+func problemStrings(problems []Problem) []string {
+	strs := []string{}
+	for _, problem := range problems {
+		strs = append(strs, problem.String())
+	}
+
+	return strs
+}
+
+var _ = Describe("Validate", func() {
+	var (
+		env       map[string]string
+		templates []FileTemplate
+		refs      *EnvironmentReferences
+		problems  []Problem
+	)
+
+	BeforeEach(func() {
+		env = map[string]string{
+			"HOME":        "/home/user",
+			"DB_PASSWORD": "vault:db/creds#password",
+			"TLS":         "vault-pki:pki/issue/web?common_name=web#/etc/tls",
+		}
+		templates = []FileTemplate{
+			{Path: "/app/config/database.yml", Template: `{{ secret "db/creds#password" }}`},
+		}
+	})
+
+	JustBeforeEach(func() {
+		refs, problems = Validate(env, templates)
+	})
+
+	It("returns no problems for valid references", func() {
+		Expect(problems).To(BeEmpty())
+		Expect(refs.Values).To(HaveKey("DB_PASSWORD"))
+		Expect(refs.PKI).To(HaveKey("TLS"))
+	})
+
+	Context("with several problems", func() {
+		BeforeEach(func() {
+			env["API_KEY"] = "vault:#field"
+			env["PG_USER"] = "vault-dynamic:database/creds/app"
+			env["TLS_LEASE_ID"] = "set"
+			env["SSH_KEY"] = "vault-file:ssh-key:/etc/tls/tls.key"
+			env["CONFIG"] = "vault-file:config:/app/config"
+			templates = append(templates, FileTemplate{Mode: "rwx", Template: `{{ secret }}`})
+		})
+
+		It("reports all of them", func() {
+			Expect(problemStrings(problems)).To(ConsistOf(
+				`API_KEY: missing secret path in reference: "#field"`,
+				"PG_USER: vault-dynamic: references must select a field",
+				"TLS: lease would overwrite existing environment variable TLS_LEASE_ID",
+				"TLS: file /etc/tls/tls.key is also written by SSH_KEY",
+				"files[0] (/app/config/database.yml): file /app/config/database.yml is inside /app/config, which is written as a file by CONFIG",
+				"files[1]: file template is missing a path",
+				ContainSubstring("files[1]: invalid mode"),
+				"files[1]: template for file : secret takes a single reference",
+			))
+		})
+
+		It("returns the references that are valid", func() {
+			Expect(refs.Values).To(HaveKey("DB_PASSWORD"))
+			Expect(refs.Values).NotTo(HaveKey("API_KEY"))
+		})
+	})
+})
+
+var _ = Describe("ValidateVault", func() {
+	var (
+		server       *httptest.Server
+		reader       *Reader
+		capabilities map[string][]string
+		refs         *EnvironmentReferences
+		templates    []FileTemplate
+		problems     []Problem
+	)
+
+	BeforeEach(func() {
+		capabilities = map[string][]string{
+			"database/creds/app": {"read"},
+			"pki/issue/web":      {"read"},
+		}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/secret/data/db/creds":
+				fmt.Fprint(w, `{"data":{"data":{"username":"app","password":"hunter2"}}}`)
+			case "/v1/secret/data/nested":
+				fmt.Fprint(w, `{"data":{"data":{"hosts":["a","b"]}}}`)
+			case "/v1/sys/capabilities-self":
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": map[string]interface{}{"capabilities": capabilities[body["path"]]},
+				})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+			}
+		}))
+
+		cfg := api.DefaultConfig()
+		cfg.Address = server.URL
+		client, err := api.NewClient(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		client.SetToken("token")
+
+		reader = &Reader{Client: client, PathPrefix: "secret/data", Logger: logr.Discard()}
+
+		var validationProblems []Problem
+		refs, validationProblems = Validate(map[string]string{
+			"DB_PASSWORD": "vault:db/creds#password",
+			"DB_HOST":     "vault:db/creds#host",
+			"MISSING":     "vault-file:missing",
+			"DATABASE":    "vault-expand:nested",
+			"PG_USER":     "vault-dynamic:database/creds/app#username",
+			"TLS":         "vault-pki:pki/issue/web?common_name=web",
+		}, nil)
+		Expect(validationProblems).To(BeEmpty())
+
+		templates = []FileTemplate{
+			{Path: "/app/config/database.yml", Template: `{{ secret "db/creds#port" }}`},
+		}
+	})
+
+	JustBeforeEach(func() {
+		problems = reader.ValidateVault(refs, templates)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reports every reference that can't be resolved", func() {
+		Expect(problemStrings(problems)).To(ConsistOf(
+			`DB_HOST: secret at Vault KV path secret/data/db/creds has no field "host", available fields are: password, username`,
+			"MISSING: no secret data found at Vault KV path: secret/data/missing",
+			ContainSubstring(`DATABASE: field "hosts" of secret at Vault KV path secret/data/nested has unsupported type`),
+			`files[0] (/app/config/database.yml): secret at Vault KV path secret/data/db/creds has no field "port", available fields are: password, username`,
+			"TLS: vault token does not have update capability on pki/issue/web",
+		))
+	})
+})
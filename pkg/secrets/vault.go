@@ -0,0 +1,193 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// SecretNotFoundError is returned when there is no secret at a Vault path
+type SecretNotFoundError struct {
+	Path string
+}
+
+func (e *SecretNotFoundError) Error() string {
+	return fmt.Sprintf("no secret data found at Vault KV path: %s", e.Path)
+}
+
+// MalformedSecretError is returned when the data at a Vault path is not in the
+// format of a KV version 2 secret
+type MalformedSecretError struct {
+	Path string
+}
+
+func (e *MalformedSecretError) Error() string {
+	return fmt.Sprintf("secret at Vault KV path %s has no data map", e.Path)
+}
+
+// FieldNotFoundError is returned when a secret has no field with the
+// referenced name
+type FieldNotFoundError struct {
+	Path      string
+	Field     string
+	Available []string
+}
+
+func (e *FieldNotFoundError) Error() string {
+	return fmt.Sprintf(
+		"secret at Vault KV path %s has no field %q, available fields are: %s",
+		e.Path, e.Field, strings.Join(e.Available, ", "),
+	)
+}
+
+// FieldTypeError is returned when a field of a secret is not a string, number
+// or boolean, and so can't be used as the value of an environment variable
+type FieldTypeError struct {
+	Path  string
+	Field string
+	Value interface{}
+}
+
+func (e *FieldTypeError) Error() string {
+	return fmt.Sprintf(
+		"field %q of secret at Vault KV path %s has unsupported type %T",
+		e.Field, e.Path, e.Value,
+	)
+}
+
+// Secret holds the fields of a secret read from a Vault path. Lease is only set
+// for secrets from dynamic secrets engines.
+type Secret struct {
+	Path  string
+	Data  map[string]interface{}
+	Lease *Lease
+}
+
+// Field returns the value of a field of the secret as a string
+func (s Secret) Field(field string) (string, error) {
+	value, ok := s.Data[field]
+	if !ok {
+		return "", &FieldNotFoundError{Path: s.Path, Field: field, Available: s.fieldNames()}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number, bool, float64, int:
+		return fmt.Sprint(value), nil
+	default:
+		return "", &FieldTypeError{Path: s.Path, Field: field, Value: value}
+	}
+}
+
+// Fields returns the values of every field of the secret as strings
+func (s Secret) Fields() (map[string]string, error) {
+	fields := make(map[string]string, len(s.Data))
+	for field := range s.Data {
+		value, err := s.Field(field)
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = value
+	}
+
+	return fields, nil
+}
+
+// Get returns the value of the referenced field of the secret
+func (s Secret) Get(ref Reference) (string, error) {
+	return s.Field(ref.Field)
+}
+
+func (s Secret) fieldNames() []string {
+	names := make([]string, 0, len(s.Data))
+	for name := range s.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Reader reads secrets from the KV version 2 engine in Vault
+type Reader struct {
+	Client     *api.Client
+	PathPrefix string
+	Logger     logr.Logger
+}
+
+// Read returns the secret stored at the given path, relative to the path
+// prefix of the reader
+func (r *Reader) Read(path string) (Secret, error) {
+	fullPath := pathpkg.Join(r.PathPrefix, path)
+	resp, err := r.request("vault_kv_request.finished", fullPath, func() (*api.Secret, error) {
+		return r.Client.Logical().Read(fullPath)
+	})
+	if err != nil {
+		return Secret{}, errors.Wrap(err, "failed to retrieve secret value from Vault")
+	}
+
+	if resp == nil {
+		return Secret{}, &SecretNotFoundError{Path: fullPath}
+	}
+
+	data, ok := resp.Data["data"].(map[string]interface{})
+	if !ok {
+		return Secret{}, &MalformedSecretError{Path: fullPath}
+	}
+
+	return Secret{Path: fullPath, Data: data}, nil
+}
+
+// ReadAll reads the secret at each of the given paths, returning them keyed by
+// path. Paths that are given more than once are only read once.
+func (r *Reader) ReadAll(paths []string) (map[string]Secret, error) {
+	secrets := make(map[string]Secret, len(paths))
+	for _, path := range paths {
+		if _, ok := secrets[path]; ok {
+			continue
+		}
+
+		secret, err := r.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		secrets[path] = secret
+	}
+
+	return secrets, nil
+}
+
+// request performs a request against Vault, logging its outcome with the given
+// event.
+func (r *Reader) request(event, path string, do func() (*api.Secret, error)) (*api.Secret, error) {
+	start := time.Now()
+	resp, err := do()
+
+	// Use verbosity 1, which is equal to debug level
+	r.Logger.V(1).Info(
+		"vault request finished",
+		"event", event,
+		"path", path,
+		"duration", time.Since(start).Seconds(),
+		"outcome", outcome(err),
+	)
+
+	return resp, err
+}
+
+// Helper for setting the `outcome` field in a log entry.
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
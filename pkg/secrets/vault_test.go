@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/vault/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newFakeVault returns a server that responds to KV version 2 reads with the
+// given responses, keyed by path. Paths without a response return a 404, as
+// Vault does for missing secrets.
+func newFakeVault(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[strings.TrimPrefix(r.URL.Path, "/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+}
+
+var _ = Describe("Reader", func() {
+	var (
+		server    *httptest.Server
+		responses map[string]string
+		reader    *Reader
+	)
+
+	BeforeEach(func() {
+		responses = map[string]string{
+			"secret/data/db/creds": `{"data":{"data":{"username":"app","password":"hunter2","port":5432,"tls":true}}}`,
+			"secret/data/legacy":   `{"data":{"data":{"data":"s3cr3t"}}}`,
+			"secret/data/nested":   `{"data":{"data":{"hosts":["a","b"]}}}`,
+			"secret/data/kv-v1":    `{"data":{"value":"s3cr3t"}}`,
+		}
+	})
+
+	JustBeforeEach(func() {
+		server = newFakeVault(responses)
+
+		cfg := api.DefaultConfig()
+		cfg.Address = server.URL
+		client, err := api.NewClient(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		client.SetToken("token")
+
+		reader = &Reader{Client: client, PathPrefix: "secret/data", Logger: logr.Discard()}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads the default field of a secret", func() {
+		secret, err := reader.Read("legacy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Get(Reference{Path: "legacy", Field: DefaultField})).To(Equal("s3cr3t"))
+	})
+
+	It("selects fields of a secret, formatting scalars as strings", func() {
+		secret, err := reader.Read("db/creds")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Field("password")).To(Equal("hunter2"))
+		Expect(secret.Field("port")).To(Equal("5432"))
+		Expect(secret.Field("tls")).To(Equal("true"))
+	})
+
+	It("returns every field of a secret", func() {
+		secret, err := reader.Read("db/creds")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Fields()).To(Equal(map[string]string{
+			"username": "app", "password": "hunter2", "port": "5432", "tls": "true",
+		}))
+	})
+
+	It("returns a FieldNotFoundError listing the available fields", func() {
+		secret, err := reader.Read("db/creds")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = secret.Field("data")
+		Expect(err).To(Equal(&FieldNotFoundError{
+			Path:      "secret/data/db/creds",
+			Field:     "data",
+			Available: []string{"password", "port", "tls", "username"},
+		}))
+	})
+
+	It("returns a FieldTypeError for fields that aren't scalars", func() {
+		secret, err := reader.Read("nested")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = secret.Field("hosts")
+		Expect(err).To(BeAssignableToTypeOf(&FieldTypeError{}))
+
+		_, err = secret.Fields()
+		Expect(err).To(BeAssignableToTypeOf(&FieldTypeError{}))
+	})
+
+	It("returns a SecretNotFoundError for missing secrets", func() {
+		_, err := reader.Read("missing")
+		Expect(err).To(Equal(&SecretNotFoundError{Path: "secret/data/missing"}))
+	})
+
+	It("returns a MalformedSecretError for secrets without a data map", func() {
+		_, err := reader.Read("kv-v1")
+		Expect(err).To(Equal(&MalformedSecretError{Path: "secret/data/kv-v1"}))
+	})
+
+	It("reads each path in ReadAll", func() {
+		secrets, err := reader.ReadAll([]string{"db/creds", "legacy"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secrets).To(HaveLen(2))
+		Expect(secrets["legacy"].Path).To(Equal("secret/data/legacy"))
+	})
+
+	Context("when Vault returns an error", func() {
+		BeforeEach(func() {
+			responses = nil
+		})
+
+		JustBeforeEach(func() {
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			})
+		})
+
+		It("wraps the error", func() {
+			_, err := reader.Read("db/creds")
+			Expect(err).To(MatchError(ContainSubstring("failed to retrieve secret value from Vault")))
+			Expect(err).To(MatchError(ContainSubstring("permission denied")))
+		})
+	})
+})
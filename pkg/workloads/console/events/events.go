@@ -16,6 +16,7 @@ type EventKind string
 const (
 	EventRequest    EventKind = "Request"
 	EventAuthorise  EventKind = "Authorise"
+	EventReject     EventKind = "Reject"
 	EventStart      EventKind = "Start"
 	EventAttach     EventKind = "Attach"
 	EventTerminated EventKind = "Terminate"
@@ -63,6 +64,16 @@ type ConsoleAuthoriseEvent struct {
 	Spec        ConsoleAuthoriseSpec `json:"spec"`
 }
 
+type ConsoleRejectSpec struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+type ConsoleRejectEvent struct {
+	CommonEvent `json:",inline"`
+	Spec        ConsoleRejectSpec `json:"spec"`
+}
+
 type ConsoleStartSpec struct {
 	Job string `json:"job"`
 }
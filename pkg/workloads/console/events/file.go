@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrorFileFailedPublish provides context on the reasons that we failed to
+// write our message
+type ErrorFileFailedPublish struct {
+	err  error
+	Path string
+}
+
+func (e ErrorFileFailedPublish) Unwrap() error { return e.err }
+func (e ErrorFileFailedPublish) Error() string {
+	return fmt.Sprintf(
+		"failed to write message to '%s': %s",
+		e.Path,
+		e.err,
+	)
+}
+
+// Test we implement the error interface
+var _ error = &ErrorFileFailedPublish{}
+
+// FilePublisher implements the publisher.Publisher interface, writing each
+// message as a single line of JSON. This can be used to write events to stdout
+// for collection by a log shipper, or to a file tailed by another process.
+type FilePublisher struct {
+	mu     sync.Mutex
+	path   string
+	writer io.Writer
+	closer io.Closer
+}
+
+// Test we implement the Publisher interface
+var _ Publisher = &FilePublisher{}
+
+// NewFilePublisher creates a publisher that appends to the file at path,
+// creating it if necessary. A path of "-" writes to stdout.
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "-" {
+		return NewWriterPublisher(os.Stdout), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, ErrorFileFailedPublish{err: err, Path: path}
+	}
+
+	return &FilePublisher{
+		path:   path,
+		writer: file,
+		closer: file,
+	}, nil
+}
+
+// NewWriterPublisher creates a publisher that writes to the given writer.
+func NewWriterPublisher(writer io.Writer) *FilePublisher {
+	return &FilePublisher{
+		path:   "-",
+		writer: writer,
+	}
+}
+
+func (p *FilePublisher) Stop() {
+	if p.closer != nil {
+		p.closer.Close()
+	}
+}
+
+func (p *FilePublisher) Publish(_ context.Context, msg interface{}) (string, error) {
+	messageBytes, err := json.Marshal(msg)
+	if err != nil {
+		return "", ErrorFileFailedPublish{err: err, Path: p.path}
+	}
+
+	// Lines must not be interleaved when publishing concurrently
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.writer.Write(append(messageBytes, '\n')); err != nil {
+		return "", ErrorFileFailedPublish{err: err, Path: p.path}
+	}
+
+	return uuid.New().String(), nil
+}
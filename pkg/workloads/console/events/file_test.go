@@ -0,0 +1,59 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FilePublisher", func() {
+	event := func(username string) *ConsoleRequestEvent {
+		return &ConsoleRequestEvent{
+			CommonEvent: CommonEvent{Kind: KindConsole, Event: EventRequest},
+			Spec:        ConsoleRequestSpec{Username: username},
+		}
+	}
+
+	It("writes each event as a line of JSON", func() {
+		buf := &bytes.Buffer{}
+		publisher := NewWriterPublisher(buf)
+
+		_, err := publisher.Publish(context.TODO(), event("alice@example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = publisher.Publish(context.TODO(), event("bob@example.com"))
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+
+		var received ConsoleRequestEvent
+		Expect(json.Unmarshal([]byte(lines[1]), &received)).To(Succeed())
+		Expect(received.Spec.Username).To(Equal("bob@example.com"))
+	})
+
+	It("appends to an existing file", func() {
+		dir, err := os.MkdirTemp("", "events")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "events.jsonl")
+		Expect(os.WriteFile(path, []byte("{}\n"), 0o644)).To(Succeed())
+
+		publisher, err := NewFilePublisher(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = publisher.Publish(context.TODO(), event("alice@example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		publisher.Stop()
+
+		contents, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Split(strings.TrimSpace(string(contents)), "\n")).To(HaveLen(2))
+	})
+})
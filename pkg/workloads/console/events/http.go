@@ -0,0 +1,183 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SignatureHeader is the header containing the HMAC-SHA256 signature of the
+	// request body, hex encoded and prefixed with the algorithm, e.g.
+	// "sha256=5d41...".
+	SignatureHeader = "X-Theatre-Signature"
+
+	// CloudEventsSpecVersion is the version of the CloudEvents specification
+	// that events are published with.
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsTypePrefix is prepended to the kind of each event to form the
+	// CloudEvents type, e.g. "com.gocardless.theatre.console.request".
+	CloudEventsTypePrefix = "com.gocardless.theatre"
+)
+
+// ErrorHTTPFailedPublish provides context on the reasons that we failed to
+// publish our message to an HTTP endpoint
+type ErrorHTTPFailedPublish struct {
+	err      error
+	Endpoint string
+	Attempts int
+}
+
+func (e ErrorHTTPFailedPublish) Unwrap() error { return e.err }
+func (e ErrorHTTPFailedPublish) Error() string {
+	return fmt.Sprintf(
+		"failed to publish message to endpoint '%s' after %d attempt(s): %s",
+		e.Endpoint,
+		e.Attempts,
+		e.err,
+	)
+}
+
+// Test we implement the error interface
+var _ error = &ErrorHTTPFailedPublish{}
+
+// HTTPPublisherOptions configures an HTTPPublisher
+type HTTPPublisherOptions struct {
+	// Endpoint to POST events to
+	Endpoint string
+	// Source is used as the CloudEvents source attribute, typically
+	// identifying the cluster that the events originate from
+	Source string
+	// Secret used to sign the request body. If empty, requests are not signed.
+	Secret string
+	// MaxRetries is the number of times a failed request is retried
+	MaxRetries int
+	// Backoff is the delay before the first retry, which doubles for each
+	// subsequent retry
+	Backoff time.Duration
+	// Timeout for each request, which is also bounded by the deadline of the
+	// context passed to Publish
+	Timeout time.Duration
+}
+
+// HTTPPublisher implements the publisher.Publisher interface, allowing us to
+// publish messages to an HTTP endpoint as CloudEvents in binary content mode:
+// the event is sent as the JSON request body, and the CloudEvents attributes
+// as ce-* headers.
+//
+// Network errors, 5xx and 429 responses are retried with exponential backoff.
+// Events are published from admission webhooks and the reconcile loop, so
+// retries stop at the deadline of the context passed to Publish rather than
+// blocking those indefinitely. Wrap the publisher in an Outbox to keep events
+// that still fail to publish across restarts.
+type HTTPPublisher struct {
+	client *http.Client
+	opts   HTTPPublisherOptions
+}
+
+// Test we implement the Publisher interface
+var _ Publisher = &HTTPPublisher{}
+
+func NewHTTPPublisher(opts HTTPPublisherOptions) *HTTPPublisher {
+	return &HTTPPublisher{
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+	}
+}
+
+// eventKinder is implemented by all lifecycle events, through CommonEvent
+type eventKinder interface {
+	EventKind() string
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, msg interface{}) (string, error) {
+	messageBytes, err := json.Marshal(msg)
+	if err != nil {
+		return "", ErrorHTTPFailedPublish{err: err, Endpoint: p.opts.Endpoint}
+	}
+
+	id := uuid.New().String()
+	eventType := CloudEventsTypePrefix
+	if e, ok := msg.(eventKinder); ok {
+		eventType = fmt.Sprintf("%s.%s", CloudEventsTypePrefix, strings.ToLower(strings.ReplaceAll(e.EventKind(), "/", ".")))
+	}
+
+	backoff := p.opts.Backoff
+	attempts := 0
+	for {
+		attempts++
+		retryable, err := p.send(ctx, id, eventType, messageBytes)
+		if err == nil {
+			return id, nil
+		}
+
+		if !retryable || attempts > p.opts.MaxRetries {
+			return "", ErrorHTTPFailedPublish{err: err, Endpoint: p.opts.Endpoint, Attempts: attempts}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ErrorHTTPFailedPublish{err: ctx.Err(), Endpoint: p.opts.Endpoint, Attempts: attempts}
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send makes a single attempt at delivering the event, returning whether the
+// request can be retried if it failed.
+func (p *HTTPPublisher) send(ctx context.Context, id, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", CloudEventsSpecVersion)
+	req.Header.Set("ce-id", id)
+	req.Header.Set("ce-type", eventType)
+	req.Header.Set("ce-source", p.opts.Source)
+	req.Header.Set("ce-time", time.Now().UTC().Format(time.RFC3339))
+
+	if p.opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign([]byte(p.opts.Secret), body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// Don't retry once the context is done, as every attempt would fail
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected response status: %s", resp.Status)
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+
+	return retryable, err
+}
+
+// Sign returns the signature of the body using the secret, in the format used
+// by the SignatureHeader. Receivers can use this to verify requests.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPPublisher", func() {
+	var (
+		server    *httptest.Server
+		publisher *HTTPPublisher
+		requests  chan *http.Request
+		bodies    chan []byte
+		statuses  []int
+		attempts  int32
+		event     *ConsoleRequestEvent
+		release   chan struct{}
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 10)
+		bodies = make(chan []byte, 10)
+		statuses = []int{http.StatusOK}
+		attempts = 0
+		release = nil
+
+		event = &ConsoleRequestEvent{
+			CommonEvent: CommonEvent{
+				Version: "v1alpha1",
+				Kind:    KindConsole,
+				Event:   EventRequest,
+				Id:      "console-id",
+			},
+			Spec: ConsoleRequestSpec{Username: "user@example.com"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Hold the request until released, if set
+			if release != nil {
+				<-release
+				return
+			}
+
+			attempt := int(atomic.AddInt32(&attempts, 1))
+			body, _ := io.ReadAll(r.Body)
+			requests <- r
+			bodies <- body
+
+			status := statuses[len(statuses)-1]
+			if attempt <= len(statuses) {
+				status = statuses[attempt-1]
+			}
+			w.WriteHeader(status)
+		}))
+
+		publisher = NewHTTPPublisher(HTTPPublisherOptions{
+			Endpoint:   server.URL,
+			Source:     "theatre/test",
+			Secret:     "secret",
+			MaxRetries: 2,
+			Backoff:    time.Millisecond,
+			Timeout:    time.Second,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("publishes the event as a signed CloudEvent", func() {
+		id, err := publisher.Publish(context.TODO(), event)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := <-requests
+		body := <-bodies
+
+		Expect(req.Method).To(Equal(http.MethodPost))
+		Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.Header.Get("ce-specversion")).To(Equal("1.0"))
+		Expect(req.Header.Get("ce-id")).To(Equal(id))
+		Expect(req.Header.Get("ce-source")).To(Equal("theatre/test"))
+		Expect(req.Header.Get("ce-type")).To(Equal("com.gocardless.theatre.console.request"))
+		Expect(req.Header.Get(SignatureHeader)).To(Equal(Sign([]byte("secret"), body)))
+
+		var received ConsoleRequestEvent
+		Expect(json.Unmarshal(body, &received)).To(Succeed())
+		Expect(received.Spec.Username).To(Equal("user@example.com"))
+	})
+
+	Context("when the endpoint fails temporarily", func() {
+		BeforeEach(func() {
+			statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+		})
+
+		It("retries until the event is published", func() {
+			_, err := publisher.Publish(context.TODO(), event)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&attempts)).To(BeEquivalentTo(3))
+		})
+	})
+
+	Context("when the endpoint keeps failing", func() {
+		BeforeEach(func() {
+			statuses = []int{http.StatusInternalServerError}
+		})
+
+		It("gives up after the maximum number of retries", func() {
+			_, err := publisher.Publish(context.TODO(), event)
+
+			var publishErr ErrorHTTPFailedPublish
+			Expect(errors.As(err, &publishErr)).To(BeTrue())
+			Expect(publishErr.Endpoint).To(Equal(server.URL))
+			Expect(publishErr.Attempts).To(Equal(3))
+			Expect(err).To(MatchError(ContainSubstring("unexpected response status: 500")))
+			Expect(atomic.LoadInt32(&attempts)).To(BeEquivalentTo(3))
+		})
+	})
+
+	Context("when the endpoint rejects the event", func() {
+		BeforeEach(func() {
+			statuses = []int{http.StatusBadRequest}
+		})
+
+		It("does not retry", func() {
+			_, err := publisher.Publish(context.TODO(), event)
+			Expect(err).To(HaveOccurred())
+			Expect(atomic.LoadInt32(&attempts)).To(BeEquivalentTo(1))
+		})
+	})
+
+	Context("when the endpoint is slower than the context deadline", func() {
+		BeforeEach(func() {
+			release = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("gives up at the deadline", func() {
+			ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := publisher.Publish(ctx, event)
+			Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+})
@@ -0,0 +1,232 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	outboxDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "theatre_lifecycle_events_outbox_depth",
+			Help: "Number of lifecycle events waiting in the outbox to be published",
+		},
+	)
+	outboxRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "theatre_lifecycle_events_outbox_retries_total",
+			Help: "Count of attempts to publish lifecycle events from the outbox, by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	// Register custom metrics with the global controller runtime prometheus registry
+	metrics.Registry.MustRegister(outboxDepth, outboxRetries)
+}
+
+// OutboxEntry is an event that failed to publish, stored until it can be
+// delivered
+type OutboxEntry struct {
+	ID          string
+	Type        string
+	Payload     []byte
+	Attempts    int
+	NextAttempt time.Time
+}
+
+// OutboxStore persists outbox entries, so that events survive restarts of the
+// process publishing them
+type OutboxStore interface {
+	Add(context.Context, OutboxEntry) error
+	List(context.Context) ([]OutboxEntry, error)
+	Update(context.Context, OutboxEntry) error
+	Remove(context.Context, string) error
+}
+
+// ErrorOutboxQueued is returned when an event could not be published
+// immediately, but has been stored in the outbox to be retried
+type ErrorOutboxQueued struct {
+	err error
+	ID  string
+}
+
+func (e ErrorOutboxQueued) Unwrap() error { return e.err }
+func (e ErrorOutboxQueued) Error() string {
+	return fmt.Sprintf(
+		"queued message '%s' in outbox for retry: %s",
+		e.ID,
+		e.err,
+	)
+}
+
+// Test we implement the error interface
+var _ error = &ErrorOutboxQueued{}
+
+// OutboxOptions configures an Outbox
+type OutboxOptions struct {
+	// PollInterval is how often the outbox is checked for events that are due
+	// to be retried
+	PollInterval time.Duration
+	// Backoff is the delay before the first retry, which doubles for each
+	// subsequent retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries, if set
+	MaxBackoff time.Duration
+}
+
+// Outbox implements the publisher.Publisher interface, wrapping another
+// publisher. Events that fail to publish are stored, and retried with backoff
+// until the underlying publisher accepts them.
+//
+// The outbox implements the controller-runtime Runnable interface, so that
+// retries happen in the background of the manager, and only on the leader.
+type Outbox struct {
+	publisher Publisher
+	store     OutboxStore
+	logger    logr.Logger
+	opts      OutboxOptions
+}
+
+// Test we implement the Publisher interface
+var _ Publisher = &Outbox{}
+
+func NewOutbox(publisher Publisher, store OutboxStore, logger logr.Logger, opts OutboxOptions) *Outbox {
+	return &Outbox{
+		publisher: publisher,
+		store:     store,
+		logger:    logger,
+		opts:      opts,
+	}
+}
+
+// outboxMessage is published in place of the original event when retrying.
+// It serialises to the original payload, and retains the event kind for
+// publishers that make use of it.
+type outboxMessage struct {
+	kind    string
+	payload []byte
+}
+
+func (m outboxMessage) EventKind() string {
+	return m.kind
+}
+
+func (m outboxMessage) MarshalJSON() ([]byte, error) {
+	return m.payload, nil
+}
+
+func (o *Outbox) Publish(ctx context.Context, msg interface{}) (string, error) {
+	id, err := o.publisher.Publish(ctx, msg)
+	if err == nil {
+		return id, nil
+	}
+
+	payload, marshalErr := json.Marshal(msg)
+	if marshalErr != nil {
+		return "", err
+	}
+
+	entry := OutboxEntry{
+		ID:          uuid.New().String(),
+		Payload:     payload,
+		Attempts:    1,
+		NextAttempt: time.Now().Add(o.backoff(1)),
+	}
+	if e, ok := msg.(eventKinder); ok {
+		entry.Type = e.EventKind()
+	}
+
+	if storeErr := o.store.Add(ctx, entry); storeErr != nil {
+		o.logger.Error(storeErr, "failed to store event in outbox", "event", entry.Type)
+		return "", err
+	}
+	outboxDepth.Inc()
+
+	return "", ErrorOutboxQueued{err: err, ID: entry.ID}
+}
+
+// Start retries events in the outbox until the context is cancelled
+func (o *Outbox) Start(ctx context.Context) error {
+	ticker := time.NewTicker(o.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.Flush(ctx, time.Now()); err != nil {
+			o.logger.Error(err, "failed to flush outbox")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush attempts to publish every event in the outbox that is due for retry
+// at the given time.
+func (o *Outbox) Flush(ctx context.Context, now time.Time) error {
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := len(entries)
+	defer func() { outboxDepth.Set(float64(pending)) }()
+
+	for _, entry := range entries {
+		if entry.NextAttempt.After(now) {
+			continue
+		}
+
+		logger := o.logger.WithValues("outbox_id", entry.ID, "event", entry.Type, "attempts", entry.Attempts)
+
+		id, err := o.publisher.Publish(ctx, outboxMessage{kind: entry.Type, payload: entry.Payload})
+		if err != nil {
+			outboxRetries.WithLabelValues("error").Inc()
+			logger.Error(err, "failed to publish event from outbox")
+
+			entry.Attempts++
+			entry.NextAttempt = now.Add(o.backoff(entry.Attempts))
+			if err := o.store.Update(ctx, entry); err != nil {
+				return err
+			}
+			continue
+		}
+
+		outboxRetries.WithLabelValues("success").Inc()
+		logger.Info("event recorded from outbox", "id", id)
+
+		// If removal fails the event will be published again, so receivers must
+		// tolerate duplicate events.
+		if err := o.store.Remove(ctx, entry.ID); err != nil {
+			return err
+		}
+		pending--
+	}
+
+	return nil
+}
+
+// backoff returns the delay before the next attempt, after the given number of
+// failed attempts
+func (o *Outbox) backoff(attempts int) time.Duration {
+	backoff := o.opts.Backoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if o.opts.MaxBackoff > 0 && backoff >= o.opts.MaxBackoff {
+			return o.opts.MaxBackoff
+		}
+	}
+
+	return backoff
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// OutboxLabel identifies the ConfigMaps that make up the outbox
+	OutboxLabel = "theatre.gocardless.com/lifecycle-event-outbox"
+
+	outboxNamePrefix     = "theatre-lifecycle-event-"
+	outboxKeyType        = "type"
+	outboxKeyPayload     = "payload"
+	outboxKeyAttempts    = "attempts"
+	outboxKeyNextAttempt = "nextAttempt"
+)
+
+// ConfigMapOutboxStore stores each outbox entry as a ConfigMap in a single
+// namespace, usually that of the manager.
+type ConfigMapOutboxStore struct {
+	client    client.Client
+	namespace string
+	logger    logr.Logger
+}
+
+// Test we implement the OutboxStore interface
+var _ OutboxStore = &ConfigMapOutboxStore{}
+
+// NewConfigMapOutboxStore creates a store using the given client, which should
+// not be backed by a cache: the store is only read by the outbox, and caching
+// every ConfigMap in the cluster for it would be wasteful.
+func NewConfigMapOutboxStore(client client.Client, namespace string, logger logr.Logger) *ConfigMapOutboxStore {
+	return &ConfigMapOutboxStore{
+		client:    client,
+		namespace: namespace,
+		logger:    logger,
+	}
+}
+
+func (s *ConfigMapOutboxStore) Add(ctx context.Context, entry OutboxEntry) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      outboxNamePrefix + entry.ID,
+			Namespace: s.namespace,
+			Labels:    map[string]string{OutboxLabel: "true"},
+		},
+	}
+	writeOutboxEntry(cm, entry)
+
+	return errors.Wrap(s.client.Create(ctx, cm), "failed to create outbox entry")
+}
+
+func (s *ConfigMapOutboxStore) List(ctx context.Context) ([]OutboxEntry, error) {
+	cms := &corev1.ConfigMapList{}
+	err := s.client.List(ctx, cms, client.InNamespace(s.namespace), client.MatchingLabels{OutboxLabel: "true"})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list outbox entries")
+	}
+
+	// A malformed entry can never be published, so it is skipped rather than
+	// preventing every other entry from being delivered. It is left in place to
+	// be inspected, and removed by hand.
+	entries := make([]OutboxEntry, 0, len(cms.Items))
+	for _, cm := range cms.Items {
+		entry, err := readOutboxEntry(&cm)
+		if err != nil {
+			s.logger.Error(err, "skipping malformed outbox entry", "configmap", cm.Name)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (s *ConfigMapOutboxStore) Update(ctx context.Context, entry OutboxEntry) error {
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: s.namespace, Name: outboxNamePrefix + entry.ID}
+	if err := s.client.Get(ctx, key, cm); err != nil {
+		return errors.Wrap(err, "failed to get outbox entry")
+	}
+	writeOutboxEntry(cm, entry)
+
+	return errors.Wrap(s.client.Update(ctx, cm), "failed to update outbox entry")
+}
+
+func (s *ConfigMapOutboxStore) Remove(ctx context.Context, id string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      outboxNamePrefix + id,
+			Namespace: s.namespace,
+		},
+	}
+
+	err := s.client.Delete(ctx, cm)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+
+	return errors.Wrap(err, "failed to delete outbox entry")
+}
+
+func writeOutboxEntry(cm *corev1.ConfigMap, entry OutboxEntry) {
+	cm.Data = map[string]string{
+		outboxKeyType:        entry.Type,
+		outboxKeyPayload:     string(entry.Payload),
+		outboxKeyAttempts:    strconv.Itoa(entry.Attempts),
+		outboxKeyNextAttempt: entry.NextAttempt.UTC().Format(time.RFC3339),
+	}
+}
+
+func readOutboxEntry(cm *corev1.ConfigMap) (OutboxEntry, error) {
+	attempts, err := strconv.Atoi(cm.Data[outboxKeyAttempts])
+	if err != nil {
+		return OutboxEntry{}, errors.Wrap(err, "invalid attempts")
+	}
+
+	nextAttempt, err := time.Parse(time.RFC3339, cm.Data[outboxKeyNextAttempt])
+	if err != nil {
+		return OutboxEntry{}, errors.Wrap(err, "invalid next attempt time")
+	}
+
+	return OutboxEntry{
+		ID:          cm.Name[len(outboxNamePrefix):],
+		Type:        cm.Data[outboxKeyType],
+		Payload:     []byte(cm.Data[outboxKeyPayload]),
+		Attempts:    attempts,
+		NextAttempt: nextAttempt,
+	}, nil
+}
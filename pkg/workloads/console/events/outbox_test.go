@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakePublisher fails to publish while err is set, and records every message
+// it publishes successfully
+type fakePublisher struct {
+	err       error
+	published []interface{}
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msg interface{}) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	p.published = append(p.published, msg)
+
+	return "published", nil
+}
+
+var _ = Describe("Outbox", func() {
+	var (
+		ctx       context.Context
+		publisher *fakePublisher
+		kube      client.Client
+		store     *ConfigMapOutboxStore
+		outbox    *Outbox
+		event     *ConsoleRequestEvent
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		publisher = &fakePublisher{}
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		kube = fake.NewClientBuilder().WithScheme(scheme).Build()
+		store = NewConfigMapOutboxStore(kube, "theatre-system", logr.Discard())
+
+		outbox = NewOutbox(publisher, store, logr.Discard(), OutboxOptions{
+			Backoff:    time.Minute,
+			MaxBackoff: 5 * time.Minute,
+		})
+
+		event = &ConsoleRequestEvent{
+			CommonEvent: CommonEvent{Kind: KindConsole, Event: EventRequest},
+			Spec:        ConsoleRequestSpec{Username: "user@example.com"},
+		}
+	})
+
+	Context("when the publisher succeeds", func() {
+		It("publishes the event without storing it", func() {
+			id, err := outbox.Publish(ctx, event)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("published"))
+
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+
+	Context("when the publisher fails", func() {
+		BeforeEach(func() {
+			publisher.err = errors.New("unavailable")
+		})
+
+		It("stores the event for retry", func() {
+			_, err := outbox.Publish(ctx, event)
+
+			var queuedErr ErrorOutboxQueued
+			Expect(errors.As(err, &queuedErr)).To(BeTrue())
+
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].ID).To(Equal(queuedErr.ID))
+			Expect(entries[0].Type).To(Equal("Console/Request"))
+			Expect(entries[0].Attempts).To(Equal(1))
+		})
+
+		It("backs off while the publisher keeps failing", func() {
+			_, _ = outbox.Publish(ctx, event)
+			now := time.Now()
+
+			By("not retrying before the backoff has elapsed")
+			Expect(outbox.Flush(ctx, now)).To(Succeed())
+			entries, _ := store.List(ctx)
+			Expect(entries[0].Attempts).To(Equal(1))
+
+			By("doubling the backoff after each failure")
+			Expect(outbox.Flush(ctx, now.Add(2*time.Minute))).To(Succeed())
+			entries, _ = store.List(ctx)
+			Expect(entries[0].Attempts).To(Equal(2))
+			Expect(entries[0].NextAttempt).To(BeTemporally("~", now.Add(4*time.Minute), time.Second))
+
+			By("capping the backoff")
+			Expect(outbox.Flush(ctx, now.Add(10*time.Minute))).To(Succeed())
+			Expect(outbox.Flush(ctx, now.Add(20*time.Minute))).To(Succeed())
+			entries, _ = store.List(ctx)
+			Expect(entries[0].Attempts).To(Equal(4))
+			Expect(entries[0].NextAttempt).To(BeTemporally("~", now.Add(25*time.Minute), time.Second))
+		})
+
+		It("publishes the original event once the publisher recovers", func() {
+			_, _ = outbox.Publish(ctx, event)
+
+			publisher.err = nil
+			Expect(outbox.Flush(ctx, time.Now().Add(time.Hour))).To(Succeed())
+
+			Expect(publisher.published).To(HaveLen(1))
+			msg, ok := publisher.published[0].(eventKinder)
+			Expect(ok).To(BeTrue())
+			Expect(msg.EventKind()).To(Equal("Console/Request"))
+
+			var received ConsoleRequestEvent
+			Expect(json.Unmarshal(mustMarshal(publisher.published[0]), &received)).To(Succeed())
+			Expect(received.Spec.Username).To(Equal("user@example.com"))
+
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		Context("with a malformed entry in the outbox", func() {
+			BeforeEach(func() {
+				Expect(kube.Create(ctx, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      outboxNamePrefix + "corrupt",
+						Namespace: "theatre-system",
+						Labels:    map[string]string{OutboxLabel: "true"},
+					},
+					Data: map[string]string{outboxKeyAttempts: "many"},
+				})).To(Succeed())
+			})
+
+			It("skips it and publishes the other events", func() {
+				_, err := outbox.Publish(ctx, event)
+				var queuedErr ErrorOutboxQueued
+				Expect(errors.As(err, &queuedErr)).To(BeTrue())
+
+				entries, err := store.List(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].ID).To(Equal(queuedErr.ID))
+
+				publisher.err = nil
+				Expect(outbox.Flush(ctx, time.Now().Add(time.Hour))).To(Succeed())
+				Expect(publisher.published).To(HaveLen(1))
+			})
+		})
+	})
+})
+
+func mustMarshal(msg interface{}) []byte {
+	data, err := json.Marshal(msg)
+	Expect(err).NotTo(HaveOccurred())
+
+	return data
+}
@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the shape of the request body sent to a target
+type Format string
+
+const (
+	// FormatSlack sends the message as the text of a Slack incoming webhook,
+	// which is also understood by most chat tools with Slack-compatible webhooks
+	FormatSlack Format = "slack"
+	// FormatJSON sends the notification as a JSON object, along with the message
+	FormatJSON Format = "json"
+)
+
+// Config lists the targets that notifications are sent to
+type Config struct {
+	Targets []Target `json:"targets"`
+}
+
+// Target is a webhook that receives notifications for consoles in the given
+// namespaces, or created from the given templates. A target that sets neither
+// receives notifications for every console.
+type Target struct {
+	Name   string `json:"name"`
+	Format Format `json:"format"`
+	// URL to POST notifications to. As webhook URLs often contain credentials,
+	// they can instead be read from URLFile, e.g. a mounted secret.
+	URL     string `json:"url,omitempty"`
+	URLFile string `json:"urlFile,omitempty"`
+	// Namespaces whose consoles are notified about
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ConsoleTemplates whose consoles are notified about, either by name in any
+	// namespace or as namespace/name
+	ConsoleTemplates []string `json:"consoleTemplates,omitempty"`
+	// Messages override the default message for each event, as Go templates
+	// that are given the Notification
+	Messages map[Event]string `json:"messages,omitempty"`
+}
+
+// Matches returns whether the target should be notified about the console
+func (t Target) Matches(n Notification) bool {
+	if len(t.Namespaces) > 0 && !slices.Contains(t.Namespaces, n.Namespace) {
+		return false
+	}
+
+	if len(t.ConsoleTemplates) > 0 &&
+		!slices.Contains(t.ConsoleTemplates, n.ConsoleTemplate) &&
+		!slices.Contains(t.ConsoleTemplates, n.Namespace+"/"+n.ConsoleTemplate) {
+		return false
+	}
+
+	return true
+}
+
+// Validate checks that the target can be sent notifications, and that its
+// messages are valid templates
+func (t Target) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("target must have a name")
+	}
+
+	if t.Format != FormatSlack && t.Format != FormatJSON {
+		return fmt.Errorf("target %s has unsupported format %q, must be one of: %s, %s", t.Name, t.Format, FormatSlack, FormatJSON)
+	}
+
+	if t.URL == "" {
+		return fmt.Errorf("target %s must have a url or urlFile", t.Name)
+	}
+	if u, err := url.Parse(t.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("target %s must have an http or https url", t.Name)
+	}
+
+	for event, message := range t.Messages {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("target %s has a message for unknown event %q", t.Name, event)
+		}
+		if _, err := parseMessage(message); err != nil {
+			return errors.Wrapf(err, "target %s has an invalid message for event %s", t.Name, event)
+		}
+	}
+
+	return nil
+}
+
+// LoadConfig reads the config from a YAML file, resolving any URLs that are
+// stored in files.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, errors.Wrap(err, "failed to open notifier config file")
+	}
+
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return cfg, errors.Wrap(err, "failed to parse notifier config")
+	}
+
+	for idx, target := range cfg.Targets {
+		if target.Format == "" {
+			target.Format = FormatJSON
+		}
+
+		if target.URL == "" && target.URLFile != "" {
+			contents, err := os.ReadFile(target.URLFile)
+			if err != nil {
+				return cfg, errors.Wrapf(err, "failed to read url of target %s", target.Name)
+			}
+			target.URL = strings.TrimSpace(string(contents))
+		}
+
+		cfg.Targets[idx] = target
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that each target is valid and has a distinct name
+func (c Config) Validate() error {
+	names := map[string]bool{}
+	for _, target := range c.Targets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		if names[target.Name] {
+			return fmt.Errorf("target %s is defined more than once", target.Name)
+		}
+		names[target.Name] = true
+	}
+
+	return nil
+}
+
+func parseMessage(message string) (*template.Template, error) {
+	return template.New("message").Funcs(template.FuncMap{"join": strings.Join}).Parse(message)
+}
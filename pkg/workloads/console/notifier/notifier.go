@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"time"
+)
+
+// Event is the point in a console's authorisation that a notification is sent for
+type Event string
+
+const (
+	// EventRequest is sent when a console that requires authorisation is requested
+	EventRequest Event = "Request"
+	// EventAuthorised is sent when a console has received all of the
+	// authorisations it requires
+	EventAuthorised Event = "Authorised"
+	// EventRejected is sent when an authoriser rejects a console
+	EventRejected Event = "Rejected"
+	// EventExpired is sent when a console is deleted before it was authorised
+	EventExpired Event = "Expired"
+)
+
+// Events are all the events that notifications are sent for
+var Events = []Event{EventRequest, EventAuthorised, EventRejected, EventExpired}
+
+// Notification describes a console awaiting, or no longer awaiting, authorisation
+type Notification struct {
+	Event Event `json:"event"`
+	// Context is used to denote the cluster name, and is set by the notifier
+	Context                string    `json:"context"`
+	Namespace              string    `json:"namespace"`
+	Console                string    `json:"console"`
+	ConsoleTemplate        string    `json:"console_template"`
+	Username               string    `json:"username"`
+	Reason                 string    `json:"reason"`
+	Command                []string  `json:"command"`
+	RequiredAuthorisations int       `json:"required_authorisations"`
+	AuthorisationRuleName  string    `json:"authorisation_rule_name"`
+	Authorisers            []string  `json:"authorisers"`
+	AuthorisedBy           []string  `json:"authorised_by,omitempty"`
+	RejectedBy             string    `json:"rejected_by,omitempty"`
+	RejectionReason        string    `json:"rejection_reason,omitempty"`
+	Timestamp              time.Time `json:"timestamp"`
+}
+
+// Notifier tells authorisers about consoles that need their authorisation
+type Notifier interface {
+	Notify(context.Context, Notification) error
+}
+
+var _ Notifier = &NopNotifier{}
+
+// NopNotifier discards notifications, and is used when no targets are configured
+type NopNotifier struct{}
+
+func (nop NopNotifier) Notify(_ context.Context, _ Notification) error { return nil }
+
+func NewNopNotifier() *NopNotifier {
+	return &NopNotifier{}
+}
@@ -0,0 +1,59 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+)
+
+// QueuedNotifier sends notifications in the background, so that callers such as
+// the console controller aren't held up by slow or unavailable targets. It must
+// be started, e.g. by adding it to a controller-runtime manager.
+type QueuedNotifier struct {
+	logger   logr.Logger
+	notifier Notifier
+	queue    chan Notification
+}
+
+var _ Notifier = &QueuedNotifier{}
+
+// NewQueuedNotifier queues up to size notifications to be sent by the given
+// notifier. Notifications are dropped, with an error, once the queue is full.
+func NewQueuedNotifier(logger logr.Logger, notifier Notifier, size int) *QueuedNotifier {
+	return &QueuedNotifier{
+		logger:   logger,
+		notifier: notifier,
+		queue:    make(chan Notification, size),
+	}
+}
+
+func (q *QueuedNotifier) Notify(_ context.Context, notification Notification) error {
+	select {
+	case q.queue <- notification:
+		return nil
+	default:
+		return fmt.Errorf("notification queue is full, dropping %s notification", notification.Event)
+	}
+}
+
+// Start sends queued notifications until the context is cancelled. As with the
+// underlying notifier, failures are logged but never retried.
+func (q *QueuedNotifier) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-q.queue:
+			if err := q.notifier.Notify(ctx, notification); err != nil {
+				q.logger.Error(
+					err, "failed to send notification",
+					"event", "notification.error",
+					"notification", notification.Event,
+					"console_namespace", notification.Namespace,
+					"console_name", notification.Console,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QueuedNotifier", func() {
+	var (
+		target *blockingNotifier
+		queued *QueuedNotifier
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		target = &blockingNotifier{release: make(chan struct{})}
+		queued = NewQueuedNotifier(logr.Discard(), target, 1)
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("returns without waiting for the notification to be sent", func() {
+		Expect(queued.Notify(context.TODO(), Notification{Event: EventRequest})).To(Succeed())
+		Expect(target.Sent()).To(BeEmpty())
+
+		go queued.Start(ctx)
+		close(target.release)
+
+		Eventually(target.Sent).Should(Equal([]Event{EventRequest}))
+	})
+
+	It("drops notifications once the queue is full", func() {
+		Expect(queued.Notify(context.TODO(), Notification{Event: EventRequest})).To(Succeed())
+		Expect(queued.Notify(context.TODO(), Notification{Event: EventAuthorised})).To(
+			MatchError("notification queue is full, dropping Authorised notification"),
+		)
+	})
+
+	It("continues after a notification fails", func() {
+		target.fail = true
+		close(target.release)
+		go queued.Start(ctx)
+
+		for _, event := range []Event{EventRequest, EventAuthorised} {
+			Eventually(func() error {
+				return queued.Notify(context.TODO(), Notification{Event: event})
+			}).Should(Succeed())
+		}
+
+		Eventually(target.Sent).Should(Equal([]Event{EventRequest, EventAuthorised}))
+	})
+})
+
+// blockingNotifier records notifications once it's released
+type blockingNotifier struct {
+	release chan struct{}
+	fail    bool
+	sent    []Event
+	sync.Mutex
+}
+
+func (n *blockingNotifier) Notify(_ context.Context, notification Notification) error {
+	<-n.release
+
+	n.Lock()
+	defer n.Unlock()
+	n.sent = append(n.sent, notification.Event)
+
+	if n.fail {
+		return fmt.Errorf("target unavailable")
+	}
+
+	return nil
+}
+
+func (n *blockingNotifier) Sent() []Event {
+	n.Lock()
+	defer n.Unlock()
+	return append([]Event{}, n.sent...)
+}
@@ -0,0 +1,218 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+)
+
+// DefaultMessages are sent for each event unless a target overrides them
+var DefaultMessages = map[Event]string{
+	EventRequest: strings.Join([]string{
+		"{{ .Username }} has requested console {{ .Namespace }}/{{ .Console }}{{ with .Context }} in {{ . }}{{ end }}, " +
+			"which needs {{ .RequiredAuthorisations }} authorisation(s).",
+		"Reason: {{ or .Reason \"(none)\" }}",
+		"Command: {{ join .Command \" \" }}",
+		"Template: {{ .ConsoleTemplate }}",
+		"Authorisers: {{ join .Authorisers \", \" }}",
+		"Authorise with: theatre-consoles authorise --namespace {{ .Namespace }} --name {{ .Console }}",
+	}, "\n"),
+	EventAuthorised: "Console {{ .Namespace }}/{{ .Console }} requested by {{ .Username }} has been authorised" +
+		"{{ with .AuthorisedBy }} by {{ join . \", \" }}{{ end }}.",
+	EventRejected: "Console {{ .Namespace }}/{{ .Console }} requested by {{ .Username }} has been rejected by " +
+		"{{ .RejectedBy }}: {{ .RejectionReason }}",
+	EventExpired: "Console {{ .Namespace }}/{{ .Console }} requested by {{ .Username }} expired before it was authorised.",
+}
+
+// maxResponseBytes limits how much of a target's response we read, as we only
+// need it to explain failures
+const maxResponseBytes = 4 << 10
+
+// WebhookNotifier POSTs notifications to each target that matches the console.
+// Notifications are best effort, so failures are returned but never retried.
+type WebhookNotifier struct {
+	client      *http.Client
+	contextName string
+	logger      logr.Logger
+	targets     []webhookTarget
+}
+
+var _ Notifier = &WebhookNotifier{}
+
+type webhookTarget struct {
+	Target
+	messages map[Event]*template.Template
+}
+
+// NewWebhookNotifier creates a notifier for the targets in the config, which
+// labels notifications with the name of the context it runs within.
+func NewWebhookNotifier(client *http.Client, contextName string, logger logr.Logger, cfg Config) (*WebhookNotifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	targets := []webhookTarget{}
+	for _, target := range cfg.Targets {
+		messages := map[Event]*template.Template{}
+		for _, event := range Events {
+			message, ok := target.Messages[event]
+			if !ok {
+				message = DefaultMessages[event]
+			}
+
+			tmpl, err := parseMessage(message)
+			if err != nil {
+				return nil, errors.Wrapf(err, "target %s has an invalid message for event %s", target.Name, event)
+			}
+			messages[event] = tmpl
+		}
+
+		targets = append(targets, webhookTarget{Target: target, messages: messages})
+	}
+
+	return &WebhookNotifier{
+		client:      client,
+		contextName: contextName,
+		logger:      logger,
+		targets:     targets,
+	}, nil
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	notification.Context = n.contextName
+
+	failures := []string{}
+	for _, target := range n.targets {
+		if !target.Matches(notification) {
+			continue
+		}
+
+		if err := n.send(ctx, target, notification); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", target.Name, err))
+			continue
+		}
+
+		n.logger.Info(
+			"notification sent",
+			"event", "notification.sent",
+			"target", target.Name,
+			"notification", notification.Event,
+			"console_namespace", notification.Namespace,
+			"console_name", notification.Console,
+		)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to notify targets: %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (n *WebhookNotifier) send(ctx context.Context, target webhookTarget, notification Notification) error {
+	// Slack interprets <...> as links and mentions, so values that users control,
+	// such as the reason and command, must be escaped to be shown as written
+	data := notification
+	if target.Format == FormatSlack {
+		data = escapeSlack(notification)
+	}
+
+	var message bytes.Buffer
+	if err := target.messages[notification.Event].Execute(&message, data); err != nil {
+		return errors.Wrap(err, "failed to render message")
+	}
+
+	var payload interface{}
+	switch target.Format {
+	case FormatSlack:
+		payload = slackPayload{Text: message.String()}
+	default:
+		payload = jsonPayload{Notification: notification, Message: message.String()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// Drop the URL from the error, as it may contain credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		return fmt.Errorf("unexpected response status %s: %s", resp.Status, strings.TrimSpace(string(response)))
+	}
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeSlack escapes the control characters of Slack's message formatting in
+// every string of the notification
+func escapeSlack(n Notification) Notification {
+	escapeAll := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+
+		escaped := make([]string, len(values))
+		for idx, value := range values {
+			escaped[idx] = slackEscaper.Replace(value)
+		}
+
+		return escaped
+	}
+
+	n.Context = slackEscaper.Replace(n.Context)
+	n.Namespace = slackEscaper.Replace(n.Namespace)
+	n.Console = slackEscaper.Replace(n.Console)
+	n.ConsoleTemplate = slackEscaper.Replace(n.ConsoleTemplate)
+	n.Username = slackEscaper.Replace(n.Username)
+	n.Reason = slackEscaper.Replace(n.Reason)
+	n.Command = escapeAll(n.Command)
+	n.AuthorisationRuleName = slackEscaper.Replace(n.AuthorisationRuleName)
+	n.Authorisers = escapeAll(n.Authorisers)
+	n.AuthorisedBy = escapeAll(n.AuthorisedBy)
+	n.RejectedBy = slackEscaper.Replace(n.RejectedBy)
+	n.RejectionReason = slackEscaper.Replace(n.RejectionReason)
+
+	return n
+}
+
+// slackPayload is the body of a Slack incoming webhook
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// jsonPayload is the notification, along with the message rendered for it
+type jsonPayload struct {
+	Notification
+	Message string `json:"message"`
+}
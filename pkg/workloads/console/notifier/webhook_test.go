@@ -0,0 +1,278 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebhookNotifier", func() {
+	var (
+		server       *httptest.Server
+		bodies       map[string][]byte
+		status       int
+		cfg          Config
+		notification Notification
+		err          error
+	)
+
+	BeforeEach(func() {
+		bodies = map[string][]byte{}
+		status = http.StatusOK
+
+		notification = Notification{
+			Event:                  EventRequest,
+			Namespace:              "payments",
+			Console:                "app-abc",
+			ConsoleTemplate:        "app",
+			Username:               "bob@example.com",
+			Reason:                 "debugging",
+			Command:                []string{"rails", "console"},
+			RequiredAuthorisations: 2,
+			Authorisers:            []string{"sre@example.com", "alice@example.com"},
+		}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			bodies[r.URL.Path], _ = io.ReadAll(r.Body)
+			w.WriteHeader(status)
+		}))
+
+		cfg = Config{
+			Targets: []Target{
+				{Name: "slack", Format: FormatSlack, URL: server.URL + "/slack"},
+				{Name: "json", Format: FormatJSON, URL: server.URL + "/json", Namespaces: []string{"payments"}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		var notifier *WebhookNotifier
+		notifier, err = NewWebhookNotifier(server.Client(), "lab", logr.Discard(), cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = notifier.Notify(context.TODO(), notification)
+	})
+
+	It("sends Slack targets the message as text", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		var payload map[string]string
+		Expect(json.Unmarshal(bodies["/slack"], &payload)).To(Succeed())
+		Expect(payload).To(HaveKey("text"))
+		Expect(payload["text"]).To(HavePrefix("bob@example.com has requested console payments/app-abc in lab, which needs 2 authorisation(s)."))
+		Expect(payload["text"]).To(ContainSubstring("Command: rails console"))
+		Expect(payload["text"]).To(ContainSubstring("Authorisers: sre@example.com, alice@example.com"))
+		Expect(payload["text"]).To(ContainSubstring("theatre-consoles authorise --namespace payments --name app-abc"))
+	})
+
+	It("sends JSON targets the notification and message", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		var payload map[string]interface{}
+		Expect(json.Unmarshal(bodies["/json"], &payload)).To(Succeed())
+		Expect(payload).To(HaveKeyWithValue("event", "Request"))
+		Expect(payload).To(HaveKeyWithValue("context", "lab"))
+		Expect(payload).To(HaveKeyWithValue("console", "app-abc"))
+		Expect(payload).To(HaveKeyWithValue("required_authorisations", BeEquivalentTo(2)))
+		Expect(payload).To(HaveKeyWithValue("message", ContainSubstring("has requested console payments/app-abc")))
+	})
+
+	Context("When the reason and command contain Slack formatting", func() {
+		BeforeEach(func() {
+			notification.Reason = "<!channel> fix <https://evil.example.com|the docs> & more"
+			notification.Command = []string{"sh", "-c", "echo <b> > out"}
+		})
+
+		It("escapes them for Slack targets", func() {
+			var payload map[string]string
+			Expect(json.Unmarshal(bodies["/slack"], &payload)).To(Succeed())
+			Expect(payload["text"]).To(ContainSubstring(
+				"Reason: &lt;!channel&gt; fix &lt;https://evil.example.com|the docs&gt; &amp; more",
+			))
+			Expect(payload["text"]).To(ContainSubstring("Command: sh -c echo &lt;b&gt; &gt; out"))
+		})
+
+		It("sends them to JSON targets as written", func() {
+			var payload map[string]interface{}
+			Expect(json.Unmarshal(bodies["/json"], &payload)).To(Succeed())
+			Expect(payload).To(HaveKeyWithValue("reason", notification.Reason))
+			Expect(payload).To(HaveKeyWithValue("message", ContainSubstring("Reason: "+notification.Reason)))
+		})
+	})
+
+	Context("When the console doesn't match a target", func() {
+		BeforeEach(func() {
+			notification.Namespace = "banking"
+		})
+
+		It("doesn't notify the target", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bodies).To(HaveKey("/slack"))
+			Expect(bodies).NotTo(HaveKey("/json"))
+		})
+	})
+
+	Context("When the console is rejected", func() {
+		BeforeEach(func() {
+			notification.Event = EventRejected
+			notification.RejectedBy = "alice@example.com"
+			notification.RejectionReason = "not needed"
+		})
+
+		It("sends a follow up", func() {
+			var payload map[string]string
+			Expect(json.Unmarshal(bodies["/slack"], &payload)).To(Succeed())
+			Expect(payload["text"]).To(Equal(
+				"Console payments/app-abc requested by bob@example.com has been rejected by alice@example.com: not needed",
+			))
+		})
+	})
+
+	Context("When a target overrides the message", func() {
+		BeforeEach(func() {
+			notification.Event = EventAuthorised
+			notification.AuthorisedBy = []string{"alice@example.com", "carol@example.com"}
+			cfg.Targets[0].Messages = map[Event]string{
+				EventAuthorised: ":white_check_mark: {{ .Console }} approved by {{ join .AuthorisedBy \" and \" }}",
+			}
+		})
+
+		It("renders its message", func() {
+			var payload map[string]string
+			Expect(json.Unmarshal(bodies["/slack"], &payload)).To(Succeed())
+			Expect(payload["text"]).To(Equal(":white_check_mark: app-abc approved by alice@example.com and carol@example.com"))
+		})
+	})
+
+	Context("When a target responds with an error", func() {
+		BeforeEach(func() {
+			status = http.StatusNotFound
+		})
+
+		It("returns an error naming the targets", func() {
+			Expect(err).To(MatchError(ContainSubstring("failed to notify targets: slack: unexpected response status 404")))
+			Expect(err).To(MatchError(ContainSubstring("json: unexpected response status 404")))
+		})
+	})
+})
+
+var _ = Describe("Target", func() {
+	Describe("Matches", func() {
+		notification := Notification{Namespace: "payments", ConsoleTemplate: "app"}
+
+		It("matches every console when unfiltered", func() {
+			Expect(Target{}.Matches(notification)).To(BeTrue())
+		})
+
+		It("matches templates by name or namespaced name", func() {
+			Expect(Target{ConsoleTemplates: []string{"app"}}.Matches(notification)).To(BeTrue())
+			Expect(Target{ConsoleTemplates: []string{"payments/app"}}.Matches(notification)).To(BeTrue())
+			Expect(Target{ConsoleTemplates: []string{"banking/app"}}.Matches(notification)).To(BeFalse())
+		})
+
+		It("requires both namespace and template to match when both are set", func() {
+			Expect(Target{Namespaces: []string{"payments"}, ConsoleTemplates: []string{"other"}}.Matches(notification)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("LoadConfig", func() {
+	var (
+		dir     string
+		content string
+		cfg     Config
+		err     error
+	)
+
+	BeforeEach(func() {
+		dir, err = os.MkdirTemp("", "notifier")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(dir, "url"), []byte("https://hooks.example.com/secret\n"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	JustBeforeEach(func() {
+		path := filepath.Join(dir, "config.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		cfg, err = LoadConfig(path)
+	})
+
+	Context("With a valid config", func() {
+		BeforeEach(func() {
+			content = `
+targets:
+  - name: sre
+    format: slack
+    urlFile: ` + filepath.Join(dir, "url") + `
+    namespaces: [payments]
+  - name: audit
+    url: https://audit.example.com/consoles
+`
+		})
+
+		It("resolves URLs and defaults the format", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Targets).To(HaveLen(2))
+			Expect(cfg.Targets[0].URL).To(Equal("https://hooks.example.com/secret"))
+			Expect(cfg.Targets[1].Format).To(Equal(FormatJSON))
+		})
+	})
+
+	Context("With an unsupported format", func() {
+		BeforeEach(func() {
+			content = "targets: [{name: sre, format: email, url: https://example.com}]"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring(`target sre has unsupported format "email"`)))
+		})
+	})
+
+	Context("With a target missing its URL", func() {
+		BeforeEach(func() {
+			content = "targets: [{name: sre}]"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError("target sre must have a url or urlFile"))
+		})
+	})
+
+	Context("With an invalid message", func() {
+		BeforeEach(func() {
+			content = "targets: [{name: sre, url: https://example.com, messages: {Request: '{{ .Console'}}]"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring("target sre has an invalid message for event Request")))
+		})
+	})
+
+	Context("With duplicate target names", func() {
+		BeforeEach(func() {
+			content = "targets: [{name: sre, url: https://example.com}, {name: sre, url: https://example.com}]"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError("target sre is defined more than once"))
+		})
+	})
+})
@@ -107,9 +107,16 @@ func mustCreateConsoleTemplate(consoleTemplate *workloadsv1alpha1.ConsoleTemplat
 
 func mustCreateConsole(console *workloadsv1alpha1.Console) {
 	By("Creating console: " + console.Name)
+	// The status is ignored on creation, so must be written separately
+	status := console.Status
 	Expect(kubeClient.Create(context.TODO(), console)).NotTo(
 		HaveOccurred(), "failed to create console ",
 	)
+
+	console.Status = status
+	Expect(kubeClient.Status().Update(context.TODO(), console)).NotTo(
+		HaveOccurred(), "failed to set console status",
+	)
 }
 
 func mustCreateRoleBinding(roleBinding *rbacv1.RoleBinding) {
@@ -132,7 +139,7 @@ func mustUpdateConsolePhase(in workloadsv1alpha1.Console, phase workloadsv1alpha
 	Expect(err).ToNot(HaveOccurred(), "error while retrieving console")
 
 	csl.Status.Phase = phase
-	err = kubeClient.Update(context.TODO(), csl)
+	err = kubeClient.Status().Update(context.TODO(), csl)
 	Expect(err).ToNot(HaveOccurred(), "error while updating console status")
 }
 
@@ -0,0 +1,244 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/kubectl/pkg/cmd/get"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+// OutputFormat determines how consoles are printed, mirroring the formats
+// supported by kubectl get -o
+type OutputFormat string
+
+const (
+	OutputTable OutputFormat = ""
+	OutputWide  OutputFormat = "wide"
+	OutputJSON  OutputFormat = "json"
+	OutputYAML  OutputFormat = "yaml"
+	OutputName  OutputFormat = "name"
+
+	// OutputJSONPathPrefix is followed by the JSONPath template to print, e.g.
+	// jsonpath={.metadata.name}
+	OutputJSONPathPrefix = "jsonpath="
+
+	// valueNone is printed in tables where a console has no value for a column,
+	// matching kubectl
+	valueNone = "<none>"
+)
+
+// Validate returns an error if the output format is not supported
+func (f OutputFormat) Validate() error {
+	switch f {
+	case OutputTable, OutputWide, OutputJSON, OutputYAML, OutputName:
+		return nil
+	}
+	if strings.HasPrefix(string(f), OutputJSONPathPrefix) {
+		return nil
+	}
+
+	return fmt.Errorf("unsupported output format: %s, expected one of json|yaml|wide|name|jsonpath=...", f)
+}
+
+// printer returns a printer for the structured output formats, or nil for the
+// table formats
+func (f OutputFormat) printer() (printers.ResourcePrinter, error) {
+	switch f {
+	case OutputJSON:
+		return &printers.JSONPrinter{}, nil
+	case OutputYAML:
+		return &printers.YAMLPrinter{}, nil
+	case OutputName:
+		return &printers.NamePrinter{}, nil
+	}
+
+	if strings.HasPrefix(string(f), OutputJSONPathPrefix) {
+		expression, err := get.RelaxedJSONPathExpression(strings.TrimPrefix(string(f), OutputJSONPathPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		printer, err := printers.NewJSONPathPrinter(expression)
+		if err != nil {
+			return nil, err
+		}
+		printer.AllowMissingKeys(true)
+
+		return printer, nil
+	}
+
+	return nil, nil
+}
+
+// PrintOptions configures how consoles are printed
+type PrintOptions struct {
+	Output io.Writer
+	Format OutputFormat
+}
+
+// PrintConsole prints a single console in the given format
+func (c *Runner) PrintConsole(ctx context.Context, csl *workloadsv1alpha1.Console, opts PrintOptions) error {
+	csl = csl.DeepCopy()
+	csl.SetGroupVersionKind(workloadsv1alpha1.GroupVersion.WithKind("Console"))
+
+	return c.print(ctx, ConsoleSlice{*csl}, csl, opts)
+}
+
+// PrintConsoles prints a list of consoles in the given format. Structured
+// formats print a ConsoleList, as kubectl would.
+func (c *Runner) PrintConsoles(ctx context.Context, consoles ConsoleSlice, opts PrintOptions) error {
+	list := &workloadsv1alpha1.ConsoleList{Items: make([]workloadsv1alpha1.Console, len(consoles))}
+	list.SetGroupVersionKind(workloadsv1alpha1.GroupVersion.WithKind("ConsoleList"))
+	for idx, csl := range consoles {
+		list.Items[idx] = *csl.DeepCopy()
+		list.Items[idx].SetGroupVersionKind(workloadsv1alpha1.GroupVersion.WithKind("Console"))
+	}
+
+	return c.print(ctx, list.Items, list, opts)
+}
+
+func (c *Runner) print(ctx context.Context, consoles ConsoleSlice, obj runtime.Object, opts PrintOptions) error {
+	if err := opts.Format.Validate(); err != nil {
+		return err
+	}
+
+	printer, err := opts.Format.printer()
+	if err != nil {
+		return err
+	}
+	if printer != nil {
+		// The name printer only supports lists of unstructured objects, so print
+		// each console in turn instead
+		if opts.Format == OutputName {
+			for idx := range consoles {
+				if err := printer.PrintObj(&consoles[idx], opts.Output); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		return printer.PrintObj(obj, opts.Output)
+	}
+
+	if opts.Format == OutputWide {
+		return c.printWide(ctx, consoles, opts.Output)
+	}
+
+	return consoles.Print(opts.Output)
+}
+
+// printWide prints the default table along with the authorisation progress,
+// expiry time, template and command of each console.
+func (c *Runner) printWide(ctx context.Context, consoles ConsoleSlice, output io.Writer) error {
+	if len(consoles) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNAMESPACE\tPHASE\tCREATED\tUSER\tREASON\tAUTHORISATIONS\tEXPIRY\tTEMPLATE\tCOMMAND")
+
+	for _, csl := range consoles {
+		expiry := valueNone
+		if csl.Status.ExpiryTime != nil {
+			expiry = csl.Status.ExpiryTime.UTC().Format(time.RFC3339)
+		}
+
+		command := valueNone
+		if len(csl.Spec.Command) > 0 {
+			command = strings.Join(csl.Spec.Command, " ")
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			csl.Name,
+			csl.Namespace,
+			orNone(string(csl.Status.Phase)),
+			csl.CreationTimestamp.UTC().Format(time.RFC3339),
+			orNone(csl.Spec.User),
+			orNone(csl.Spec.Reason),
+			c.authorisationProgress(ctx, &csl),
+			expiry,
+			csl.Spec.ConsoleTemplateRef.Name,
+			command,
+		)
+	}
+
+	return w.Flush()
+}
+
+// authorisationProgress returns the number of authorisations given to the
+// console out of the number required, e.g. 1/2. Authorisations that have
+// lapsed are not counted while the console is waiting to start.
+func (c *Runner) authorisationProgress(ctx context.Context, csl *workloadsv1alpha1.Console) string {
+	given, required, err := c.authorisationCounts(ctx, csl)
+	if errors.Is(err, errNoAuthorisationRules) {
+		return valueNone
+	}
+	if err != nil {
+		return "<unknown>"
+	}
+
+	return fmt.Sprintf("%d/%d", given, required)
+}
+
+// errNoAuthorisationRules is returned when the template of a console doesn't
+// require any authorisation
+var errNoAuthorisationRules = errors.New("template has no authorisation rules")
+
+// authorisationCounts returns the number of authorisations given to the
+// console and the number required by the authorisation rule that matches its
+// command.
+func (c *Runner) authorisationCounts(ctx context.Context, csl *workloadsv1alpha1.Console) (int, int, error) {
+	var tpl workloadsv1alpha1.ConsoleTemplate
+	err := c.kubeClient.Get(ctx, client.ObjectKey{Namespace: csl.Namespace, Name: csl.Spec.ConsoleTemplateRef.Name}, &tpl)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !tpl.HasAuthorisationRules() {
+		return 0, 0, errNoAuthorisationRules
+	}
+
+	command := csl.Spec.Command
+	if len(command) == 0 {
+		command, err = tpl.GetDefaultCommandWithArgs()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	rule, err := tpl.GetAuthorisationRuleForCommand(command)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	given := 0
+	var authz workloadsv1alpha1.ConsoleAuthorisation
+	if err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(csl), &authz); err == nil {
+		if csl.PendingJob() {
+			given = len(authz.ValidAuthorisations(tpl.AuthorisationValidity(), time.Now()))
+		} else {
+			given = len(authz.Spec.Authorisations)
+		}
+	}
+
+	return given, rule.AuthorisationsRequired, nil
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return valueNone
+	}
+
+	return value
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+var _ = Describe("Printing consoles", func() {
+	var (
+		ctx      context.Context
+		runner   *Runner
+		consoles ConsoleSlice
+		format   OutputFormat
+		output   *bytes.Buffer
+		err      error
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		output = &bytes.Buffer{}
+		format = OutputTable
+
+		template := &workloadsv1alpha1.ConsoleTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: workloadsv1alpha1.ConsoleTemplateSpec{
+				DefaultAuthorisationRule: &workloadsv1alpha1.ConsoleAuthorisers{
+					AuthorisationsRequired: 2,
+					Subjects:               []rbacv1.Subject{{Kind: "User", Name: "alice@example.com"}},
+				},
+				Template: workloadsv1alpha1.PodTemplatePreserveMetadataSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "app", Command: []string{"bash"}}},
+					},
+				},
+			},
+		}
+		authorisation := &workloadsv1alpha1.ConsoleAuthorisation{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-abc", Namespace: "default"},
+			Spec: workloadsv1alpha1.ConsoleAuthorisationSpec{
+				Authorisations: []workloadsv1alpha1.ConsoleAuthorisationEntry{
+					{Subject: rbacv1.Subject{Kind: "User", Name: "alice@example.com"}},
+				},
+			},
+		}
+
+		consoles = ConsoleSlice{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "app-abc", Namespace: "default"},
+				Spec: workloadsv1alpha1.ConsoleSpec{
+					ConsoleTemplateRef: corev1.LocalObjectReference{Name: "app"},
+					User:               "bob@example.com",
+					Reason:             "debugging",
+					Command:            []string{"rails", "console"},
+				},
+				Status: workloadsv1alpha1.ConsoleStatus{Phase: workloadsv1alpha1.ConsolePendingAuthorisation},
+			},
+		}
+
+		scheme := runtime.NewScheme()
+		Expect(workloadsv1alpha1.AddToScheme(scheme)).To(Succeed())
+		runner = &Runner{
+			kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(template, authorisation).Build(),
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = runner.PrintConsoles(ctx, consoles, PrintOptions{Output: output, Format: format})
+	})
+
+	Context("with the default format", func() {
+		It("prints a table", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("NAME"))
+			Expect(output.String()).To(ContainSubstring("bob@example.com"))
+		})
+	})
+
+	Context("with the wide format", func() {
+		BeforeEach(func() {
+			format = OutputWide
+		})
+
+		It("includes the authorisation progress, template and command", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(lines).To(HaveLen(2))
+			Expect(strings.Fields(lines[0])).To(ContainElements("AUTHORISATIONS", "EXPIRY", "TEMPLATE", "COMMAND"))
+			Expect(lines[1]).To(ContainSubstring("1/2"))
+			Expect(lines[1]).To(ContainSubstring("rails console"))
+		})
+	})
+
+	Context("with the json format", func() {
+		BeforeEach(func() {
+			format = OutputJSON
+		})
+
+		It("prints a console list", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			var list workloadsv1alpha1.ConsoleList
+			Expect(json.Unmarshal(output.Bytes(), &list)).To(Succeed())
+			Expect(list.Kind).To(Equal("ConsoleList"))
+			Expect(list.Items).To(HaveLen(1))
+			Expect(list.Items[0].Spec.User).To(Equal("bob@example.com"))
+		})
+	})
+
+	Context("with the name format", func() {
+		BeforeEach(func() {
+			format = OutputName
+		})
+
+		It("prints the name of each console", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(output.String())).To(Equal("console.workloads.crd.gocardless.com/app-abc"))
+		})
+	})
+
+	Context("with a jsonpath format", func() {
+		BeforeEach(func() {
+			format = "jsonpath={.items[*].spec.user}"
+		})
+
+		It("prints the selected fields", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(Equal("bob@example.com"))
+		})
+	})
+
+	Context("with an unsupported format", func() {
+		BeforeEach(func() {
+			format = "xml"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring("unsupported output format")))
+		})
+	})
+})
@@ -0,0 +1,306 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+// PendingConsole is a console waiting for authorisations that the user is
+// eligible to give
+type PendingConsole struct {
+	workloadsv1alpha1.Console
+
+	// Command the console will run, which is taken from the template if the
+	// console doesn't set one
+	Command []string
+	// Number of valid authorisations given to the console, and the number
+	// required by the authorisation rule matching its command
+	AuthorisationsGiven    int
+	AuthorisationsRequired int
+}
+
+// ApprovalsNeeded describes the authorisations that the console still needs,
+// including any clauses of the authorisation rule that are outstanding.
+func (p PendingConsole) ApprovalsNeeded() string {
+	needed := fmt.Sprintf("%d more", max(p.AuthorisationsRequired-p.AuthorisationsGiven, 0))
+	if p.AuthorisationsRequired == 0 {
+		needed = "<unknown>"
+	}
+
+	clauses := []string{}
+	for _, clause := range p.Status.OutstandingAuthorisations {
+		clauses = append(clauses, fmt.Sprintf("%s (%d of %d)", clause.Name, clause.AuthorisationsGiven, clause.AuthorisationsRequired))
+	}
+	if len(clauses) > 0 {
+		needed = fmt.Sprintf("%s, from %s", needed, strings.Join(clauses, ", "))
+	}
+
+	return needed
+}
+
+type PendingOptions struct {
+	Namespace string
+	// Username of the authoriser, used to exclude consoles they requested or
+	// have already authorised or rejected. If not set, the user is identified
+	// by the Kubernetes API.
+	Username string
+
+	// Prompt to authorise or reject each console in turn, rather than
+	// printing them as a table
+	Interactive bool
+	IO          IOStreams
+}
+
+// Pending finds the consoles that are waiting for an authorisation the user
+// can give, and either prints them or prompts the user to authorise or reject
+// each of them in turn.
+func (c *Runner) Pending(ctx context.Context, opts PendingOptions) ([]PendingConsole, error) {
+	username := opts.Username
+	if username == "" {
+		var err error
+		if username, _, err = c.CurrentUser(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := c.ListPendingAuthorisation(ctx, opts.Namespace, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.Interactive {
+		return pending, PrintPendingConsoles(opts.IO.Out, pending)
+	}
+
+	if len(pending) == 0 {
+		fmt.Fprintln(opts.IO.Out, "No consoles are waiting for your authorisation")
+		return pending, nil
+	}
+
+	return pending, c.reviewPending(ctx, username, pending, opts.IO)
+}
+
+// CurrentUser returns the username and groups that the Kubernetes API
+// authenticates us as
+func (c *Runner) CurrentUser(ctx context.Context) (string, []string, error) {
+	review, err := c.clientset.AuthenticationV1().SelfSubjectReviews().Create(
+		ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{},
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to identify the current user, try setting --user: %w", err)
+	}
+
+	return review.Status.UserInfo.Username, review.Status.UserInfo.Groups, nil
+}
+
+// ListPendingAuthorisation returns the consoles in the namespace, or all
+// namespaces if empty, that are pending authorisation and that we can
+// authorise.
+//
+// The subjects of the matching authorisation rule are bound to a role that
+// grants update on the console's ConsoleAuthorisation, with any directory
+// groups resolved to their members, so we are eligible if the Kubernetes API
+// allows us that update. Consoles that the user requested, or has already
+// authorised or rejected, are excluded.
+func (c *Runner) ListPendingAuthorisation(ctx context.Context, namespace, username string) ([]PendingConsole, error) {
+	var csls workloadsv1alpha1.ConsoleList
+	if err := c.kubeClient.List(ctx, &csls, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list consoles: %w", err)
+	}
+
+	pending := []PendingConsole{}
+	for _, csl := range csls.Items {
+		if !csl.PendingAuthorisation() || csl.Spec.User == username {
+			continue
+		}
+
+		allowed, err := c.canAuthorise(ctx, &csl)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+
+		var authz workloadsv1alpha1.ConsoleAuthorisation
+		if err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(&csl), &authz); err != nil {
+			return nil, fmt.Errorf("failed to get authorisation of console %s/%s: %w", csl.Namespace, csl.Name, err)
+		}
+
+		user := rbacv1.Subject{Kind: rbacv1.UserKind, Name: username}
+		if authz.RejectedBy(user) || slices.ContainsFunc(authz.Spec.Authorisations, func(entry workloadsv1alpha1.ConsoleAuthorisationEntry) bool {
+			return entry.Kind == rbacv1.UserKind && entry.Name == username
+		}) {
+			continue
+		}
+
+		pendingConsole := PendingConsole{Console: csl, Command: csl.Spec.Command}
+		pendingConsole.AuthorisationsGiven, pendingConsole.AuthorisationsRequired, _ = c.authorisationCounts(ctx, &csl)
+
+		if len(pendingConsole.Command) == 0 {
+			var tpl workloadsv1alpha1.ConsoleTemplate
+			if err := c.kubeClient.Get(ctx, client.ObjectKey{Namespace: csl.Namespace, Name: csl.Spec.ConsoleTemplateRef.Name}, &tpl); err == nil {
+				pendingConsole.Command, _ = tpl.GetDefaultCommandWithArgs()
+			}
+		}
+
+		pending = append(pending, pendingConsole)
+	}
+
+	return pending, nil
+}
+
+// canAuthorise returns whether the Kubernetes API allows us to update the
+// console's ConsoleAuthorisation, which is only granted to its authorisers.
+// This doesn't require permission to read the role bindings that grant it.
+func (c *Runner) canAuthorise(ctx context.Context, csl *workloadsv1alpha1.Console) (bool, error) {
+	review, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(
+		ctx,
+		&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: csl.Namespace,
+					Verb:      "update",
+					Group:     workloadsv1alpha1.GroupVersion.Group,
+					Resource:  "consoleauthorisations",
+					Name:      csl.Name,
+				},
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether console %s/%s can be authorised: %w", csl.Namespace, csl.Name, err)
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// PrintPendingConsoles prints a table of consoles waiting for authorisation
+func PrintPendingConsoles(output io.Writer, pending []PendingConsole) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNAMESPACE\tCREATED\tREQUESTER\tREASON\tTEMPLATE\tCOMMAND\tNEEDED")
+
+	for _, p := range pending {
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Name,
+			p.Namespace,
+			p.CreationTimestamp.UTC().Format(time.RFC3339),
+			orNone(p.Spec.User),
+			orNone(p.Spec.Reason),
+			p.Spec.ConsoleTemplateRef.Name,
+			orNone(strings.Join(p.Command, " ")),
+			p.ApprovalsNeeded(),
+		)
+	}
+
+	return w.Flush()
+}
+
+// reviewActions maps the answers accepted when reviewing a console to the
+// action they take. An empty answer skips the console.
+var reviewActions = map[string]string{
+	"a": "authorise", "authorise": "authorise",
+	"r": "reject", "reject": "reject",
+	"s": "skip", "skip": "skip", "": "skip",
+	"q": "quit", "quit": "quit",
+}
+
+// reviewPending prompts the user to authorise, reject or skip each console in
+// turn
+func (c *Runner) reviewPending(ctx context.Context, username string, pending []PendingConsole, streams IOStreams) error {
+	in := bufio.NewReader(streams.In)
+	prompt := func(question string) (string, error) {
+		fmt.Fprint(streams.Out, question)
+		answer, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			return "", err
+		}
+
+		return strings.TrimSpace(answer), nil
+	}
+
+	for idx, p := range pending {
+		fmt.Fprintf(streams.Out, "\n[%d/%d] Console %s/%s\n", idx+1, len(pending), p.Namespace, p.Name)
+		fmt.Fprintf(streams.Out, "  Requester: %s\n", orNone(p.Spec.User))
+		fmt.Fprintf(streams.Out, "  Reason:    %s\n", orNone(p.Spec.Reason))
+		fmt.Fprintf(streams.Out, "  Template:  %s\n", p.Spec.ConsoleTemplateRef.Name)
+		fmt.Fprintf(streams.Out, "  Command:   %s\n", orNone(strings.Join(p.Command, " ")))
+		fmt.Fprintf(streams.Out, "  Needed:    %s\n", p.ApprovalsNeeded())
+
+		action := ""
+		for action == "" {
+			answer, err := prompt("Authorise, reject, skip or quit? [a/r/s/q]: ")
+			if err != nil {
+				return err
+			}
+			action = reviewActions[strings.ToLower(answer)]
+		}
+
+		switch action {
+		case "authorise":
+			comment, err := prompt("Comment (optional): ")
+			if err != nil {
+				return err
+			}
+
+			err = c.Authorise(ctx, AuthoriseOptions{
+				Namespace:   p.Namespace,
+				ConsoleName: p.Name,
+				Username:    username,
+				Comment:     comment,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to authorise console %s/%s: %w", p.Namespace, p.Name, err)
+			}
+			fmt.Fprintf(streams.Out, "Authorised console %s/%s\n", p.Namespace, p.Name)
+
+		case "reject":
+			reason := ""
+			for reason == "" {
+				var err error
+				if reason, err = prompt("Reason: "); err != nil {
+					return err
+				}
+			}
+
+			err := c.Reject(ctx, RejectOptions{
+				Namespace:   p.Namespace,
+				ConsoleName: p.Name,
+				Username:    username,
+				Reason:      reason,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to reject console %s/%s: %w", p.Namespace, p.Name, err)
+			}
+			fmt.Fprintf(streams.Out, "Rejected console %s/%s\n", p.Namespace, p.Name)
+
+		case "skip":
+			continue
+
+		case "quit":
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
+)
+
+var _ = Describe("Pending", func() {
+	var (
+		ctx     context.Context
+		runner  *Runner
+		objects []client.Object
+		// Consoles, as namespace/name, whose authorisation we may update
+		authorisable []string
+		// Namespaces in which we can't review our access
+		forbidden []string
+		opts      PendingOptions
+		output    *bytes.Buffer
+		pending   []PendingConsole
+		err       error
+	)
+
+	newConsole := func(name, user string, phase workloadsv1alpha1.ConsolePhase) *workloadsv1alpha1.Console {
+		return &workloadsv1alpha1.Console{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: workloadsv1alpha1.ConsoleSpec{
+				ConsoleTemplateRef: corev1.LocalObjectReference{Name: "app"},
+				User:               user,
+				Reason:             "debugging",
+			},
+			Status: workloadsv1alpha1.ConsoleStatus{Phase: phase},
+		}
+	}
+
+	newAuthorisation := func(name string, authorisers ...string) *workloadsv1alpha1.ConsoleAuthorisation {
+		authz := &workloadsv1alpha1.ConsoleAuthorisation{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: workloadsv1alpha1.ConsoleAuthorisationSpec{
+				Authorisations: []workloadsv1alpha1.ConsoleAuthorisationEntry{},
+			},
+		}
+		for _, authoriser := range authorisers {
+			authz.Spec.Authorisations = append(authz.Spec.Authorisations, workloadsv1alpha1.ConsoleAuthorisationEntry{
+				Subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: authoriser},
+			})
+		}
+
+		return authz
+	}
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		authorisable = []string{}
+		forbidden = []string{}
+		output = &bytes.Buffer{}
+		opts = PendingOptions{
+			Username: "alice@example.com",
+			IO:       IOStreams{Out: output},
+		}
+
+		objects = []client.Object{
+			&workloadsv1alpha1.ConsoleTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: workloadsv1alpha1.ConsoleTemplateSpec{
+					DefaultAuthorisationRule: &workloadsv1alpha1.ConsoleAuthorisers{
+						AuthorisationsRequired: 2,
+						Subjects:               []rbacv1.Subject{{Kind: "GoogleGroup", Name: "sre@example.com"}},
+					},
+					Template: workloadsv1alpha1.PodTemplatePreserveMetadataSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "app", Command: []string{"bash"}}},
+						},
+					},
+				},
+			},
+			newConsole("app-abc", "bob@example.com", workloadsv1alpha1.ConsolePendingAuthorisation),
+			newAuthorisation("app-abc", "carol@example.com"),
+		}
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(workloadsv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		// Allow updates to the authorisations of authorisable consoles
+		clientset := kubefake.NewSimpleClientset()
+		clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+			attrs := review.Spec.ResourceAttributes
+			if slices.Contains(forbidden, attrs.Namespace) {
+				return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "authorization.k8s.io", Resource: "selfsubjectaccessreviews"}, "", nil)
+			}
+
+			review.Status.Allowed = attrs.Verb == "update" && attrs.Resource == "consoleauthorisations" &&
+				slices.Contains(authorisable, attrs.Namespace+"/"+attrs.Name)
+
+			return true, review, nil
+		})
+
+		runner = &Runner{
+			kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+			clientset:  clientset,
+		}
+		pending, err = runner.Pending(ctx, opts)
+	})
+
+	Context("When the user can authorise the console", func() {
+		BeforeEach(func() {
+			authorisable = []string{"default/app-abc"}
+		})
+
+		It("lists the console with the approvals it still needs", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pending).To(HaveLen(1))
+			Expect(pending[0].Name).To(Equal("app-abc"))
+			Expect(pending[0].Command).To(Equal([]string{"bash"}))
+			Expect(pending[0].AuthorisationsGiven).To(Equal(1))
+			Expect(pending[0].AuthorisationsRequired).To(Equal(2))
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(lines).To(HaveLen(2))
+			Expect(strings.Fields(lines[0])).To(Equal([]string{
+				"NAME", "NAMESPACE", "CREATED", "REQUESTER", "REASON", "TEMPLATE", "COMMAND", "NEEDED",
+			}))
+			Expect(lines[1]).To(ContainSubstring("bob@example.com"))
+			Expect(lines[1]).To(HaveSuffix("1 more"))
+		})
+
+		Context("and the console has outstanding clauses", func() {
+			BeforeEach(func() {
+				objects[1].(*workloadsv1alpha1.Console).Status.OutstandingAuthorisations = []workloadsv1alpha1.ConsoleOutstandingAuthorisation{
+					{Name: "sre", AuthorisationsRequired: 1, AuthorisationsGiven: 0},
+				}
+			})
+
+			It("shows which clauses are outstanding", func() {
+				Expect(pending).To(HaveLen(1))
+				Expect(pending[0].ApprovalsNeeded()).To(Equal("1 more, from sre (0 of 1)"))
+			})
+		})
+
+		Context("and the console isn't pending authorisation", func() {
+			BeforeEach(func() {
+				objects[1].(*workloadsv1alpha1.Console).Status.Phase = workloadsv1alpha1.ConsoleRunning
+			})
+
+			It("doesn't list it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pending).To(BeEmpty())
+			})
+		})
+
+		Context("and the user has already authorised the console", func() {
+			BeforeEach(func() {
+				objects[2] = newAuthorisation("app-abc", "alice@example.com")
+			})
+
+			It("doesn't list it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pending).To(BeEmpty())
+			})
+		})
+
+		Context("and the user requested the console", func() {
+			BeforeEach(func() {
+				objects[1].(*workloadsv1alpha1.Console).Spec.User = "alice@example.com"
+			})
+
+			It("doesn't list it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pending).To(BeEmpty())
+			})
+		})
+
+		Context("When reviewing interactively", func() {
+			BeforeEach(func() {
+				opts.Interactive = true
+			})
+
+			Context("and the user authorises the console", func() {
+				BeforeEach(func() {
+					opts.IO.In = strings.NewReader("a\nlooks good\n")
+				})
+
+				It("records the authorisation", func() {
+					Expect(err).NotTo(HaveOccurred())
+
+					var authz workloadsv1alpha1.ConsoleAuthorisation
+					Expect(runner.kubeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-abc"}, &authz)).To(Succeed())
+					Expect(authz.Spec.Authorisations).To(HaveLen(2))
+					Expect(authz.Spec.Authorisations[1].Name).To(Equal("alice@example.com"))
+					Expect(authz.Spec.Authorisations[1].Comment).To(Equal("looks good"))
+					Expect(output.String()).To(ContainSubstring("Authorised console default/app-abc"))
+				})
+			})
+
+			Context("and the user rejects the console", func() {
+				BeforeEach(func() {
+					opts.IO.In = strings.NewReader("r\n\nnot needed\n")
+				})
+
+				It("asks for a reason and records the rejection", func() {
+					Expect(err).NotTo(HaveOccurred())
+
+					var authz workloadsv1alpha1.ConsoleAuthorisation
+					Expect(runner.kubeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-abc"}, &authz)).To(Succeed())
+					Expect(authz.Spec.Rejections).To(HaveLen(1))
+					Expect(authz.Spec.Rejections[0].Name).To(Equal("alice@example.com"))
+					Expect(authz.Spec.Rejections[0].Reason).To(Equal("not needed"))
+				})
+			})
+
+			Context("and the user skips the console", func() {
+				BeforeEach(func() {
+					opts.IO.In = strings.NewReader("s\n")
+				})
+
+				It("leaves the authorisation unchanged", func() {
+					Expect(err).NotTo(HaveOccurred())
+
+					var authz workloadsv1alpha1.ConsoleAuthorisation
+					Expect(runner.kubeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-abc"}, &authz)).To(Succeed())
+					Expect(authz.Spec.Authorisations).To(HaveLen(1))
+					Expect(authz.Spec.Rejections).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Context("When the user can't review their access in some namespaces", func() {
+		BeforeEach(func() {
+			restricted := newConsole("app-def", "bob@example.com", workloadsv1alpha1.ConsolePendingAuthorisation)
+			restricted.Namespace = "restricted"
+
+			objects = append(objects, restricted)
+			authorisable = []string{"default/app-abc"}
+			forbidden = []string{"restricted"}
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError(ContainSubstring("failed to check whether console restricted/app-def can be authorised")))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		})
+	})
+
+	Context("When the user isn't an authoriser", func() {
+		It("doesn't list the console", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pending).To(BeEmpty())
+			Expect(output.String()).To(BeEmpty())
+		})
+	})
+})
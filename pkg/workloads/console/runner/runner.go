@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -98,6 +99,8 @@ type LifecycleHook interface {
 	AttachingToConsole(*workloadsv1alpha1.Console) error
 	ConsoleCreated(*workloadsv1alpha1.Console) error
 	ConsoleRequiresAuthorisation(*workloadsv1alpha1.Console, *workloadsv1alpha1.ConsoleAuthorisationRule) error
+	ConsoleQueued(*workloadsv1alpha1.Console) error
+	ConsoleWaiting(*workloadsv1alpha1.Console, metav1.Condition) error
 	ConsoleReady(*workloadsv1alpha1.Console) error
 	TemplateFound(*workloadsv1alpha1.ConsoleTemplate) error
 }
@@ -108,6 +111,8 @@ type DefaultLifecycleHook struct {
 	AttachingToPodFunc               func(*workloadsv1alpha1.Console) error
 	ConsoleCreatedFunc               func(*workloadsv1alpha1.Console) error
 	ConsoleRequiresAuthorisationFunc func(*workloadsv1alpha1.Console, *workloadsv1alpha1.ConsoleAuthorisationRule) error
+	ConsoleQueuedFunc                func(*workloadsv1alpha1.Console) error
+	ConsoleWaitingFunc               func(*workloadsv1alpha1.Console, metav1.Condition) error
 	ConsoleReadyFunc                 func(*workloadsv1alpha1.Console) error
 	TemplateFoundFunc                func(*workloadsv1alpha1.ConsoleTemplate) error
 }
@@ -133,6 +138,20 @@ func (d DefaultLifecycleHook) ConsoleRequiresAuthorisation(c *workloadsv1alpha1.
 	return nil
 }
 
+func (d DefaultLifecycleHook) ConsoleQueued(c *workloadsv1alpha1.Console) error {
+	if d.ConsoleQueuedFunc != nil {
+		return d.ConsoleQueuedFunc(c)
+	}
+	return nil
+}
+
+func (d DefaultLifecycleHook) ConsoleWaiting(c *workloadsv1alpha1.Console, condition metav1.Condition) error {
+	if d.ConsoleWaitingFunc != nil {
+		return d.ConsoleWaitingFunc(c, condition)
+	}
+	return nil
+}
+
 func (d DefaultLifecycleHook) ConsoleReady(c *workloadsv1alpha1.Console) error {
 	if d.ConsoleReadyFunc != nil {
 		return d.ConsoleReadyFunc(c)
@@ -215,7 +234,7 @@ func (c *Runner) Create(ctx context.Context, opts CreateOptions) (*workloadsv1al
 	}
 
 	// Wait for authorisation step or until ready
-	_, err = c.WaitUntilReady(ctx, *csl, false)
+	_, err = c.waitUntilReady(ctx, *csl, false, opts.Hook)
 	if err == errConsolePendingAuthorisation {
 		rule, err := tpl.GetAuthorisationRuleForCommand(opts.Command)
 		if err != nil {
@@ -226,8 +245,9 @@ func (c *Runner) Create(ctx context.Context, opts CreateOptions) (*workloadsv1al
 		return nil, err
 	}
 
-	// Wait for the console to enter a ready state
-	csl, err = c.WaitUntilReady(ctx, *csl, true)
+	// Wait for the console to enter a ready state, reporting if it is queued
+	// behind other consoles along the way
+	csl, err = c.waitUntilReady(ctx, *csl, true, opts.Hook)
 	if err != nil {
 		return nil, err
 	}
@@ -288,15 +308,45 @@ func checkPodState(pod *corev1.Pod) (bool, error) {
 	case corev1.PodSucceeded:
 		return true, nil
 	default:
+		if terminated := workloadsv1alpha1.ConsoleContainerTerminated(pod); terminated != nil && terminated.ExitCode != 0 {
+			return true, ConsoleExitError{ExitCode: terminated.ExitCode, Reason: terminated.Reason}
+		}
 		return true, fmt.Errorf("pod in unexpected state %s: %s", pod.Status.Phase, pod.Status.Message)
 	}
 }
 
+// ConsoleExitError is returned when the console container exits with a non-zero
+// exit code, allowing callers to exit with the same code.
+type ConsoleExitError struct {
+	ExitCode int32
+	Reason   string
+}
+
+func (e ConsoleExitError) Error() string {
+	return fmt.Sprintf("console exited with code %d: %s", e.ExitCode, e.Reason)
+}
+
+// exitErrorFromStatus returns a ConsoleExitError if the status of the console
+// records that its container exited unsuccessfully. This is used once the pod
+// has gone, and we can no longer inspect it directly.
+func (c *Runner) exitErrorFromStatus(ctx context.Context, csl *workloadsv1alpha1.Console) error {
+	var latest workloadsv1alpha1.Console
+	if err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(csl), &latest); err != nil {
+		return nil
+	}
+
+	if latest.Status.ExitCode != nil && *latest.Status.ExitCode != 0 {
+		return ConsoleExitError{ExitCode: *latest.Status.ExitCode, Reason: latest.Status.TerminationReason}
+	}
+
+	return nil
+}
+
 func (c *Runner) waitForSuccess(ctx context.Context, csl *workloadsv1alpha1.Console) error {
 	pod, _, err := c.GetAttachablePod(ctx, csl)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
-			return nil
+			return c.exitErrorFromStatus(ctx, csl)
 		}
 		return fmt.Errorf("retrieving pod: %w", err)
 	}
@@ -310,7 +360,8 @@ func (c *Runner) waitForSuccess(ctx context.Context, csl *workloadsv1alpha1.Cons
 	precondition := func(store cache.Store) (bool, error) {
 		items := store.List()
 		if len(items) == 0 {
-			return true, nil // pod gone, treat as success
+			// pod gone, so rely on the exit code recorded by the controller
+			return true, c.exitErrorFromStatus(ctx, csl)
 		}
 		return checkPodState(items[0].(*corev1.Pod))
 	}
@@ -444,6 +495,75 @@ func (c *Runner) extractLogs(ctx context.Context, csl *workloadsv1alpha1.Console
 	return c.waitForSuccess(ctx, csl)
 }
 
+// LogsOptions encapsulates the arguments to print the logs of a console
+type LogsOptions struct {
+	Namespace string
+	Name      string
+
+	// Container to print the logs of. If not set, this is the container that
+	// the console would be attached to.
+	Container string
+	// Follow the logs until the console's pod terminates
+	Follow bool
+	// Only print logs newer than this duration, if set
+	Since time.Duration
+
+	IO IOStreams
+}
+
+// Logs prints the logs of a console's pod. This works for consoles that have
+// stopped, until their pod is removed by garbage collection.
+func (c *Runner) Logs(ctx context.Context, opts LogsOptions) error {
+	csl, err := c.FindConsoleByName(opts.Namespace, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if csl.Status.PodName == "" {
+		return fmt.Errorf("console %s has no pod to print the logs of, it is in phase: %s", csl.Name, csl.Status.Phase)
+	}
+
+	pod, containerName, err := c.GetAttachablePod(ctx, csl)
+	if err != nil {
+		return fmt.Errorf("could not find pod to print the logs of: %w", err)
+	}
+
+	if opts.Container != "" {
+		if !hasContainer(pod, opts.Container) {
+			return fmt.Errorf("container %s not found in pod %s", opts.Container, pod.Name)
+		}
+		containerName = opts.Container
+	}
+
+	logOpts := &corev1.PodLogOptions{
+		Container: containerName,
+		Follow:    opts.Follow,
+	}
+	if opts.Since > 0 {
+		sinceSeconds := int64(opts.Since.Seconds())
+		logOpts.SinceSeconds = &sinceSeconds
+	}
+
+	logs, err := c.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOpts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	_, err = io.Copy(opts.IO.Out, logs)
+	return err
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		if container.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func newInteractiveAttacher(clientset kubernetes.Interface, restconfig *rest.Config) Attacher {
 	return &interactiveAttacher{clientset, restconfig}
 }
@@ -567,8 +687,13 @@ type AuthoriseOptions struct {
 	Namespace   string
 	ConsoleName string
 	Username    string
+	Comment     string
 	Attach      bool
 
+	// Authorise the latest timeout extension requested for the console, rather
+	// than the console itself
+	TimeoutExtension bool
+
 	// Options only used when Attach is true
 	KubeConfig *rest.Config
 	IO         IOStreams
@@ -591,25 +716,14 @@ func (c *Runner) Authorise(ctx context.Context, opts AuthoriseOptions) error {
 	// Get options with any unset values defaulted
 	opts = opts.WithDefaults()
 
-	patch := []jsonpatch.Operation{
-		jsonpatch.NewOperation(
-			"add",
-			"/spec/authorisations/-",
-			rbacv1.Subject{
-				Kind:      rbacv1.UserKind,
-				Namespace: opts.Namespace,
-				Name:      opts.Username,
-			},
-		),
-	}
-
-	patchBytes, err := json.Marshal(patch)
-	if err != nil {
-		return err
+	subject := rbacv1.Subject{
+		Kind:      rbacv1.UserKind,
+		Namespace: opts.Namespace,
+		Name:      opts.Username,
 	}
 
 	var authz workloadsv1alpha1.ConsoleAuthorisation
-	err = c.kubeClient.Get(
+	err := c.kubeClient.Get(
 		ctx,
 		client.ObjectKey{
 			Name:      opts.ConsoleName,
@@ -621,6 +735,49 @@ func (c *Runner) Authorise(ctx context.Context, opts AuthoriseOptions) error {
 		return err
 	}
 
+	patch := []jsonpatch.Operation{
+		jsonpatch.NewOperation(
+			"add",
+			"/spec/authorisations/-",
+			workloadsv1alpha1.ConsoleAuthorisationEntry{
+				Subject: subject,
+				Comment: opts.Comment,
+			},
+		),
+	}
+
+	if opts.TimeoutExtension {
+		csl, err := c.Get(ctx, GetOptions{
+			Namespace:   opts.Namespace,
+			ConsoleName: opts.ConsoleName,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(csl.Spec.TimeoutExtensions) == 0 {
+			return fmt.Errorf("console %s has no timeout extensions to authorise", opts.ConsoleName)
+		}
+
+		extensionAuthorisation := workloadsv1alpha1.ConsoleTimeoutExtensionAuthorisation{
+			TimeoutExtension: len(csl.Spec.TimeoutExtensions) - 1,
+			Subject:          subject,
+		}
+
+		patch = []jsonpatch.Operation{
+			appendOperation(
+				"/spec/timeoutExtensionAuthorisations",
+				len(authz.Spec.TimeoutExtensionAuthorisations),
+				extensionAuthorisation,
+			),
+		}
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
 	err = c.kubeClient.Patch(ctx, &authz, client.RawPatch(types.JSONPatchType, patchBytes))
 	if err != nil {
 		return err
@@ -658,22 +815,135 @@ func (c *Runner) Authorise(ctx context.Context, opts AuthoriseOptions) error {
 	return nil
 }
 
+type RejectOptions struct {
+	Namespace   string
+	ConsoleName string
+	Username    string
+	Reason      string
+}
+
+// Reject rejects a console that is pending authorisation, preventing it from
+// running.
+func (c *Runner) Reject(ctx context.Context, opts RejectOptions) error {
+	if opts.Reason == "" {
+		return errors.New("a reason must be given when rejecting a console")
+	}
+
+	var authz workloadsv1alpha1.ConsoleAuthorisation
+	err := c.kubeClient.Get(
+		ctx,
+		client.ObjectKey{
+			Name:      opts.ConsoleName,
+			Namespace: opts.Namespace,
+		},
+		&authz,
+	)
+	if err != nil {
+		return err
+	}
+
+	rejection := workloadsv1alpha1.ConsoleRejection{
+		Subject: rbacv1.Subject{
+			Kind:      rbacv1.UserKind,
+			Namespace: opts.Namespace,
+			Name:      opts.Username,
+		},
+		Reason: opts.Reason,
+	}
+
+	patch := []jsonpatch.Operation{
+		appendOperation("/spec/rejections", len(authz.Spec.Rejections), rejection),
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	return c.kubeClient.Patch(ctx, &authz, client.RawPatch(types.JSONPatchType, patchBytes))
+}
+
+type ExtendOptions struct {
+	Namespace   string
+	ConsoleName string
+	By          time.Duration
+	Reason      string
+}
+
+// Extend requests an extension to the timeout of a console. Depending on the
+// console template, the extension may need to be authorised before it takes
+// effect.
+func (c *Runner) Extend(ctx context.Context, opts ExtendOptions) (*workloadsv1alpha1.Console, error) {
+	if opts.By < time.Second {
+		return nil, fmt.Errorf("console timeout extension must be at least 1s, got %s", opts.By)
+	}
+
+	csl, err := c.Get(ctx, GetOptions{
+		Namespace:   opts.Namespace,
+		ConsoleName: opts.ConsoleName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if csl.PostRunning() {
+		return nil, fmt.Errorf("console %s has already finished", opts.ConsoleName)
+	}
+
+	extension := workloadsv1alpha1.ConsoleTimeoutExtension{
+		Seconds: int(opts.By.Seconds()),
+		Reason:  opts.Reason,
+	}
+
+	patch := []jsonpatch.Operation{
+		appendOperation("/spec/timeoutExtensions", len(csl.Spec.TimeoutExtensions), extension),
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.kubeClient.Patch(ctx, csl, client.RawPatch(types.JSONPatchType, patchBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return csl, nil
+}
+
+// appendOperation builds a JSON patch operation that appends value to the list
+// at path. Lists that are omitted when empty don't exist in the object, so in
+// that case the list itself must be added rather than appended to.
+func appendOperation(path string, length int, value interface{}) jsonpatch.Operation {
+	if length == 0 {
+		return jsonpatch.NewOperation("add", path, []interface{}{value})
+	}
+
+	return jsonpatch.NewOperation("add", path+"/-", value)
+}
+
 type ListOptions struct {
 	Namespace string
 	Username  string
 	Selector  string
 	Output    io.Writer
+	Format    OutputFormat
 }
 
 // List is a wrapper around ListConsolesByLabelsAndUser that will output to a specified output.
 // This functionality is intended to be used in a CLI setting, where you are usually outputting to os.Stdout.
 func (c *Runner) List(ctx context.Context, opts ListOptions) (ConsoleSlice, error) {
+	if err := opts.Format.Validate(); err != nil {
+		return nil, err
+	}
+
 	consoles, err := c.ListConsolesByLabelsAndUser(opts.Namespace, opts.Username, opts.Selector)
 	if err != nil {
 		return nil, err
 	}
 
-	return consoles, consoles.Print(opts.Output)
+	return consoles, c.PrintConsoles(ctx, consoles, PrintOptions{Output: opts.Output, Format: opts.Format})
 }
 
 // CreateResource builds a console according to the supplied options and submits it to the API
@@ -845,7 +1115,14 @@ func (c *Runner) ListConsolesByLabelsAndUser(namespace, username, labelSelector
 // console user in its subject list. This RoleBinding gives the console user
 // permission to attach to the pod.
 func (c *Runner) WaitUntilReady(ctx context.Context, createdCsl workloadsv1alpha1.Console, waitForAuthorisation bool) (*workloadsv1alpha1.Console, error) {
-	csl, err := c.waitForConsole(ctx, createdCsl, waitForAuthorisation)
+	return c.waitUntilReady(ctx, createdCsl, waitForAuthorisation, DefaultLifecycleHook{})
+}
+
+func (c *Runner) waitUntilReady(ctx context.Context, createdCsl workloadsv1alpha1.Console, waitForAuthorisation bool, hook LifecycleHook) (*workloadsv1alpha1.Console, error) {
+	csl, err := c.waitForConsole(ctx, createdCsl, waitForAuthorisation, hook)
+	if errors.Is(err, errConsoleRejected) {
+		return nil, c.rejectionError(ctx, createdCsl)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -857,11 +1134,50 @@ func (c *Runner) WaitUntilReady(ctx context.Context, createdCsl workloadsv1alpha
 	return csl, nil
 }
 
-var errConsolePendingAuthorisation = errors.New("console pending authorisation")
+// rejectionError returns an error describing who rejected the console and why.
+func (c *Runner) rejectionError(ctx context.Context, csl workloadsv1alpha1.Console) error {
+	var authz workloadsv1alpha1.ConsoleAuthorisation
+	err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(&csl), &authz)
+	if err != nil || len(authz.Spec.Rejections) == 0 {
+		return errConsoleRejected
+	}
+
+	reasons := make([]string, 0, len(authz.Spec.Rejections))
+	for _, rejection := range authz.Spec.Rejections {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", rejection.Name, rejection.Reason))
+	}
+
+	return fmt.Errorf("%w by %s", errConsoleRejected, strings.Join(reasons, ", "))
+}
+
+var (
+	errConsolePendingAuthorisation = errors.New("console pending authorisation")
+	errConsoleRejected             = errors.New("console rejected")
+	errConsoleCannotStart          = errors.New("console cannot start")
+)
+
+// fatalConditionReasons are the reasons for a console condition not being
+// satisfied that mean the console will never start without intervention, so
+// there is no point in waiting for it. ErrImagePull and ImagePullBackOff are
+// deliberately excluded, as the kubelet reports them for every failed pull,
+// which is often caused by transient registry errors or rate limits, as is
+// CreateContainerConfigError, which the kubelet keeps retrying and reports
+// while a Secret or ConfigMap the container refers to doesn't exist yet.
+var fatalConditionReasons = map[string]bool{
+	workloadsv1alpha1.ReasonTemplateNotFound:    true,
+	workloadsv1alpha1.ReasonNoMatchingRule:      true,
+	workloadsv1alpha1.ReasonUnresolvableSubject: true,
+	"ErrImageNeverPull":                         true,
+	"InvalidImageName":                          true,
+}
 
 // checkConsoleState returns (true, nil) when the console has reached a terminal
 // success state, (false, nil) to continue watching, or (true, err) on failure.
 func checkConsoleState(csl *workloadsv1alpha1.Console, waitForAuthorisation bool) (bool, error) {
+	if condition := csl.Status.FailingCondition(); condition != nil && fatalConditionReasons[condition.Reason] {
+		return true, fmt.Errorf("%w: %s", errConsoleCannotStart, condition.Message)
+	}
+
 	switch csl.Status.Phase {
 	case workloadsv1alpha1.ConsoleRunning:
 		return true, nil
@@ -870,6 +1186,8 @@ func checkConsoleState(csl *workloadsv1alpha1.Console, waitForAuthorisation bool
 			return true, errConsolePendingAuthorisation
 		}
 		return false, nil
+	case workloadsv1alpha1.ConsoleRejected:
+		return true, errConsoleRejected
 	// If the console has already stopped it may have already run to
 	// completion, so let's return it
 	case workloadsv1alpha1.ConsoleStopped:
@@ -879,13 +1197,45 @@ func checkConsoleState(csl *workloadsv1alpha1.Console, waitForAuthorisation bool
 	}
 }
 
-func (c *Runner) waitForConsole(ctx context.Context, createdCsl workloadsv1alpha1.Console, waitForAuthorisation bool) (*workloadsv1alpha1.Console, error) {
+// notifyWaiting calls the lifecycle hook for the stage that the console is
+// waiting on, if any. Consoles pending authorisation are reported separately.
+func notifyWaiting(csl *workloadsv1alpha1.Console, hook LifecycleHook) error {
+	condition := csl.Status.FailingCondition()
+	switch {
+	case csl.Queued():
+		return hook.ConsoleQueued(csl)
+	case csl.Pending() && condition != nil:
+		return hook.ConsoleWaiting(csl, *condition)
+	}
+
+	return nil
+}
+
+func (c *Runner) waitForConsole(ctx context.Context, createdCsl workloadsv1alpha1.Console, waitForAuthorisation bool, hook LifecycleHook) (*workloadsv1alpha1.Console, error) {
 	fieldSelector := fields.OneTermEqualSelector("metadata.name", createdCsl.Name).String()
 	namespacedCslClient := c.consoleClient.Namespace(createdCsl.Namespace)
 	lw := getListWatch(ctx, namespacedCslClient, fieldSelector)
 
 	var resultCsl *workloadsv1alpha1.Console
 
+	// Notify the hook each time the reason for the console not having started
+	// changes, so that the user can see what it is waiting on
+	var message string
+	checkState := func(csl *workloadsv1alpha1.Console) (bool, error) {
+		if csl.Status.Message != message {
+			message = csl.Status.Message
+			if err := notifyWaiting(csl, hook); err != nil {
+				return true, err
+			}
+		}
+
+		done, err := checkConsoleState(csl, waitForAuthorisation)
+		if done {
+			resultCsl = csl
+		}
+		return done, err
+	}
+
 	// Precondition checks the current state from the informer's cache
 	// before processing any watch events
 	precondition := func(store cache.Store) (bool, error) {
@@ -900,11 +1250,7 @@ func (c *Runner) waitForConsole(ctx context.Context, createdCsl workloadsv1alpha
 		); err != nil {
 			return false, err
 		}
-		done, err := checkConsoleState(csl, waitForAuthorisation)
-		if done {
-			resultCsl = csl
-		}
-		return done, err
+		return checkState(csl)
 	}
 
 	// Condition processes each watch event
@@ -919,11 +1265,7 @@ func (c *Runner) waitForConsole(ctx context.Context, createdCsl workloadsv1alpha
 		); err != nil {
 			return false, err
 		}
-		done, err := checkConsoleState(csl, waitForAuthorisation)
-		if done {
-			resultCsl = csl
-		}
-		return done, err
+		return checkState(csl)
 	}
 
 	_, err := watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, precondition, condition)
@@ -1,10 +1,18 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	workloadsv1alpha1 "github.com/gocardless/theatre/v5/api/workloads/v1alpha1"
 )
@@ -64,6 +72,31 @@ var _ = Describe("checkPodState", func() {
 			Expect(err.Error()).To(ContainSubstring("Failed"))
 			Expect(err.Error()).To(ContainSubstring("OOMKilled"))
 		})
+
+		Context("and the console container exited unsuccessfully", func() {
+			BeforeEach(func() {
+				pod.Spec.Containers = []corev1.Container{{Name: "app"}, {Name: "sidecar"}}
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+					{
+						Name: "sidecar",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"},
+						},
+					},
+					{
+						Name: "app",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 3, Reason: "Error"},
+						},
+					},
+				}
+			})
+
+			It("Returns done with the exit code of the console container", func() {
+				Expect(done).To(BeTrue())
+				Expect(err).To(Equal(ConsoleExitError{ExitCode: 3, Reason: "Error"}))
+			})
+		})
 	})
 })
 
@@ -126,6 +159,91 @@ var _ = Describe("checkConsoleState", func() {
 		AssertNotDone()
 	})
 
+	When("console is Rejected", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsoleRejected
+		})
+
+		It("Returns done with errConsoleRejected", func() {
+			Expect(done).To(BeTrue())
+			Expect(err).To(MatchError(errConsoleRejected))
+		})
+	})
+
+	When("console has a condition that will prevent it from starting", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsolePending
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsoleTemplateResolvedCondition, Status: metav1.ConditionTrue, Reason: workloadsv1alpha1.ReasonTemplateFound},
+				{Type: workloadsv1alpha1.ConsoleReadyCondition, Status: metav1.ConditionFalse, Reason: "InvalidImageName", Message: "Failed to apply default image tag"},
+			}
+		})
+
+		It("Returns done with the message of the condition", func() {
+			Expect(done).To(BeTrue())
+			Expect(err).To(MatchError(errConsoleCannotStart))
+			Expect(err).To(MatchError(ContainSubstring("Failed to apply default image tag")))
+		})
+	})
+
+	When("console's rule names subjects the manager can't resolve", func() {
+		BeforeEach(func() {
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsoleAuthorisedCondition, Status: metav1.ConditionFalse, Reason: workloadsv1alpha1.ReasonUnresolvableSubject, Message: "has a clause naming OktaGroup leads"},
+			}
+		})
+
+		It("Returns done with the message of the condition", func() {
+			Expect(done).To(BeTrue())
+			Expect(err).To(MatchError(errConsoleCannotStart))
+			Expect(err).To(MatchError(ContainSubstring("has a clause naming OktaGroup leads")))
+		})
+	})
+
+	When("console is backing off pulling its image", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsolePending
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsoleReadyCondition, Status: metav1.ConditionFalse, Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+			}
+		})
+
+		AssertNotDone()
+	})
+
+	When("console has failed to pull its image", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsolePending
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsoleReadyCondition, Status: metav1.ConditionFalse, Reason: "ErrImagePull", Message: "failed to pull image: 503 Service Unavailable"},
+			}
+		})
+
+		AssertNotDone()
+	})
+
+	When("console is waiting for the config of its container", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsolePending
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsoleReadyCondition, Status: metav1.ConditionFalse, Reason: "CreateContainerConfigError", Message: `secret "app-credentials" not found`},
+			}
+		})
+
+		AssertNotDone()
+	})
+
+	When("console has a condition that is not yet satisfied", func() {
+		BeforeEach(func() {
+			csl.Status.Phase = workloadsv1alpha1.ConsolePending
+			csl.Status.Conditions = []metav1.Condition{
+				{Type: workloadsv1alpha1.ConsolePodScheduledCondition, Status: metav1.ConditionFalse, Reason: "Unschedulable"},
+			}
+		})
+
+		AssertNotDone()
+	})
+
 	Describe("Pending Authorisation", func() {
 		BeforeEach(func() {
 			csl.Status.Phase = workloadsv1alpha1.ConsolePendingAuthorisation
@@ -182,3 +300,74 @@ var _ = Describe("rbHasSubject", func() {
 		})
 	})
 })
+
+var _ = Describe("Logs", func() {
+	var (
+		runner *Runner
+		csl    *workloadsv1alpha1.Console
+		pod    *corev1.Pod
+		opts   LogsOptions
+		output *bytes.Buffer
+		err    error
+	)
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		csl = &workloadsv1alpha1.Console{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-abc", Namespace: "default"},
+			Spec:       workloadsv1alpha1.ConsoleSpec{Noninteractive: true},
+			Status: workloadsv1alpha1.ConsoleStatus{
+				Phase:   workloadsv1alpha1.ConsoleStopped,
+				PodName: "app-abc-pod",
+			},
+		}
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-abc-pod", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+			},
+		}
+		opts = LogsOptions{
+			Namespace: "default",
+			Name:      "app-abc",
+			IO:        IOStreams{Out: output},
+		}
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(workloadsv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		runner = &Runner{
+			clientset:  kubefake.NewSimpleClientset(pod),
+			kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(csl, pod).Build(),
+		}
+		err = runner.Logs(context.TODO(), opts)
+	})
+
+	It("prints the logs of a stopped console", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.String()).To(Equal("fake logs"))
+	})
+
+	Context("when the container does not exist", func() {
+		BeforeEach(func() {
+			opts.Container = "missing"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring("container missing not found")))
+		})
+	})
+
+	Context("when the console has no pod", func() {
+		BeforeEach(func() {
+			csl.Status = workloadsv1alpha1.ConsoleStatus{Phase: workloadsv1alpha1.ConsolePendingAuthorisation}
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError(ContainSubstring("has no pod")))
+		})
+	})
+})